@@ -0,0 +1,434 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// A Privilege is the right to do something to a resource, see RFC 3744 s. 3.
+// Some privileges contain others: all contains every privilege, read contains
+// read-free-busy, and write contains write-properties, write-content, bind and
+// unbind.
+type Privilege string
+
+const (
+	PrivAll                         Privilege = "all"
+	PrivRead                                  = "read"
+	PrivReadFreeBusy                          = "read-free-busy" // RFC 4791 s. 6.1.1
+	PrivWrite                                 = "write"
+	PrivWriteProperties                       = "write-properties"
+	PrivWriteContent                          = "write-content"
+	PrivBind                                  = "bind"
+	PrivUnbind                                = "unbind"
+	PrivReadACL                               = "read-acl"
+	PrivWriteACL                              = "write-acl"
+	PrivReadCurrentUserPrivilegeSet           = "read-current-user-privilege-set"
+)
+
+var aggregates = map[Privilege][]Privilege{
+	PrivAll:   {PrivRead, PrivWrite, PrivReadACL, PrivWriteACL, PrivReadCurrentUserPrivilegeSet},
+	PrivRead:  {PrivReadFreeBusy},
+	PrivWrite: {PrivWriteProperties, PrivWriteContent, PrivBind, PrivUnbind},
+}
+
+// Every privilege, in the order they are listed in.
+var allPrivileges = []Privilege{
+	PrivAll, PrivRead, PrivReadFreeBusy, PrivWrite, PrivWriteProperties, PrivWriteContent,
+	PrivBind, PrivUnbind, PrivReadACL, PrivWriteACL, PrivReadCurrentUserPrivilegeSet,
+}
+
+func (p Privilege) xmlName() xml.Name {
+	if p == PrivReadFreeBusy {
+		return xml.Name{Space: caldavNS, Local: string(p)}
+	}
+	return xml.Name{Space: davNS, Local: string(p)}
+}
+
+// An ACE grants privileges to a principal, see RFC 3744 s. 5.5. Principal is
+// the path of a principal, which may be a group, or one of the
+// pseudo-principals below. Denying privileges isn't supported.
+type ACE struct {
+	Principal string
+	Grant     []Privilege
+}
+
+const (
+	AllPrincipals             = "all"
+	AuthenticatedPrincipals   = "authenticated"
+	UnauthenticatedPrincipals = "unauthenticated"
+)
+
+type privilegeSet map[Privilege]bool
+
+func (s privilegeSet) grant(p Privilege) {
+	if s[p] {
+		return
+	}
+	s[p] = true
+	for _, contained := range aggregates[p] {
+		s.grant(contained)
+	}
+}
+
+// An access is what the Handler knows about who is making a request, for
+// deciding what they may do. Without principals everybody may do anything.
+//
+// The owner of a calendar home has every privilege on it and on everything in
+// it. Anyone else gets what the ACL of the calendar a resource is or is in
+// grants them. Principals are readable by any authenticated principal, and
+// the root by everybody.
+type access struct {
+	backend    Backend
+	enforced   bool
+	user       *Principal
+	principals map[string]bool      // the user and the groups it is in
+	owners     map[string]string    // principal paths by calendar home
+	public     map[string]bool      // principals and the collections they are in
+	cals       map[string]*Calendar // calendars looked up so far, nil if missing
+}
+
+var errACLOnlyOnCalendars = httpError{http.StatusForbidden, "ACLs can only be set on calendars"}
+
+func needPrivileges(p string, priv Privilege) error {
+	return preconditionError{
+		httpError: httpError{http.StatusForbidden, "Insufficient privileges"},
+		cond:      xml.Name{Space: davNS, Local: "need-privileges"},
+		inner: `<resource>` + hrefElement(p) + `<privilege>` + emptyElement(priv.xmlName()) +
+			`</privilege></resource>`,
+	}
+}
+
+func aclPrecondition(msg, cond string) preconditionError {
+	return preconditionError{
+		httpError: httpError{http.StatusForbidden, msg},
+		cond:      xml.Name{Space: davNS, Local: cond},
+	}
+}
+
+// The preconditions of the ACL method, see RFC 3744 s. 8.1.1.
+var (
+	errGrantOnly        = aclPrecondition("Privileges can only be granted", "grant-only")
+	errNoInvert         = aclPrecondition("Inverted principals are not supported", "no-invert")
+	errUnsupportedPriv  = aclPrecondition("Unsupported privilege", "not-supported-privilege")
+	errUnknownPrincipal = aclPrecondition("Unrecognized principal", "recognized-principal")
+)
+
+// Finds out who is making a request.
+func (h *Handler) access(r *http.Request) (*access, error) {
+	a := &access{backend: h.Backend, cals: make(map[string]*Calendar)}
+	if h.Principals == nil {
+		return a, nil
+	}
+	prs, err := h.Principals.Principals()
+	if err != nil {
+		return nil, err
+	}
+	a.enforced = true
+	a.owners = make(map[string]string)
+	a.public = make(map[string]bool)
+	for _, pr := range prs {
+		if pr.CalendarHome != "" {
+			a.owners[collectionPath(pr.CalendarHome)] = pr.Path
+		}
+		a.public[pr.Path] = true
+		a.public[parentPath(pr.Path)] = true
+	}
+	user, err := h.Principals.CurrentPrincipal(r)
+	if errors.Is(err, ErrUnauthorized) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.user = &user
+	a.principals = memberships(user, prs)
+	return a, nil
+}
+
+// Returns the paths of a principal and of the groups it is a member of, and
+// of the groups those are members of, and so on.
+func memberships(pr Principal, prs []Principal) map[string]bool {
+	in := map[string]bool{pr.Path: true}
+	queue := pr.Members
+	for len(queue) > 0 {
+		addr := queue[0]
+		queue = queue[1:]
+		for _, group := range prs {
+			if in[group.Path] || !hasAddress(group, addr) {
+				continue
+			}
+			in[group.Path] = true
+			queue = append(queue, group.Members...)
+		}
+	}
+	return in
+}
+
+func hasAddress(pr Principal, addr string) bool {
+	for _, a := range pr.Addresses {
+		if icalendar.SameAddress(a, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the owner of the calendar home p is in, if any.
+func (a *access) owner(p string) string {
+	for home, owner := range a.owners {
+		if strings.HasPrefix(collectionPath(p), home) {
+			return owner
+		}
+	}
+	return ""
+}
+
+// Returns the calendar that p is or is in, or nil if there is none.
+func (a *access) calendar(p string) (*Calendar, error) {
+	candidates := []string{parentPath(p), collectionPath(p)}
+	if strings.HasSuffix(p, "/") {
+		candidates = candidates[1:]
+	}
+	for _, calPath := range candidates {
+		cal, seen := a.cals[calPath]
+		if !seen {
+			c, err := a.backend.Calendar(calPath)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				cal = &c
+			}
+			a.cals[calPath] = cal
+		}
+		if cal != nil {
+			return cal, nil
+		}
+	}
+	return nil, nil
+}
+
+// Reports whether an ACE's principal covers the current user.
+func (a *access) matches(principal string) bool {
+	switch principal {
+	case AllPrincipals:
+		return true
+	case AuthenticatedPrincipals:
+		return a.user != nil
+	case UnauthenticatedPrincipals:
+		return a.user == nil
+	}
+	return a.principals[collectionPath(principal)]
+}
+
+// Returns the privileges the current user has on the resource at p.
+func (a *access) privileges(p string) (privilegeSet, error) {
+	s := make(privilegeSet)
+	if !a.enforced || (a.user != nil && a.owner(p) == a.user.Path) {
+		s.grant(PrivAll)
+		return s, nil
+	}
+	// Principals are readable by every user, and so is whatever else is in
+	// the principal collection, so that they can tell which don't exist
+	if p == "/" || (a.user != nil && (a.public[collectionPath(p)] || a.public[parentPath(p)])) {
+		s.grant(PrivRead)
+	}
+	cal, err := a.calendar(p)
+	if err != nil {
+		return nil, err
+	}
+	if cal != nil {
+		for _, ace := range cal.ACL {
+			if !a.matches(ace.Principal) {
+				continue
+			}
+			for _, priv := range ace.Grant {
+				s.grant(priv)
+			}
+		}
+	}
+	return s, nil
+}
+
+func (a *access) can(p string, priv Privilege) (bool, error) {
+	s, err := a.privileges(p)
+	return s[priv], err
+}
+
+// Fails unless the current user has a privilege on the resource at p. When
+// nobody is logged in that is ErrUnauthorized, since logging in might help.
+func (a *access) check(p string, priv Privilege) error {
+	ok, err := a.can(p, priv)
+	switch {
+	case err != nil:
+		return err
+	case ok:
+		return nil
+	case a.user == nil:
+		return ErrUnauthorized
+	}
+	return needPrivileges(p, priv)
+}
+
+// Adds the access control properties of RFC 3744 s. 5 to a resource.
+func (a *access) addProps(rs resource) error {
+	s, err := a.privileges(rs.path)
+	if err != nil {
+		return err
+	}
+	var held strings.Builder
+	for _, priv := range allPrivileges {
+		if s[priv] {
+			held.WriteString(`<privilege xmlns="` + davNS + `">` + emptyElement(priv.xmlName()) + `</privilege>`)
+		}
+	}
+	rs.props[davCurrentPrivs] = held.String()
+	rs.props[davSupportedPrivs] = supportedPrivilege(PrivAll)
+	if !a.enforced {
+		return nil
+	}
+	rs.props[davACLRestrictions] = emptyElement(xml.Name{Space: davNS, Local: "grant-only"}) +
+		emptyElement(xml.Name{Space: davNS, Local: "no-invert"})
+	owner := a.owner(rs.path)
+	if owner != "" {
+		rs.props[davOwner] = hrefElement(owner)
+	}
+	if !s[PrivReadACL] {
+		return nil
+	}
+	var acl strings.Builder
+	if owner != "" {
+		acl.WriteString(renderACE(ACE{owner, []Privilege{PrivAll}}, `<protected/>`))
+	}
+	cal, err := a.calendar(rs.path)
+	if err != nil {
+		return err
+	}
+	if cal != nil {
+		var inherited string
+		if cal.Path != collectionPath(rs.path) {
+			inherited = `<inherited>` + hrefElement(cal.Path) + `</inherited>`
+		}
+		for _, ace := range cal.ACL {
+			acl.WriteString(renderACE(ace, inherited))
+		}
+	}
+	rs.props[davACL] = acl.String()
+	return nil
+}
+
+func supportedPrivilege(priv Privilege) string {
+	s := `<supported-privilege xmlns="` + davNS + `"><privilege>` + emptyElement(priv.xmlName()) + `</privilege>`
+	for _, contained := range aggregates[priv] {
+		s += supportedPrivilege(contained)
+	}
+	return s + `</supported-privilege>`
+}
+
+func renderACE(ace ACE, extra string) string {
+	var principal string
+	switch ace.Principal {
+	case AllPrincipals, AuthenticatedPrincipals, UnauthenticatedPrincipals:
+		principal = `<` + ace.Principal + `/>`
+	default:
+		principal = hrefElement(ace.Principal)
+	}
+	var grant strings.Builder
+	for _, priv := range ace.Grant {
+		grant.WriteString(`<privilege>` + emptyElement(priv.xmlName()) + `</privilege>`)
+	}
+	return `<ace xmlns="` + davNS + `"><principal>` + principal + `</principal><grant>` +
+		grant.String() + `</grant>` + extra + `</ace>`
+}
+
+// Replaces the ACL of a calendar, see RFC 3744 s. 8.1. Protected ACEs, which
+// clients send back as they got them, are left out.
+func (h *Handler) serveACL(w http.ResponseWriter, r *http.Request) error {
+	p := cleanPath(r.URL.Path)
+	a, err := h.access(r)
+	if err != nil {
+		return err
+	}
+	if err := a.check(p, PrivWriteACL); err != nil {
+		return err
+	}
+	cal, _, err := h.resolve(p)
+	if err != nil {
+		return err
+	}
+	if cal == nil {
+		return errACLOnlyOnCalendars
+	}
+	body, err := h.Limits.readBody(w, r)
+	if err != nil {
+		return err
+	}
+	var req aclRequest
+	if xml.Unmarshal(body, &req) != nil {
+		return errBadXML
+	}
+	var acl []ACE
+	for _, el := range req.ACEs {
+		if el.Protected != nil {
+			continue
+		}
+		if el.Deny != nil {
+			return errGrantOnly
+		}
+		if el.Invert != nil {
+			return errNoInvert
+		}
+		var ace ACE
+		switch pr := el.Principal; {
+		case pr.All != nil:
+			ace.Principal = AllPrincipals
+		case pr.Authenticated != nil:
+			ace.Principal = AuthenticatedPrincipals
+		case pr.Unauthenticated != nil:
+			ace.Principal = UnauthenticatedPrincipals
+		case pr.Href != "" && h.Principals != nil:
+			found, err := h.Principals.Principal(hrefPath(pr.Href))
+			if errors.Is(err, ErrNotFound) {
+				return errUnknownPrincipal
+			}
+			if err != nil {
+				return err
+			}
+			ace.Principal = found.Path
+		default:
+			return errUnknownPrincipal
+		}
+		if el.Grant == nil {
+			return errGrantOnly
+		}
+		for _, priv := range el.Grant.Privileges {
+			for _, name := range priv.Names {
+				p := Privilege(name.XMLName.Local)
+				if p.xmlName() != name.XMLName || !knownPrivilege(p) {
+					return errUnsupportedPriv
+				}
+				ace.Grant = append(ace.Grant, p)
+			}
+		}
+		acl = append(acl, ace)
+	}
+	cal.ACL = acl
+	if err := h.Backend.UpdateCalendar(*cal); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func knownPrivilege(p Privilege) bool {
+	for _, known := range allPrivileges {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func aclHandler() *Handler {
+	principals := NewMemoryPrincipals()
+	principals.AddPrincipal(Principal{Path: "/principals/alice/", CalendarHome: "/cal/alice/"}, "alice", "secret")
+	principals.AddPrincipal(Principal{Path: "/principals/bob/"}, "bob", "hunter2")
+	principals.AddPrincipal(Principal{
+		Path:    "/principals/carol/",
+		Members: []string{"mailto:team@example.com"},
+	}, "carol", "carol")
+	principals.AddPrincipal(Principal{Path: "/principals/dave/"}, "dave", "dave")
+	principals.AddPrincipal(Principal{
+		Path:      "/principals/team/",
+		Addresses: []string{"mailto:team@example.com"},
+	}, "", "")
+	h := &Handler{Backend: NewMemoryBackend(), Principals: principals}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/alice/work/", ACL: []ACE{
+		{"/principals/bob/", []Privilege{PrivRead}},
+		{"/principals/team/", []Privilege{PrivRead, PrivWrite}},
+		{"/principals/dave/", []Privilege{PrivReadFreeBusy}},
+	}})
+	return h
+}
+
+func Test_accessControl(t *testing.T) {
+	h := aclHandler()
+	if rec := do(t, h, "PUT", "/cal/alice/work/e1.ics", testEvent, "Authorization", auth("alice", "secret")); rec.Code != http.StatusCreated {
+		t.Fatalf("\nPUT by owner: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	other := strings.Replace(testEvent, "event-1@", "event-2@", 1)
+	freeBusy := `<?xml version="1.0"?>
+<C:free-busy-query xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <C:time-range start="20240101T000000Z" end="20240102T000000Z"/>
+</C:free-busy-query>`
+
+	tests := []struct {
+		user, method, path, body string
+		code                     int
+	}{
+		{"", "GET", "/cal/alice/work/e1.ics", "", http.StatusUnauthorized},
+		{"bob", "GET", "/cal/alice/work/e1.ics", "", http.StatusOK},
+		{"bob", "PUT", "/cal/alice/work/e1.ics", testEvent, http.StatusForbidden},
+		{"bob", "PUT", "/cal/alice/work/e2.ics", other, http.StatusForbidden},
+		{"bob", "DELETE", "/cal/alice/work/e1.ics", "", http.StatusForbidden},
+		{"bob", "MKCALENDAR", "/cal/alice/home/", "", http.StatusForbidden},
+		{"bob", "REPORT", "/cal/alice/work/", freeBusy, http.StatusOK},
+		{"carol", "PUT", "/cal/alice/work/e2.ics", other, http.StatusCreated},
+		{"carol", "DELETE", "/cal/alice/work/e2.ics", "", http.StatusNoContent},
+		{"dave", "GET", "/cal/alice/work/e1.ics", "", http.StatusForbidden},
+		{"dave", "PROPFIND", "/cal/alice/work/", "", http.StatusForbidden},
+		{"dave", "REPORT", "/cal/alice/work/", freeBusy, http.StatusOK},
+		{"alice", "MKCALENDAR", "/cal/alice/home/", "", http.StatusCreated},
+	}
+	passwords := map[string]string{"alice": "secret", "bob": "hunter2", "carol": "carol", "dave": "dave"}
+	for _, test := range tests {
+		var header []string
+		if test.user != "" {
+			header = []string{"Authorization", auth(test.user, passwords[test.user])}
+		}
+		rec := do(t, h, test.method, test.path, test.body, header...)
+		if rec.Code != test.code {
+			t.Errorf("\n%s %s as %q:\nexpected: %d\ngot:      %d %s\n", test.method, test.path, test.user, test.code, rec.Code, rec.Body)
+		}
+		if rec.Code == http.StatusForbidden && !strings.Contains(rec.Body.String(), "<need-privileges ") {
+			t.Errorf("\n%s %s as %q: expected need-privileges, got:\n%s\n", test.method, test.path, test.user, rec.Body)
+		}
+	}
+
+	rec := do(t, h, "REPORT", "/cal/alice/work/", freeBusy, "Authorization", auth("dave", "dave"))
+	if body := rec.Body.String(); !strings.Contains(body, "FREEBUSY;FBTYPE=BUSY:20240101T090000Z/20240101T100000Z") || strings.Contains(body, "Standup") {
+		t.Errorf("\nunexpected free-busy-query response:\n%s\n", body)
+	}
+
+	rec = do(t, h, "PROPFIND", "/cal/alice/work/", "", "Depth", "1", "Authorization", auth("bob", "hunter2"))
+	body := rec.Body.String()
+	if !strings.Contains(body, `<current-user-privilege-set xmlns="DAV:"><privilege xmlns="DAV:"><read xmlns="DAV:"/></privilege><privilege xmlns="DAV:"><read-free-busy xmlns="urn:ietf:params:xml:ns:caldav"/></privilege></current-user-privilege-set>`) {
+		t.Errorf("\nunexpected current-user-privilege-set:\n%s\n", body)
+	}
+	if !strings.Contains(body, "<href>/cal/alice/work/e1.ics</href>") || strings.Contains(body, "<acl ") {
+		t.Errorf("\nexpected members but no acl without read-acl:\n%s\n", body)
+	}
+	rec = do(t, h, "PROPFIND", "/cal/alice/work/", "", "Depth", "0", "Authorization", auth("alice", "secret"))
+	if body := rec.Body.String(); !strings.Contains(body, `<owner xmlns="DAV:"><href xmlns="DAV:">/principals/alice/</href></owner>`) ||
+		!strings.Contains(body, `<principal><href xmlns="DAV:">/principals/team/</href></principal>`) {
+		t.Errorf("\nexpected the owner and acl:\n%s\n", body)
+	}
+}
+
+func Test_accessControl_existence(t *testing.T) {
+	h := aclHandler()
+	if rec := do(t, h, "PUT", "/cal/alice/work/e1.ics", testEvent, "Authorization", auth("alice", "secret")); rec.Code != http.StatusCreated {
+		t.Fatalf("\nPUT by owner: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	passwords := map[string]string{"bob": "hunter2", "dave": "dave"}
+	tests := []struct {
+		user, method, body string
+		code               int
+	}{
+		{"", "GET", "", http.StatusUnauthorized},
+		{"dave", "GET", "", http.StatusForbidden},
+		{"dave", "PROPFIND", "", http.StatusForbidden},
+		{"dave", "PUT", testEvent, http.StatusForbidden},
+		{"bob", "PUT", testEvent, http.StatusForbidden},
+		{"bob", "DELETE", "", http.StatusForbidden},
+		{"bob", "ACL", `<?xml version="1.0"?><D:acl xmlns:D="DAV:"/>`, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		var header []string
+		if test.user != "" {
+			header = []string{"Authorization", auth(test.user, passwords[test.user])}
+		}
+		for _, path := range []string{"/cal/alice/work/e1.ics", "/cal/alice/work/none.ics"} {
+			rec := do(t, h, test.method, path, test.body, header...)
+			if rec.Code != test.code {
+				t.Errorf("\n%s %s as %q:\nexpected: %d\ngot:      %d %s\n", test.method, path, test.user, test.code, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+func Test_aclMethod(t *testing.T) {
+	h := aclHandler()
+	acl := func(aces string) string {
+		return `<?xml version="1.0"?><D:acl xmlns:D="DAV:">` + aces + `</D:acl>`
+	}
+	grantBob := `<D:ace><D:principal><D:href>/principals/bob/</D:href></D:principal>` +
+		`<D:grant><D:privilege><D:read/></D:privilege><D:privilege><D:write/></D:privilege></D:grant></D:ace>`
+	tests := []struct {
+		name, user, password, body string
+		code                       int
+		cond                       string
+	}{
+		{"not owner", "bob", "hunter2", acl(grantBob), http.StatusForbidden, "need-privileges"},
+		{"deny", "alice", "secret", acl(`<D:ace><D:principal><D:all/></D:principal><D:deny><D:privilege><D:read/></D:privilege></D:deny></D:ace>`),
+			http.StatusForbidden, "grant-only"},
+		{"invert", "alice", "secret", acl(`<D:ace><D:invert><D:principal><D:all/></D:principal></D:invert><D:grant><D:privilege><D:read/></D:privilege></D:grant></D:ace>`),
+			http.StatusForbidden, "no-invert"},
+		{"unknown privilege", "alice", "secret", acl(`<D:ace><D:principal><D:all/></D:principal><D:grant><D:privilege><D:fly/></D:privilege></D:grant></D:ace>`),
+			http.StatusForbidden, "not-supported-privilege"},
+		{"unknown principal", "alice", "secret", acl(`<D:ace><D:principal><D:href>/principals/eve/</D:href></D:principal><D:grant><D:privilege><D:read/></D:privilege></D:grant></D:ace>`),
+			http.StatusForbidden, "recognized-principal"},
+		{"grant", "alice", "secret", acl(grantBob), http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		rec := do(t, h, "ACL", "/cal/alice/work/", test.body, "Authorization", auth(test.user, test.password))
+		if body := rec.Body.String(); rec.Code != test.code || (test.cond != "" && !strings.Contains(body, "<"+test.cond+" ")) {
+			t.Errorf("\nACL %s:\nexpected: %d %s\ngot:      %d %s\n", test.name, test.code, test.cond, rec.Code, body)
+		}
+	}
+	other := strings.Replace(testEvent, "event-1@", "event-2@", 1)
+	if rec := do(t, h, "PUT", "/cal/alice/work/e2.ics", other, "Authorization", auth("bob", "hunter2")); rec.Code != http.StatusCreated {
+		t.Errorf("\nPUT after granting write: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	// The new ACL replaced the old one
+	if rec := do(t, h, "GET", "/cal/alice/work/e2.ics", "", "Authorization", auth("carol", "carol")); rec.Code != http.StatusForbidden {
+		t.Errorf("\nGET by a group no longer granted: expected 403, got %d\n", rec.Code)
+	}
+}
@@ -0,0 +1,280 @@
+package caldav
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// Backends return these (or errors wrapping them) so that the Handler can pick
+// the right status code.
+var (
+	ErrNotFound           = errors.New("Resource not found")
+	ErrAlreadyExists      = errors.New("Resource already exists")
+	ErrPreconditionFailed = errors.New("Precondition failed")
+	ErrForbidden          = errors.New("Forbidden")
+	ErrInvalidSyncToken   = errors.New("Invalid sync token")
+	ErrUnauthorized       = errors.New("Authentication required")
+)
+
+// A Calendar is a calendar collection. Path is the URL path of the collection
+// and always ends in a slash.
+type Calendar struct {
+	Path        string
+	DisplayName string
+	Description string
+	// The TZID of the calendar's time zone, which floating times in its
+	// objects are taken to be in when matching time ranges. Empty means UTC.
+	TimeZone string
+	// The component types that objects in the collection may contain, such as
+	// VEVENT and VTODO. Empty means any.
+	SupportedComponents []string
+	// Who besides the owner of the calendar home may do what with the
+	// calendar and its objects. Only enforced when the Handler has principals.
+	ACL []ACE
+}
+
+// An Object is a calendar object resource: a VCALENDAR stored at Path inside
+// some calendar collection. ScheduleTag is set for scheduling objects, those
+// with an ORGANIZER, see RFC 6638 s. 3.2.10.
+type Object struct {
+	Path        string
+	ETag        string
+	ScheduleTag string
+	ModTime     time.Time
+	Data        icalendar.Component
+}
+
+// A Condition makes a write conditional on the current state of its target,
+// mirroring the HTTP If-Match and If-None-Match headers and the
+// If-Schedule-Tag-Match header of RFC 6638 s. 8.3. The ETag lists may hold
+// "*", meaning any ETag. UniqueUID further requires that no other object in
+// the target's calendar has the UID of the object being written, see RFC 4791
+// s. 5.3.2.1. The zero Condition always holds.
+type Condition struct {
+	IfMatch            []string
+	IfNoneMatch        []string
+	IfScheduleTagMatch string
+	UniqueUID          bool
+}
+
+// A UIDConflictError reports the object that already has the UID of an object
+// written with Condition.UniqueUID.
+type UIDConflictError struct {
+	Path string
+}
+
+func (e UIDConflictError) Error() string {
+	return "UID is already in use by " + e.Path
+}
+
+// Reports whether the condition holds for the current state of the target,
+// where exists tells whether the target exists at all.
+func (c Condition) Holds(current Object, exists bool) bool {
+	if len(c.IfMatch) > 0 && (!exists || !matchETag(c.IfMatch, current.ETag)) {
+		return false
+	}
+	if len(c.IfNoneMatch) > 0 && exists && matchETag(c.IfNoneMatch, current.ETag) {
+		return false
+	}
+	if c.IfScheduleTagMatch != "" && (!exists || c.IfScheduleTagMatch != current.ScheduleTag) {
+		return false
+	}
+	return true
+}
+
+func matchETag(list []string, etag string) bool {
+	for _, e := range list {
+		if e == "*" || e == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// A Backend stores calendar collections and the objects in them. Paths are the
+// URL paths the Handler serves.
+//
+// Backends must be safe for concurrent use. Every method must behave as if it
+// ran atomically: a reader never sees an object half written, and the check
+// of a Condition happens in the same critical section as the write it guards,
+// so that of two clients racing to replace the same ETag exactly one succeeds
+// and the other gets ErrPreconditionFailed. Objects returned by a Backend
+// belong to the caller and must not share memory with the Backend's own copy.
+type Backend interface {
+	// Lists the calendar collections directly inside the collection at home.
+	Calendars(home string) ([]Calendar, error)
+	Calendar(path string) (Calendar, error)
+	// Fails with ErrAlreadyExists if there is already a calendar at cal.Path.
+	CreateCalendar(cal Calendar) error
+	// Replaces the properties of the calendar at cal.Path, leaving its objects
+	// alone.
+	UpdateCalendar(cal Calendar) error
+	// Deletes a calendar collection along with every object in it.
+	DeleteCalendar(path string) error
+
+	Objects(calPath string) ([]Object, error)
+	// Returns the objects in a calendar that may have instances overlapping
+	// [start, end). Backends may return extra objects, but never omit one that
+	// overlaps; callers apply the exact matching themselves.
+	QueryObjects(calPath string, start, end time.Time) ([]Object, error)
+	Object(path string) (Object, error)
+	// Creates or replaces an object, returning it as stored, with its new ETag.
+	// Backends keep an index of UIDs so that Condition.UniqueUID is checked
+	// without reading the whole calendar.
+	PutObject(path string, data icalendar.Component, cond Condition) (Object, error)
+	DeleteObject(path string, cond Condition) error
+
+	// Returns an opaque token that changes whenever an object in the calendar
+	// is created, modified or deleted.
+	ChangeToken(calPath string) (string, error)
+	// Returns the paths of the objects in a calendar that were created or
+	// modified, and of those that were deleted, since the change token since
+	// was current, along with the token that is current now. An empty since
+	// reports every object as changed. Fails with ErrInvalidSyncToken if the
+	// backend can no longer tell what changed since the token, or never issued
+	// it.
+	Changes(calPath, since string) (changed, deleted []string, token string, err error)
+}
+
+func collectionPath(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p
+	}
+	return p + "/"
+}
+
+// Returns the path of the collection containing the resource at p.
+func parentPath(p string) string {
+	p = strings.TrimSuffix(p, "/")
+	return p[:strings.LastIndexByte(p, '/')+1]
+}
+
+// Serializes an object, as the client sent it. Its ETag comes from its
+// canonical form instead, see objectETag.
+func encodeObject(data icalendar.Component) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := icalendar.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the UID of an object, which all its components but VTIMEZONEs
+// share.
+func uidOf(data icalendar.Component) string {
+	for _, c := range data.Components {
+		if c.Name != "VTIMEZONE" {
+			return c.Value("UID")
+		}
+	}
+	return ""
+}
+
+// Maps the UIDs in a calendar to the paths of the objects that have them.
+// Usually there's just the one, but nothing stops writes without
+// Condition.UniqueUID from adding more.
+type uidIndex map[string][]string
+
+func (idx uidIndex) add(uid, p string) {
+	if uid != "" {
+		idx[uid] = append(idx[uid], p)
+	}
+}
+
+func (idx uidIndex) remove(uid, p string) {
+	paths := idx[uid]
+	for i, other := range paths {
+		if other == p {
+			paths = append(paths[:i:i], paths[i+1:]...)
+			break
+		}
+	}
+	if len(paths) == 0 {
+		delete(idx, uid)
+	} else {
+		idx[uid] = paths
+	}
+}
+
+// Checks the UniqueUID part of a condition for writing an object with the
+// given UID to p.
+func (idx uidIndex) check(cond Condition, uid, p string) error {
+	if !cond.UniqueUID {
+		return nil
+	}
+	for _, other := range idx[uid] {
+		if other != p {
+			return UIDConflictError{other}
+		}
+	}
+	return nil
+}
+
+func decodeObject(raw []byte) (icalendar.Component, error) {
+	return icalendar.NewDecoder(bytes.NewReader(raw)).Decode()
+}
+
+// Builds the Object for the serialized form a backend stored.
+func newObject(p string, raw []byte, modTime time.Time) (Object, error) {
+	data, err := decodeObject(raw)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Path:        p,
+		ETag:        objectETag(data),
+		ScheduleTag: scheduleTag(data),
+		ModTime:     modTime,
+		Data:        data,
+	}, nil
+}
+
+// Splits the paths in a change set by whether they were deleted, sorting each
+// list.
+func splitChanges(state map[string]bool) (changed, deleted []string) {
+	for p, gone := range state {
+		if gone {
+			deleted = append(deleted, p)
+		} else {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	return
+}
+
+// Reports whether a VCALENDAR has an event, todo or journal instance
+// overlapping [start, end). Components without a DTSTART, and objects that
+// can't be expanded, are reported as overlapping in keeping with the
+// QueryObjects contract.
+func mayOverlap(data icalendar.Component, start, end time.Time) bool {
+	// Floating times are expanded as UTC, so widen the range by the largest
+	// UTC offset in use to avoid missing them.
+	start, end = start.Add(-14*time.Hour), end.Add(14*time.Hour)
+	for _, c := range data.Components {
+		switch c.Name {
+		case "VTIMEZONE":
+		case "VEVENT", "VTODO", "VJOURNAL":
+			_, hasStart := c.Field("DTSTART")
+			_, hasDue := c.Field("DUE")
+			if !hasStart && !hasDue {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	for _, name := range []string{"VEVENT", "VTODO", "VJOURNAL"} {
+		instances, err := icalendar.CalendarInstances(data, name, start, end)
+		if err != nil || len(instances) > 0 {
+			return true
+		}
+	}
+	return false
+}
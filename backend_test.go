@@ -0,0 +1,206 @@
+package caldav
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+func mustDecode(t *testing.T, src string) icalendar.Component {
+	c, err := icalendar.NewDecoder(bytes.NewBufferString(src)).Decode()
+	if err != nil {
+		t.Fatalf("\nunexpected error decoding %#v:\n%s\n", src, err)
+	}
+	return c
+}
+
+// Exercises the Backend contract. Every implementation should pass it.
+func testBackend(t *testing.T, b Backend) {
+	if err := b.CreateCalendar(Calendar{Path: "/cal/work/", DisplayName: "Work"}); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if err := b.CreateCalendar(Calendar{Path: "/cal/work/"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("\nexpected ErrAlreadyExists, got %v\n", err)
+	}
+	b.CreateCalendar(Calendar{Path: "/cal/home/"})
+	if cals, err := b.Calendars("/cal/"); err != nil || len(cals) != 2 || cals[1].DisplayName != "Work" {
+		t.Errorf("\nunexpected calendars: %#v (%v)\n", cals, err)
+	}
+	if _, err := b.Calendar("/cal/none/"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("\nexpected ErrNotFound, got %v\n", err)
+	}
+
+	token, _ := b.ChangeToken("/cal/work/")
+	data := mustDecode(t, testEvent)
+	obj, err := b.PutObject("/cal/work/e1.ics", data, Condition{IfNoneMatch: []string{"*"}})
+	if err != nil || obj.ETag == "" {
+		t.Fatalf("\nunexpected result: %#v (%v)\n", obj, err)
+	}
+	if _, err := b.PutObject("/cal/work/e1.ics", data, Condition{IfNoneMatch: []string{"*"}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("\nexpected ErrPreconditionFailed, got %v\n", err)
+	}
+	if _, err := b.PutObject("/cal/none/e1.ics", data, Condition{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("\nexpected ErrNotFound, got %v\n", err)
+	}
+	if again, _ := b.ChangeToken("/cal/work/"); again == token {
+		t.Errorf("\nchange token did not change\n")
+	}
+	got, err := b.Object("/cal/work/e1.ics")
+	if err != nil || got.ETag != obj.ETag || got.Data.Components[0].Value("UID") != "event-1@example.com" {
+		t.Errorf("\nunexpected object: %#v (%v)\n", got, err)
+	}
+	// Objects are not collections, nor do they hold anything
+	if _, err := b.Calendar("/cal/work/e1.ics/"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("\nexpected ErrNotFound for an object as a calendar, got %v\n", err)
+	}
+	if _, err := b.Object("/cal/work/e1.ics/e2.ics"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("\nexpected ErrNotFound for an object inside an object, got %v\n", err)
+	}
+	// Callers own what they get back
+	got.Data.Components[0].Fields = nil
+	if again, _ := b.Object("/cal/work/e1.ics"); len(again.Data.Components[0].Fields) == 0 {
+		t.Errorf("\nbackend shares memory with returned objects\n")
+	}
+
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	if objs, _ := b.QueryObjects("/cal/work/", day(1), day(2)); len(objs) != 1 {
+		t.Errorf("\nexpected the event in range, got %#v\n", objs)
+	}
+	if objs, _ := b.QueryObjects("/cal/work/", day(5), day(6)); len(objs) != 0 {
+		t.Errorf("\nexpected no events in range, got %#v\n", objs)
+	}
+
+	// Of several writers racing on the same ETag, exactly one wins
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wins := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := mustDecode(t, testEvent)
+			c.Components[0].SetField(icalendar.Field{Name: "SEQUENCE", Value: string(rune('0' + i))})
+			if _, err := b.PutObject("/cal/work/e1.ics", c, Condition{IfMatch: []string{obj.ETag}}); err == nil {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("\nunexpected error: %s\n", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Errorf("\nexpected exactly one conditional write to win, got %d\n", wins)
+	}
+
+	// Of several writers racing to store the same UID, exactly one wins
+	wins = 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := "/cal/home/u" + string(rune('0'+i)) + ".ics"
+			_, err := b.PutObject(p, data, Condition{UniqueUID: true})
+			var uerr UIDConflictError
+			if err == nil {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			} else if !errors.As(err, &uerr) {
+				t.Errorf("\nunexpected error: %s\n", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Errorf("\nexpected exactly one object with the UID, got %d\n", wins)
+	}
+	objs, _ := b.Objects("/cal/home/")
+	if len(objs) != 1 {
+		t.Fatalf("\nexpected one object, got %#v\n", objs)
+	}
+	if _, err := b.PutObject(objs[0].Path, data, Condition{UniqueUID: true}); err != nil {
+		t.Errorf("\nreplacing an object conflicted with itself: %s\n", err)
+	}
+	if _, err := b.PutObject("/cal/home/other.ics", data, Condition{}); err != nil {
+		t.Errorf("\nwrite without UniqueUID failed: %s\n", err)
+	}
+	b.DeleteObject(objs[0].Path, Condition{})
+	var uerr UIDConflictError
+	if _, err := b.PutObject("/cal/home/again.ics", data, Condition{UniqueUID: true}); !errors.As(err, &uerr) || uerr.Path != "/cal/home/other.ics" {
+		t.Errorf("\nexpected a conflict with /cal/home/other.ics, got %v\n", err)
+	}
+	b.DeleteObject("/cal/home/other.ics", Condition{})
+	if _, err := b.PutObject("/cal/home/again.ics", data, Condition{UniqueUID: true}); err != nil {
+		t.Errorf("\nUID still taken after its objects were deleted: %s\n", err)
+	}
+
+	// The change log sees the object created and then deleted
+	_, _, before, _ := b.Changes("/cal/work/", "")
+	b.PutObject("/cal/work/e3.ics", data, Condition{})
+	if changed, deleted, _, err := b.Changes("/cal/work/", token); err != nil ||
+		strings.Join(changed, " ") != "/cal/work/e1.ics /cal/work/e3.ics" || len(deleted) != 0 {
+		t.Errorf("\nunexpected changes: %v %v (%v)\n", changed, deleted, err)
+	}
+	b.DeleteObject("/cal/work/e3.ics", Condition{})
+	changed, deleted, after, err := b.Changes("/cal/work/", before)
+	if err != nil || len(changed) != 0 || strings.Join(deleted, " ") != "/cal/work/e3.ics" || after == before {
+		t.Errorf("\nunexpected changes: %v %v %s (%v)\n", changed, deleted, after, err)
+	}
+	if changed, deleted, _, err := b.Changes("/cal/work/", after); err != nil || len(changed)+len(deleted) != 0 {
+		t.Errorf("\nunexpected changes: %v %v (%v)\n", changed, deleted, err)
+	}
+	if _, _, _, err := b.Changes("/cal/work/", "garbage"); !errors.Is(err, ErrInvalidSyncToken) {
+		t.Errorf("\nexpected ErrInvalidSyncToken, got %v\n", err)
+	}
+
+	if err := b.DeleteObject("/cal/work/e1.ics", Condition{IfMatch: []string{obj.ETag}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("\nexpected ErrPreconditionFailed, got %v\n", err)
+	}
+	if err := b.DeleteObject("/cal/work/e1.ics", Condition{}); err != nil {
+		t.Errorf("\nunexpected error: %s\n", err)
+	}
+	if _, err := b.Object("/cal/work/e1.ics"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("\nexpected ErrNotFound, got %v\n", err)
+	}
+	b.PutObject("/cal/work/e2.ics", data, Condition{})
+	if err := b.DeleteCalendar("/cal/work/"); err != nil {
+		t.Errorf("\nunexpected error: %s\n", err)
+	}
+	if _, err := b.Object("/cal/work/e2.ics"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("\nobject outlived its calendar: %v\n", err)
+	}
+}
+
+func Test_MemoryBackend(t *testing.T) {
+	testBackend(t, NewMemoryBackend())
+}
+
+func Test_FSBackend(t *testing.T) {
+	b := NewFSBackend(t.TempDir())
+	testBackend(t, b)
+	if err := b.CreateCalendar(Calendar{Path: "/c/"}); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if _, err := b.PutObject("/c/.hidden.ics", mustDecode(t, testEvent), Condition{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("\nexpected ErrForbidden, got %v\n", err)
+	}
+	if _, err := b.PutObject("/c/event", mustDecode(t, testEvent), Condition{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("\nexpected ErrForbidden, got %v\n", err)
+	}
+
+	// The UID index is rebuilt from what's on disk
+	if _, err := b.PutObject("/c/a.ics", mustDecode(t, testEvent), Condition{}); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	var uerr UIDConflictError
+	if _, err := NewFSBackend(b.Root).PutObject("/c/b.ics", mustDecode(t, testEvent), Condition{UniqueUID: true}); !errors.As(err, &uerr) {
+		t.Errorf("\nexpected a UIDConflictError, got %v\n", err)
+	}
+}
@@ -0,0 +1,176 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+var errUnsupportedCalendarData = httpError{http.StatusForbidden, "Unsupported calendar-data type"}
+
+func (req calendarDataRequest) validate() error {
+	if (req.ContentType != "" && req.ContentType != "text/calendar") ||
+		(req.Version != "" && req.Version != "2.0") {
+		return errUnsupportedCalendarData
+	}
+	for _, tr := range []*TimeRange{req.Expand, req.LimitRecurrenceSet} {
+		if tr == nil {
+			continue
+		}
+		if _, err := tr.parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trims a calendar object down to what the request asks for. Recurrences are
+// expanded or limited first, and then components and properties are selected
+// from the result.
+func (req calendarDataRequest) apply(cal icalendar.Component, floating *time.Location) (icalendar.Component, error) {
+	var err error
+	switch {
+	case req.Expand != nil:
+		r, _ := req.Expand.parse()
+		if cal, err = expandCalendar(cal, r.bounded(), floating); err != nil {
+			return cal, err
+		}
+	case req.LimitRecurrenceSet != nil:
+		r, _ := req.LimitRecurrenceSet.parse()
+		if cal, err = limitRecurrenceSet(cal, r.bounded(), floating); err != nil {
+			return cal, err
+		}
+	}
+	if req.Comp != nil {
+		cal = req.Comp.apply(cal)
+	}
+	return cal, nil
+}
+
+// Keeps the properties and subcomponents of c that the selection names.
+func (sel compSelection) apply(c icalendar.Component) icalendar.Component {
+	out := icalendar.Component{Name: c.Name}
+	if sel.AllProp != nil {
+		out.Fields = c.Fields
+	} else {
+		for _, f := range c.Fields {
+			for _, ps := range sel.Props {
+				if !strings.EqualFold(ps.Name, f.Name) {
+					continue
+				}
+				if ps.NoValue == "yes" {
+					f.Value = ""
+				}
+				out.Fields = append(out.Fields, f)
+				break
+			}
+		}
+	}
+	if sel.AllComp != nil {
+		out.Components = c.Components
+		return out
+	}
+	for _, child := range c.Components {
+		for _, cs := range sel.Comps {
+			if strings.EqualFold(cs.Name, child.Name) {
+				out.Components = append(out.Components, cs.apply(child))
+				break
+			}
+		}
+	}
+	return out
+}
+
+var expandable = []string{"VEVENT", "VTODO", "VJOURNAL"}
+
+func isExpandable(name string) bool {
+	for _, e := range expandable {
+		if strings.EqualFold(e, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the recurring components of a calendar with the instances that
+// overlap r, each a standalone component with a RECURRENCE-ID and its times in
+// UTC, see RFC 4791 s. 9.6.5. Time zones are dropped since nothing refers to
+// them any more.
+func expandCalendar(cal icalendar.Component, r timeRange, floating *time.Location) (icalendar.Component, error) {
+	out := icalendar.Component{Name: cal.Name, Fields: cal.Fields}
+	for _, c := range cal.Components {
+		if !isExpandable(c.Name) && !strings.EqualFold(c.Name, "VTIMEZONE") {
+			out.Components = append(out.Components, c)
+		}
+	}
+	for _, name := range expandable {
+		instances, err := icalendar.CalendarInstancesIn(cal, name, r.start, r.end, floating)
+		if err != nil {
+			return cal, err
+		}
+		for _, inst := range instances {
+			out.Components = append(out.Components, instanceComponent(inst))
+		}
+	}
+	return out, nil
+}
+
+func instanceComponent(inst icalendar.Instance) icalendar.Component {
+	c := inst.Component
+	for _, name := range []string{"RRULE", "RDATE", "EXRULE", "EXDATE"} {
+		c.RemoveFields(name)
+	}
+	dtstart, hasStart := c.Field("DTSTART")
+	date := hasStart && dtstart.IsDate()
+	if hasStart {
+		c.SetField(timeField("DTSTART", inst.Start, date))
+	}
+	if _, has := c.Field("DTEND"); has {
+		c.SetField(timeField("DTEND", inst.End, date))
+	}
+	if _, has := c.Field("DUE"); has {
+		c.SetField(timeField("DUE", inst.End, date))
+	}
+	if !inst.RecurrenceID.IsZero() {
+		c.SetField(timeField("RECURRENCE-ID", inst.RecurrenceID, date))
+	}
+	return c
+}
+
+func timeField(name string, t time.Time, date bool) icalendar.Field {
+	if date {
+		return icalendar.Field{
+			Name:   name,
+			Params: map[string][]string{"VALUE": {"DATE"}},
+			Value:  t.Format("20060102"),
+		}
+	}
+	return icalendar.Field{Name: name, Value: t.UTC().Format(utcLayout)}
+}
+
+// Drops the overrides of recurring components that neither were nor are
+// scheduled in r, keeping masters whole, see RFC 4791 s. 9.6.6.
+func limitRecurrenceSet(cal icalendar.Component, r timeRange, floating *time.Location) (icalendar.Component, error) {
+	out := icalendar.Component{Name: cal.Name, Fields: cal.Fields}
+	for _, c := range cal.Components {
+		rid, isOverride := c.Field("RECURRENCE-ID")
+		if !isExpandable(c.Name) || !isOverride {
+			out.Components = append(out.Components, c)
+			continue
+		}
+		original, err := rid.DateTimeIn(floating)
+		if err != nil {
+			return cal, err
+		}
+		instances, err := icalendar.InstancesIn(c, nil, r.start, r.end, floating)
+		if err != nil {
+			return cal, err
+		}
+		if r.contains(original) || len(instances) > 0 {
+			out.Components = append(out.Components, c)
+		}
+	}
+	return out, nil
+}
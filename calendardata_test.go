@@ -0,0 +1,63 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+// A weekly event with its third instance moved by an hour.
+var recurringEvent = vcalendar(
+	"BEGIN:VTIMEZONE", "TZID:America/New_York", "END:VTIMEZONE",
+	"BEGIN:VEVENT", "UID:w", "DTSTART;TZID=America/New_York:20240101T090000", "DURATION:PT1H",
+	"RRULE:FREQ=WEEKLY;COUNT=4", "SUMMARY:Weekly", "DESCRIPTION:Long text", "END:VEVENT",
+	"BEGIN:VEVENT", "UID:w", "RECURRENCE-ID;TZID=America/New_York:20240115T090000",
+	"DTSTART;TZID=America/New_York:20240115T100000", "DURATION:PT1H", "SUMMARY:Moved", "END:VEVENT")
+
+func applyCalendarData(t *testing.T, src, request string) string {
+	var req calendarDataRequest
+	doc := `<C:calendar-data xmlns:C="urn:ietf:params:xml:ns:caldav">` + request + `</C:calendar-data>`
+	if err := xml.Unmarshal([]byte(doc), &req); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if err := req.validate(); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	cal, err := req.apply(mustDecode(t, src), time.UTC)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	raw, _ := encodeObject(cal)
+	return string(raw)
+}
+
+func Test_calendarData(t *testing.T) {
+	testCases := map[string]string{
+		`<C:comp name="VCALENDAR"><C:prop name="VERSION"/><C:prop name="PRODID"/>
+		   <C:comp name="VEVENT"><C:prop name="UID"/><C:prop name="DESCRIPTION" novalue="yes"/></C:comp>
+		 </C:comp>`: vcalendar(
+			"BEGIN:VEVENT", "UID:w", "DESCRIPTION:", "END:VEVENT",
+			"BEGIN:VEVENT", "UID:w", "END:VEVENT"),
+		`<C:comp name="VCALENDAR"><C:allprop/><C:comp name="VTIMEZONE"><C:allprop/></C:comp></C:comp>`: vcalendar(
+			"BEGIN:VTIMEZONE", "TZID:America/New_York", "END:VTIMEZONE"),
+		`<C:expand start="20240108T000000Z" end="20240122T000000Z"/>`: vcalendar(
+			"BEGIN:VEVENT", "UID:w", "DTSTART:20240108T140000Z", "DURATION:PT1H", "SUMMARY:Weekly",
+			"DESCRIPTION:Long text", "RECURRENCE-ID:20240108T140000Z", "END:VEVENT",
+			"BEGIN:VEVENT", "UID:w", "RECURRENCE-ID:20240115T140000Z", "DTSTART:20240115T150000Z",
+			"DURATION:PT1H", "SUMMARY:Moved", "END:VEVENT"),
+		`<C:limit-recurrence-set start="20240122T000000Z" end="20240129T000000Z"/>`: vcalendar(
+			"BEGIN:VTIMEZONE", "TZID:America/New_York", "END:VTIMEZONE",
+			"BEGIN:VEVENT", "UID:w", "DTSTART;TZID=America/New_York:20240101T090000", "DURATION:PT1H",
+			"RRULE:FREQ=WEEKLY;COUNT=4", "SUMMARY:Weekly", "DESCRIPTION:Long text", "END:VEVENT"),
+	}
+	for request, expected := range testCases {
+		if got := applyCalendarData(t, recurringEvent, request); got != expected {
+			t.Errorf("\nin case %s:\nexpected:\n%s\ngot:\n%s\n", request, expected, got)
+		}
+	}
+	var req calendarDataRequest
+	xml.Unmarshal([]byte(`<C:calendar-data xmlns:C="urn:ietf:params:xml:ns:caldav" content-type="application/calendar+json"/>`), &req)
+	if err := req.validate(); err != errUnsupportedCalendarData {
+		t.Errorf("\nexpected errUnsupportedCalendarData, got %v\n", err)
+	}
+}
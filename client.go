@@ -0,0 +1,465 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// A Client talks to a CalDAV server. Paths are URL paths on the server, as
+// for a Backend, and the Objects it returns carry the ETags the server sent.
+// HTTPClient is used to make requests, or http.DefaultClient if nil.
+type Client struct {
+	HTTPClient *http.Client
+	endpoint   *url.URL
+	user       string
+	password   string
+}
+
+var errNoPrincipal = errors.New("Server did not report a current-user-principal")
+
+// Many servers that predate sync-collection reports offer this property
+// instead, which changes whenever anything in the calendar does.
+var csGetCTag = xml.Name{Space: "http://calendarserver.org/ns/", Local: "getctag"}
+
+// A StatusError is the unexpected response status of a request. Statuses
+// with a meaning of their own, such as 404 and 412, are reported as the
+// matching Backend errors instead.
+type StatusError struct {
+	Method string
+	Path   string
+	Code   int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.Code, http.StatusText(e.Code))
+}
+
+// Returns a client for the server at endpoint, such as https://example.com/
+// or the URL of a calendar home.
+func NewClient(endpoint string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{endpoint: u}, nil
+}
+
+// Makes the client authenticate its requests with HTTP Basic authentication.
+func (c *Client) SetBasicAuth(user, password string) {
+	c.user, c.password = user, password
+}
+
+func (c *Client) do(method, p string, header http.Header, body []byte) (*http.Response, error) {
+	return c.send(c.httpClient(), method, p, header, body)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) send(client *http.Client, method, p string, header http.Header, body []byte) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path, u.RawPath, u.RawQuery = p, "", ""
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, vals := range header {
+		req.Header[name] = vals
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	return client.Do(req)
+}
+
+// Turns an unexpected response into an error, closing its body.
+func responseError(resp *http.Response) error {
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	}
+	return StatusError{resp.Request.Method, resp.Request.URL.Path, resp.StatusCode}
+}
+
+// What a client reads of a multistatus response. Only the properties the
+// client asks for are decoded.
+type multistatusReply struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Status    string `xml:"DAV: status"`
+		Propstats []struct {
+			Prop   replyProps `xml:"DAV: prop"`
+			Status string     `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+	SyncToken string `xml:"DAV: sync-token"`
+}
+
+type replyProps struct {
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	DisplayName         string  `xml:"DAV: displayname"`
+	ETag                string  `xml:"DAV: getetag"`
+	SyncToken           string  `xml:"DAV: sync-token"`
+	CurrentUser         davHref `xml:"DAV: current-user-principal"`
+	CalendarHome        davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	Description         string  `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+	TimeZone            string  `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+	CalendarData        string  `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	ScheduleTag         string  `xml:"urn:ietf:params:xml:ns:caldav schedule-tag"`
+	CTag                string  `xml:"http://calendarserver.org/ns/ getctag"`
+	SupportedComponents struct {
+		Comps []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+}
+
+// A propReply is a resource in a multistatus response with the properties
+// the server found for it. Missing resources, such as objects a
+// sync-collection report lists as deleted, have no properties.
+type propReply struct {
+	path    string
+	missing bool
+	props   replyProps
+}
+
+// Sends a PROPFIND or REPORT and reads the resources in its multistatus
+// response.
+func (c *Client) multistatus(method, p, depth string, body string) (res []propReply, token string, err error) {
+	header := http.Header{"Content-Type": {"application/xml; charset=utf-8"}}
+	if depth != "" {
+		header.Set("Depth", depth)
+	}
+	resp, err := c.do(method, p, header, []byte(xml.Header+body))
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		err = responseError(resp)
+		return
+	}
+	defer resp.Body.Close()
+	var ms multistatusReply
+	if err = xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return
+	}
+	for _, r := range ms.Responses {
+		pr := propReply{path: hrefPath(r.Href), missing: r.Status != "" && !strings.Contains(r.Status, " 200 ")}
+		for _, ps := range r.Propstats {
+			if strings.Contains(ps.Status, " 200 ") {
+				pr.props = ps.Prop
+			}
+		}
+		res = append(res, pr)
+	}
+	token = ms.SyncToken
+	return
+}
+
+// Renders a prop element asking for the named properties.
+func propElement(names ...xml.Name) string {
+	var b strings.Builder
+	b.WriteString(`<prop xmlns="` + davNS + `">`)
+	for _, name := range names {
+		b.WriteString(emptyElement(name))
+	}
+	b.WriteString(`</prop>`)
+	return b.String()
+}
+
+func (c *Client) propfind(p, depth string, names ...xml.Name) ([]propReply, error) {
+	res, _, err := c.multistatus("PROPFIND", p, depth, `<propfind xmlns="`+davNS+`">`+propElement(names...)+`</propfind>`)
+	return res, err
+}
+
+// Finds the principal the client is authenticated as, see RFC 5397. When the
+// endpoint doesn't say, the well-known URI of RFC 6764 is tried too.
+func (c *Client) FindCurrentUserPrincipal() (string, error) {
+	res, err := c.propfind(c.endpoint.Path, "0", davCurrentUser)
+	if err == nil && len(res) > 0 && res[0].props.CurrentUser.Href != "" {
+		return hrefPath(res[0].props.CurrentUser.Href), nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	start, err := c.wellKnown()
+	if err != nil {
+		return "", err
+	}
+	res, err = c.propfind(start, "0", davCurrentUser)
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 0 || res[0].props.CurrentUser.Href == "" {
+		return "", errNoPrincipal
+	}
+	return hrefPath(res[0].props.CurrentUser.Href), nil
+}
+
+// Returns the path the well-known URI redirects to, or the root if it
+// doesn't. Redirects aren't followed automatically, since they would turn
+// the PROPFIND into a GET.
+func (c *Client) wellKnown() (string, error) {
+	client := *c.httpClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := c.send(&client, "PROPFIND", wellKnownPath, http.Header{"Depth": {"0"}}, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc, err := resp.Location()
+	if err != nil {
+		return "/", nil
+	}
+	return loc.Path, nil
+}
+
+// Finds the calendar home of a principal, see RFC 4791 s. 6.2.1.
+func (c *Client) FindCalendarHomeSet(principal string) (string, error) {
+	res, err := c.propfind(principal, "0", calHomeSet)
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 0 || res[0].props.CalendarHome.Href == "" {
+		return "", ErrNotFound
+	}
+	return collectionPath(hrefPath(res[0].props.CalendarHome.Href)), nil
+}
+
+// Lists the calendars in a calendar home with their properties.
+func (c *Client) FindCalendars(home string) ([]Calendar, error) {
+	res, err := c.propfind(collectionPath(home), "1",
+		davResourceType, davDisplayName, calDescription, calTimeZone, calSupportedSet)
+	if err != nil {
+		return nil, err
+	}
+	var cals []Calendar
+	for _, r := range res {
+		if r.props.ResourceType.Calendar == nil {
+			continue
+		}
+		cal := Calendar{
+			Path:        collectionPath(r.path),
+			DisplayName: r.props.DisplayName,
+			Description: r.props.Description,
+		}
+		if r.props.TimeZone != "" {
+			cal.TimeZone, _ = timeZoneID(r.props.TimeZone)
+		}
+		for _, comp := range r.props.SupportedComponents.Comps {
+			cal.SupportedComponents = append(cal.SupportedComponents, comp.Name)
+		}
+		cals = append(cals, cal)
+	}
+	return cals, nil
+}
+
+// Asks for the objects in a calendar that match a filter on the VCALENDAR,
+// see RFC 4791 s. 7.8.
+func (c *Client) QueryCalendar(calPath string, filter CompFilter) ([]Object, error) {
+	var b strings.Builder
+	enc := xml.NewEncoder(&b)
+	err := enc.EncodeElement(filter, xml.StartElement{Name: xml.Name{Space: caldavNS, Local: "comp-filter"}})
+	if err != nil {
+		return nil, err
+	}
+	body := `<calendar-query xmlns="` + caldavNS + `">` + propElement(davGetETag, calScheduleTag, calCalendarData) +
+		`<filter>` + b.String() + `</filter></calendar-query>`
+	return c.objectReport(collectionPath(calPath), "1", body)
+}
+
+// Fetches several objects of a calendar at once, see RFC 4791 s. 7.9.
+// Objects that don't exist are left out.
+func (c *Client) MultiGetCalendar(calPath string, paths []string) ([]Object, error) {
+	var hrefs strings.Builder
+	for _, p := range paths {
+		hrefs.WriteString(hrefElement(p))
+	}
+	body := `<calendar-multiget xmlns="` + caldavNS + `">` + propElement(davGetETag, calScheduleTag, calCalendarData) +
+		hrefs.String() + `</calendar-multiget>`
+	return c.objectReport(collectionPath(calPath), "1", body)
+}
+
+// Reports what changed in a calendar since a sync token, see RFC 6578. An
+// empty token reports every object. changed maps the paths of objects created
+// or modified since to their ETags.
+func (c *Client) SyncCalendar(calPath, token string) (changed map[string]string, deleted []string, newToken string, err error) {
+	body := `<sync-collection xmlns="` + davNS + `"><sync-token>` + escapeText(token) + `</sync-token>` +
+		`<sync-level>1</sync-level>` + propElement(davGetETag) + `</sync-collection>`
+	res, newToken, err := c.multistatus("REPORT", collectionPath(calPath), "", body)
+	if err != nil {
+		return
+	}
+	changed = map[string]string{}
+	for _, r := range res {
+		if r.missing {
+			deleted = append(deleted, r.path)
+		} else {
+			changed[r.path] = unquoteETag(r.props.ETag)
+		}
+	}
+	return
+}
+
+// Lists the objects in a calendar with their ETags, along with the getctag
+// of the calendar if the server has one.
+func (c *Client) ObjectETags(calPath string) (etags map[string]string, ctag string, err error) {
+	calPath = collectionPath(calPath)
+	res, err := c.propfind(calPath, "1", davGetETag, csGetCTag)
+	if err != nil {
+		return
+	}
+	etags = map[string]string{}
+	for _, r := range res {
+		if collectionPath(r.path) == calPath {
+			ctag = r.props.CTag
+		} else if !r.missing {
+			etags[r.path] = unquoteETag(r.props.ETag)
+		}
+	}
+	return
+}
+
+func (c *Client) objectReport(p, depth, body string) ([]Object, error) {
+	res, _, err := c.multistatus("REPORT", p, depth, body)
+	if err != nil {
+		return nil, err
+	}
+	var objs []Object
+	for _, r := range res {
+		if r.props.CalendarData == "" {
+			continue
+		}
+		data, err := decodeObject([]byte(r.props.CalendarData))
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, Object{
+			Path:        r.path,
+			ETag:        unquoteETag(r.props.ETag),
+			ScheduleTag: unquoteETag(r.props.ScheduleTag),
+			Data:        data,
+		})
+	}
+	return objs, nil
+}
+
+func unquoteETag(s string) string {
+	if etags := parseETags(s, true); len(etags) == 1 {
+		return etags[0]
+	}
+	return ""
+}
+
+func (c *Client) GetObject(p string) (Object, error) {
+	resp, err := c.do("GET", p, nil, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Object{}, responseError(resp)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Object{}, err
+	}
+	data, err := decodeObject(raw)
+	if err != nil {
+		return Object{}, err
+	}
+	obj := Object{
+		Path:        p,
+		ETag:        unquoteETag(resp.Header.Get("ETag")),
+		ScheduleTag: unquoteETag(resp.Header.Get("Schedule-Tag")),
+		Data:        data,
+	}
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return obj, nil
+}
+
+// Creates or replaces an object, failing with ErrPreconditionFailed if cond
+// doesn't hold. The returned Object's ETag is empty when the server didn't
+// send one, as servers that changed the object while storing it may not.
+func (c *Client) PutObject(p string, data icalendar.Component, cond Condition) (Object, error) {
+	var buf bytes.Buffer
+	if err := icalendar.NewEncoder(&buf).Encode(data); err != nil {
+		return Object{}, err
+	}
+	header := conditionHeader(cond)
+	header.Set("Content-Type", "text/calendar; charset=utf-8")
+	resp, err := c.do("PUT", p, header, buf.Bytes())
+	if err != nil {
+		return Object{}, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return Object{}, responseError(resp)
+	}
+	resp.Body.Close()
+	return Object{
+		Path:        p,
+		ETag:        unquoteETag(resp.Header.Get("ETag")),
+		ScheduleTag: unquoteETag(resp.Header.Get("Schedule-Tag")),
+		ModTime:     time.Now(),
+		Data:        data,
+	}, nil
+}
+
+func (c *Client) DeleteObject(p string, cond Condition) error {
+	resp, err := c.do("DELETE", p, conditionHeader(cond), nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Renders a Condition as the request headers requestCondition reads.
+func conditionHeader(cond Condition) http.Header {
+	header := http.Header{}
+	quote := func(etags []string) string {
+		var quoted []string
+		for _, e := range etags {
+			if e != "*" {
+				e = quoteETag(e)
+			}
+			quoted = append(quoted, e)
+		}
+		return strings.Join(quoted, ", ")
+	}
+	if len(cond.IfMatch) > 0 {
+		header.Set("If-Match", quote(cond.IfMatch))
+	}
+	if len(cond.IfNoneMatch) > 0 {
+		header.Set("If-None-Match", quote(cond.IfNoneMatch))
+	}
+	if cond.IfScheduleTagMatch != "" {
+		header.Set("If-Schedule-Tag-Match", quoteETag(cond.IfScheduleTagMatch))
+	}
+	return header
+}
@@ -0,0 +1,78 @@
+package caldav
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Client(t *testing.T) {
+	server := httptest.NewServer(principalHandler())
+	defer server.Close()
+	c, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if _, err := c.FindCurrentUserPrincipal(); err != errNoPrincipal {
+		t.Errorf("\nanonymous discovery:\nexpected: %s\ngot:      %v\n", errNoPrincipal, err)
+	}
+	c.SetBasicAuth("alice", "secret")
+
+	principal, err := c.FindCurrentUserPrincipal()
+	if err != nil || principal != "/principals/alice/" {
+		t.Fatalf("\nunexpected principal %q: %v\n", principal, err)
+	}
+	home, err := c.FindCalendarHomeSet(principal)
+	if err != nil || home != "/cal/alice/" {
+		t.Fatalf("\nunexpected calendar home %q: %v\n", home, err)
+	}
+	cals, err := c.FindCalendars(home)
+	if err != nil || len(cals) != 1 || cals[0].Path != "/cal/alice/work/" || cals[0].DisplayName != "Work" {
+		t.Fatalf("\nunexpected calendars %#v: %v\n", cals, err)
+	}
+
+	event := func(summary string) string {
+		return vcalendar("BEGIN:VEVENT", "UID:e1", "DTSTAMP:20240101T000000Z", "DTSTART:20240101T090000Z",
+			"SUMMARY:"+summary, "END:VEVENT")
+	}
+	p := "/cal/alice/work/e1.ics"
+	created, err := c.PutObject(p, mustDecode(t, event("Planning")), Condition{IfNoneMatch: []string{"*"}})
+	if err != nil || created.ETag == "" {
+		t.Fatalf("\nunexpected result creating %s: %#v %v\n", p, created, err)
+	}
+	if _, err := c.PutObject(p, mustDecode(t, event("Again")), Condition{IfNoneMatch: []string{"*"}}); err != ErrPreconditionFailed {
+		t.Errorf("\ncreating twice:\nexpected: %s\ngot:      %v\n", ErrPreconditionFailed, err)
+	}
+
+	got, err := c.GetObject(p)
+	if err != nil || got.ETag != created.ETag || got.ModTime.IsZero() || got.Data.Components[0].Value("SUMMARY") != "Planning" {
+		t.Errorf("\nunexpected object %#v: %v\n", got, err)
+	}
+	if _, err := c.GetObject("/cal/alice/work/missing.ics"); err != ErrNotFound {
+		t.Errorf("\nmissing object:\nexpected: %s\ngot:      %v\n", ErrNotFound, err)
+	}
+
+	filter := inCalendar(CompFilter{Name: "VEVENT", TimeRange: &TimeRange{Start: "20240101T000000Z", End: "20240102T000000Z"}})
+	objs, err := c.QueryCalendar("/cal/alice/work/", filter)
+	if err != nil || len(objs) != 1 || objs[0].Path != p || objs[0].ETag != created.ETag {
+		t.Errorf("\nunexpected query result %#v: %v\n", objs, err)
+	}
+	filter = inCalendar(CompFilter{Name: "VEVENT", TimeRange: &TimeRange{Start: "20240201T000000Z"}})
+	if objs, err := c.QueryCalendar("/cal/alice/work/", filter); err != nil || len(objs) != 0 {
+		t.Errorf("\nunexpected query result %#v: %v\n", objs, err)
+	}
+	objs, err = c.MultiGetCalendar("/cal/alice/work/", []string{p, "/cal/alice/work/missing.ics"})
+	if err != nil || len(objs) != 1 || objs[0].Data.Components[0].Value("UID") != "e1" {
+		t.Errorf("\nunexpected multiget result %#v: %v\n", objs, err)
+	}
+
+	updated, err := c.PutObject(p, mustDecode(t, event("Renamed")), Condition{IfMatch: []string{created.ETag}})
+	if err != nil || updated.ETag == created.ETag {
+		t.Errorf("\nunexpected result updating %s: %#v %v\n", p, updated, err)
+	}
+	if err := c.DeleteObject(p, Condition{IfMatch: []string{created.ETag}}); err != ErrPreconditionFailed {
+		t.Errorf("\nstale delete:\nexpected: %s\ngot:      %v\n", ErrPreconditionFailed, err)
+	}
+	if err := c.DeleteObject(p, Condition{IfMatch: []string{updated.ETag}}); err != nil {
+		t.Errorf("\nunexpected error deleting %s: %s\n", p, err)
+	}
+}
@@ -0,0 +1,111 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// Derives the strong ETag of an object from its canonical form, so that it
+// only changes when the object's content does.
+func objectETag(data icalendar.Component) string {
+	return data.Canonical().Hash()[:32]
+}
+
+// Properties and parameters that attendees may change on their own copy of a
+// scheduling object without the organizer's involvement (RFC 6638 s.
+// 3.2.2.1), and which therefore don't affect its Schedule-Tag.
+var (
+	attendeeFields = map[string]bool{"DTSTAMP": true, "LAST-MODIFIED": true, "TRANSP": true}
+	attendeeParams = []string{"PARTSTAT", "RSVP", "SCHEDULE-STATUS"}
+)
+
+// Derives the Schedule-Tag of a scheduling object, which changes when the
+// organizer changes the object but not when attendees merely reply. Objects
+// without an ORGANIZER aren't scheduling objects and have no Schedule-Tag.
+// Neither spelling nor the order of properties affects it.
+func scheduleTag(data icalendar.Component) string {
+	scheduling := false
+	for _, c := range data.Components {
+		if _, has := c.Field("ORGANIZER"); has {
+			scheduling = true
+		}
+	}
+	if !scheduling {
+		return ""
+	}
+	return organizerView(data.Canonical()).Hash()[:32]
+}
+
+// Strips what attendees may change from a canonical object.
+func organizerView(c icalendar.Component) icalendar.Component {
+	out := icalendar.Component{Name: c.Name}
+	for _, f := range c.Fields {
+		if attendeeFields[f.Name] {
+			continue
+		}
+		if f.Name == "ATTENDEE" {
+			params := make(map[string][]string, len(f.Params))
+			for name, vals := range f.Params {
+				params[name] = vals
+			}
+			for _, name := range attendeeParams {
+				delete(params, name)
+			}
+			f.Params = params
+		}
+		out.Fields = append(out.Fields, f)
+	}
+	for _, child := range c.Components {
+		if child.Name != "VALARM" {
+			out.Components = append(out.Components, organizerView(child))
+		}
+	}
+	return out
+}
+
+// Parses the value of an If-Match or If-None-Match header into the ETags it
+// lists, without their quotes. Weak ETags are only kept when weak is set,
+// since If-Match uses the strong comparison function (RFC 7232 s. 2.3.2).
+// ETags that are dropped, and malformed ones, are replaced by an empty one,
+// which can never match but still makes the request conditional.
+func parseETags(header string, weak bool) (etags []string) {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if part == "*" {
+			etags = append(etags, "*")
+			continue
+		}
+		isWeak := strings.HasPrefix(part, "W/")
+		part = strings.TrimPrefix(part, "W/")
+		if len(part) < 2 || part[0] != '"' || part[len(part)-1] != '"' || isWeak && !weak {
+			etags = append(etags, "")
+			continue
+		}
+		etags = append(etags, part[1:len(part)-1])
+	}
+	return
+}
+
+// Reads the conditional headers of a request.
+func requestCondition(r *http.Request) (cond Condition) {
+	if h := r.Header.Get("If-Match"); h != "" {
+		cond.IfMatch = parseETags(h, false)
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		cond.IfNoneMatch = parseETags(h, true)
+	}
+	if h := r.Header.Get("If-Schedule-Tag-Match"); h != "" {
+		if tags := parseETags(h, false); len(tags) == 1 {
+			cond.IfScheduleTagMatch = tags[0]
+		} else {
+			// A malformed tag matches nothing
+			cond.IfScheduleTagMatch = "\x00"
+		}
+	}
+	return
+}
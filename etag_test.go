@@ -0,0 +1,153 @@
+package caldav
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const meetingEvent = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:meeting-1@example.com\r\n" +
+	"DTSTAMP:20240101T000000Z\r\n" +
+	"DTSTART:20240101T090000Z\r\n" +
+	"DTEND:20240101T100000Z\r\n" +
+	"SUMMARY:Planning\r\n" +
+	"ORGANIZER:mailto:alice@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func Test_parseETags(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		etags  []string
+	}{
+		{`"abc"`, false, []string{"abc"}},
+		{`"a", "b"`, false, []string{"a", "b"}},
+		{`*`, false, []string{"*"}},
+		{`W/"abc"`, false, []string{""}},
+		{`W/"abc", "def"`, true, []string{"abc", "def"}},
+		{`abc`, false, []string{""}},
+		{`"a", abc, `, false, []string{"a", ""}},
+	}
+	for _, test := range tests {
+		if etags := parseETags(test.header, test.weak); !reflect.DeepEqual(etags, test.etags) {
+			t.Errorf("\nparsing %s:\nexpected: %#v\ngot:      %#v\n", test.header, test.etags, etags)
+		}
+	}
+}
+
+func Test_canonicalETag(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/"})
+	respelled := strings.NewReplacer(
+		"SUMMARY:", "summary:",
+		"DTSTART:20240101T090000Z\r\nDTEND:20240101T100000Z", "DTEND;TZID=UTC:20240101T100000\r\nDTSTART:20240101T090000Z",
+	).Replace(testEvent)
+	if respelled == testEvent {
+		t.Fatalf("\nrespelling left the object as it was\n")
+	}
+	etags := make([]string, 2)
+	for i, body := range []string{testEvent, respelled} {
+		rec := do(t, h, "PUT", "/cal/e1.ics", body)
+		if rec.Code != http.StatusCreated && rec.Code != http.StatusNoContent {
+			t.Fatalf("\nPUT: expected 201 or 204, got %d: %s\n", rec.Code, rec.Body)
+		}
+		etags[i] = rec.Header().Get("ETag")
+	}
+	if etags[0] == "" || etags[0] != etags[1] {
+		t.Errorf("\nETag depends on the spelling of the object:\nexpected: %s\ngot:      %s\n", etags[0], etags[1])
+	}
+	// What's stored, and served under that ETag, is what was sent
+	if rec := do(t, h, "GET", "/cal/e1.ics", ""); rec.Header().Get("ETag") != etags[0] || rec.Body.String() != respelled {
+		t.Errorf("\nGET:\nexpected: %s\n%s\ngot:      %s\n%s\n", etags[0], respelled, rec.Header().Get("ETag"), rec.Body)
+	}
+}
+
+func Test_scheduleTag(t *testing.T) {
+	tag := scheduleTag(mustDecode(t, meetingEvent))
+	if tag == "" {
+		t.Fatalf("\nscheduling object has no Schedule-Tag\n")
+	}
+	if scheduleTag(mustDecode(t, testEvent)) != "" {
+		t.Errorf("\nobject without an ORGANIZER has a Schedule-Tag\n")
+	}
+	tests := []struct {
+		from, to string
+		changes  bool
+	}{
+		{"PARTSTAT=NEEDS-ACTION;RSVP=TRUE", "PARTSTAT=ACCEPTED", false},
+		{"DTSTAMP:20240101T000000Z", "DTSTAMP:20240102T000000Z", false},
+		{"END:VEVENT", "BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT5M\r\nEND:VALARM\r\nEND:VEVENT", false},
+		{"SUMMARY:Planning", "SUMMARY:Replanning", true},
+		{"DTSTART:20240101T090000Z", "DTSTART:20240101T083000Z", true},
+	}
+	for _, test := range tests {
+		changed := scheduleTag(mustDecode(t, strings.Replace(meetingEvent, test.from, test.to, 1))) != tag
+		if changed != test.changes {
+			t.Errorf("\nreplacing %s with %s:\nexpected change: %v\ngot:             %v\n", test.from, test.to, test.changes, changed)
+		}
+	}
+}
+
+func Test_conditionalRequests(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/"})
+
+	if rec := do(t, h, "PUT", "/cal/m.ics", meetingEvent, "If-Match", "*"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nPUT If-Match * of new object: expected 412, got %d\n", rec.Code)
+	}
+	rec := do(t, h, "PUT", "/cal/m.ics", meetingEvent, "If-None-Match", "*")
+	etag, tag := rec.Header().Get("ETag"), rec.Header().Get("Schedule-Tag")
+	if rec.Code != http.StatusCreated || etag == "" || tag == "" {
+		t.Fatalf("\nPUT: expected 201 with ETag and Schedule-Tag, got %d: %#v\n", rec.Code, rec.Header())
+	}
+	if rec := do(t, h, "PUT", "/cal/m.ics", meetingEvent, "If-None-Match", "*"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nPUT If-None-Match * of existing object: expected 412, got %d\n", rec.Code)
+	}
+
+	if rec := do(t, h, "GET", "/cal/m.ics", "", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("\nGET If-None-Match current ETag: expected 304, got %d\n", rec.Code)
+	}
+	if rec := do(t, h, "GET", "/cal/m.ics", "", "If-Match", `"stale"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nGET If-Match stale ETag: expected 412, got %d\n", rec.Code)
+	}
+	if rec := do(t, h, "GET", "/cal/m.ics", "", "If-Match", "W/"+etag); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nGET If-Match weak ETag: expected 412, got %d\n", rec.Code)
+	}
+
+	// An attendee reply leaves the Schedule-Tag alone, so a write conditional
+	// on it still succeeds after the reply
+	reply := strings.Replace(meetingEvent, "PARTSTAT=NEEDS-ACTION", "PARTSTAT=ACCEPTED", 1)
+	rec = do(t, h, "PUT", "/cal/m.ics", reply, "If-Match", etag)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Schedule-Tag") != tag || rec.Header().Get("ETag") == etag {
+		t.Errorf("\nreply: expected 204 with a new ETag and the same Schedule-Tag, got %d: %#v\n", rec.Code, rec.Header())
+	}
+	update := strings.Replace(meetingEvent, "Planning", "Replanning", 1)
+	if rec := do(t, h, "PUT", "/cal/m.ics", update, "If-Match", etag); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nPUT with stale ETag: expected 412, got %d\n", rec.Code)
+	}
+	rec = do(t, h, "PUT", "/cal/m.ics", update, "If-Schedule-Tag-Match", tag)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Schedule-Tag") == tag {
+		t.Errorf("\nPUT If-Schedule-Tag-Match: expected 204 with a new Schedule-Tag, got %d: %#v\n", rec.Code, rec.Header())
+	}
+	if rec := do(t, h, "PUT", "/cal/m.ics", update, "If-Schedule-Tag-Match", tag); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nPUT with stale Schedule-Tag: expected 412, got %d\n", rec.Code)
+	}
+
+	if rec := do(t, h, "DELETE", "/cal/m.ics", "", "If-Match", etag); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nDELETE with stale ETag: expected 412, got %d\n", rec.Code)
+	}
+	if rec := do(t, h, "DELETE", "/cal/m.ics", "", "If-Match", "abc"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("\nDELETE with unquoted ETag: expected 412, got %d\n", rec.Code)
+	}
+	etag = do(t, h, "GET", "/cal/m.ics", "").Header().Get("ETag")
+	if rec := do(t, h, "DELETE", "/cal/m.ics", "", "If-Match", etag); rec.Code != http.StatusNoContent {
+		t.Errorf("\nDELETE with current ETag: expected 204, got %d\n", rec.Code)
+	}
+}
@@ -0,0 +1,340 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// A CompFilter selects calendar objects by their components, see RFC 4791
+// s. 9.7.1. The filter of a calendar-query is a CompFilter named VCALENDAR.
+//
+// A CompFilter with IsNotDefined set matches when there is no component with
+// its Name. Otherwise it matches when some component with its Name falls in
+// its TimeRange, if any, and satisfies every one of its Props and Comps.
+// Recurring components are tested instance by instance.
+type CompFilter struct {
+	Name         string       `xml:"name,attr"`
+	IsNotDefined *struct{}    `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *TimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	Props        []PropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+	Comps        []CompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// A PropFilter tests the properties of a component, see RFC 4791 s. 9.7.2. It
+// matches when some property with its Name satisfies its TimeRange and
+// TextMatch, if any, and every one of its Params.
+type PropFilter struct {
+	Name         string        `xml:"name,attr"`
+	IsNotDefined *struct{}     `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *TimeRange    `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	TextMatch    *TextMatch    `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+	Params       []ParamFilter `xml:"urn:ietf:params:xml:ns:caldav param-filter"`
+}
+
+// A ParamFilter tests a parameter of a property, see RFC 4791 s. 9.7.3.
+type ParamFilter struct {
+	Name         string     `xml:"name,attr"`
+	IsNotDefined *struct{}  `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TextMatch    *TextMatch `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+// A TextMatch is a substring test, see RFC 4791 s. 9.7.5. Collation is one of
+// the constants below, with the empty string meaning CollationASCIICasemap.
+// NegateCondition is "yes" to invert the test.
+type TextMatch struct {
+	Collation       string `xml:"collation,attr,omitempty"`
+	NegateCondition string `xml:"negate-condition,attr,omitempty"`
+	Text            string `xml:",chardata"`
+}
+
+const (
+	CollationOctet        = "i;octet"
+	CollationASCIICasemap = "i;ascii-casemap"
+)
+
+var errUnsupportedCollation = httpError{http.StatusForbidden, "Unsupported collation"}
+
+// Reports whether a calendar object matches the filter, which applies to the
+// object's VCALENDAR itself. Floating times are read as UTC; use MatchesIn to
+// pick a different zone for them.
+func (f CompFilter) Matches(cal icalendar.Component) bool {
+	return f.MatchesIn(cal, time.UTC)
+}
+
+func (f CompFilter) MatchesIn(cal icalendar.Component, floating *time.Location) bool {
+	if f.IsNotDefined != nil {
+		return cal.Name != f.Name
+	}
+	return cal.Name == f.Name && f.matchComponent(cal, nil, floating)
+}
+
+// Checks that the filter only uses collations we support, and that its time
+// ranges are well formed.
+func (f CompFilter) validate() error {
+	if f.TimeRange != nil {
+		if _, err := f.TimeRange.parse(); err != nil {
+			return err
+		}
+	}
+	for _, pf := range f.Props {
+		if err := pf.TextMatch.validate(); err != nil {
+			return err
+		}
+		if pf.TimeRange != nil {
+			if _, err := pf.TimeRange.parse(); err != nil {
+				return err
+			}
+		}
+		for _, paf := range pf.Params {
+			if err := paf.TextMatch.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, cf := range f.Comps {
+		if err := cf.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the time range that every matching object must have an instance in,
+// if the filter has one, so that backends can narrow down the candidates.
+func (f CompFilter) componentRange() (r timeRange, has bool) {
+	if f.IsNotDefined != nil || len(f.Comps) != 1 {
+		return
+	}
+	cf := f.Comps[0]
+	switch strings.ToUpper(cf.Name) {
+	case "VEVENT", "VTODO", "VJOURNAL":
+	default:
+		return
+	}
+	if cf.IsNotDefined != nil || cf.TimeRange == nil {
+		return
+	}
+	r, err := cf.TimeRange.parse()
+	if err != nil || r.start.IsZero() || r.end.Equal(farFuture) {
+		return
+	}
+	return r, true
+}
+
+// Returns the union of the time ranges of the filters nested in f.
+func (f CompFilter) nestedRange() (r timeRange, has bool) {
+	for _, cf := range f.Comps {
+		if cf.TimeRange != nil {
+			if cr, err := cf.TimeRange.parse(); err == nil {
+				r, has = unionRange(r, has, cr), true
+			}
+		}
+		if cr, cHas := cf.nestedRange(); cHas {
+			r, has = unionRange(r, has, cr), true
+		}
+	}
+	return
+}
+
+func unionRange(r timeRange, has bool, other timeRange) timeRange {
+	if !has {
+		return other
+	}
+	return r.union(other)
+}
+
+// Tests a component that has the filter's name. inst is the component's own
+// recurrence instance, if it was expanded.
+func (f CompFilter) matchComponent(c icalendar.Component, inst *icalendar.Instance, floating *time.Location) bool {
+	for _, pf := range f.Props {
+		if !pf.matchIn(c, floating) {
+			return false
+		}
+	}
+	for _, cf := range f.Comps {
+		if !cf.matchIn(c, inst, floating) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tests the children of parent. parentInst is the recurrence instance of
+// parent being considered, which alarm time ranges are measured against.
+func (f CompFilter) matchIn(parent icalendar.Component, parentInst *icalendar.Instance, floating *time.Location) bool {
+	children := parent.ComponentsNamed(f.Name)
+	if f.IsNotDefined != nil {
+		return len(children) == 0
+	}
+	var r timeRange
+	if f.TimeRange != nil {
+		r, _ = f.TimeRange.parse()
+	}
+	name := strings.ToUpper(f.Name)
+	switch name {
+	case "VEVENT", "VTODO", "VJOURNAL":
+		if _, nested := f.nestedRange(); f.TimeRange != nil || nested {
+			return f.matchInstances(name, parent, floating)
+		}
+	case "VALARM":
+		if f.TimeRange != nil {
+			for _, child := range children {
+				if r.matchAlarm(child, parentInst) && f.matchComponent(child, nil, floating) {
+					return true
+				}
+			}
+			return false
+		}
+	case "VFREEBUSY":
+		if f.TimeRange != nil {
+			for _, child := range children {
+				if r.matchFreeBusy(child) && f.matchComponent(child, nil, floating) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	for _, child := range children {
+		if f.matchComponent(child, nil, floating) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tests the recurrence instances of the VEVENTs, VTODOs or VJOURNALs in
+// parent, so that a recurring component matches a range containing any one of
+// its instances. Overridden instances are tested against their override.
+func (f CompFilter) matchInstances(name string, parent icalendar.Component, floating *time.Location) bool {
+	var r timeRange
+	var from, to time.Time
+	if f.TimeRange != nil {
+		r, _ = f.TimeRange.parse()
+		from, to = r.window()
+	} else {
+		// Only nested alarms are restricted, and they may fire well before
+		// or after the instances they belong to
+		nested, _ := f.nestedRange()
+		reach := alarmReach(parent.ComponentsNamed(f.Name))
+		from, to = nested.window()
+		from, to = from.Add(-reach), to.Add(reach)
+	}
+	instances, err := icalendar.CalendarInstancesIn(parent, name, from, to, floating)
+	if err != nil {
+		return false
+	}
+	for i := range instances {
+		inst := &instances[i]
+		if f.TimeRange != nil && !r.matchInstance(name, *inst) {
+			continue
+		}
+		if f.matchComponent(inst.Component, inst, floating) {
+			return true
+		}
+	}
+	// Components with no start can't be expanded, but some still match
+	for _, child := range parent.ComponentsNamed(f.Name) {
+		_, hasStart := child.Field("DTSTART")
+		_, hasDue := child.Field("DUE")
+		if hasStart || (hasDue && name == "VTODO") {
+			continue
+		}
+		if f.TimeRange != nil && (name != "VTODO" || !r.matchUndatedTodo(child, floating)) {
+			continue
+		}
+		if f.matchComponent(child, nil, floating) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f PropFilter) matchIn(c icalendar.Component, floating *time.Location) bool {
+	fields := c.FieldsNamed(f.Name)
+	if f.IsNotDefined != nil {
+		return len(fields) == 0
+	}
+	for _, field := range fields {
+		if f.matchField(field, floating) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f PropFilter) matchField(field icalendar.Field, floating *time.Location) bool {
+	if f.TimeRange != nil {
+		r, _ := f.TimeRange.parse()
+		if !r.matchField(field, floating) {
+			return false
+		}
+	}
+	if f.TextMatch != nil && !f.TextMatch.match(field.Text()) {
+		return false
+	}
+	for _, pf := range f.Params {
+		if !pf.matchIn(field) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f ParamFilter) matchIn(field icalendar.Field) bool {
+	var vals []string
+	has := false
+	for name, v := range field.Params {
+		if strings.EqualFold(name, f.Name) {
+			vals, has = v, true
+		}
+	}
+	if f.IsNotDefined != nil {
+		return !has
+	}
+	if !has {
+		return false
+	}
+	if f.TextMatch == nil {
+		return true
+	}
+	for _, val := range vals {
+		if f.TextMatch.match(val) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *TextMatch) validate() error {
+	if m == nil {
+		return nil
+	}
+	switch m.Collation {
+	case "", CollationOctet, CollationASCIICasemap:
+		return nil
+	}
+	return errUnsupportedCollation
+}
+
+func (m TextMatch) match(s string) bool {
+	text := m.Text
+	if m.Collation != CollationOctet {
+		s, text = asciiLower(s), asciiLower(text)
+	}
+	return strings.Contains(s, text) != (m.NegateCondition == "yes")
+}
+
+// Lowercases ASCII letters only, as the i;ascii-casemap collation requires.
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,86 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const filterEvent = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:event-2@example.com\r\n" +
+	"DTSTART:20240101T090000Z\r\n" +
+	"SUMMARY:Review\\, planning\r\n" +
+	"ATTENDEE;PARTSTAT=NEEDS-ACTION;CN=Ann:mailto:ann@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func Test_CompFilter(t *testing.T) {
+	cal := mustDecode(t, filterEvent)
+	testCases := map[string]bool{
+		`<C:comp-filter name="VCALENDAR"/>`:                                                                               true,
+		`<C:comp-filter name="VCARD"/>`:                                                                                   false,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"/></C:comp-filter>`:                                  true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"/></C:comp-filter>`:                                   false,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"><C:is-not-defined/></C:comp-filter></C:comp-filter>`: true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:comp-filter name="VALARM"><C:prop-filter name="ACTION"><C:text-match>display</C:text-match></C:prop-filter></C:comp-filter>
+		 </C:comp-filter></C:comp-filter>`: true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="SUMMARY"><C:text-match>review, PLAN</C:text-match></C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="SUMMARY"><C:text-match collation="i;octet">review</C:text-match></C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: false,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="SUMMARY"><C:text-match negate-condition="yes">lunch</C:text-match></C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="LOCATION"><C:is-not-defined/></C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="UID"><C:is-not-defined/></C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: false,
+		// Both parameter filters must hold for the same attendee
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="ATTENDEE">
+		     <C:text-match>ann@</C:text-match>
+		     <C:param-filter name="partstat"><C:text-match>NEEDS-ACTION</C:text-match></C:param-filter>
+		   </C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: true,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="ATTENDEE">
+		     <C:text-match>bob@</C:text-match>
+		     <C:param-filter name="PARTSTAT"><C:text-match>NEEDS-ACTION</C:text-match></C:param-filter>
+		   </C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: false,
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+		   <C:prop-filter name="ATTENDEE">
+		     <C:text-match>bob@</C:text-match>
+		     <C:param-filter name="CN"><C:is-not-defined/></C:param-filter>
+		   </C:prop-filter>
+		 </C:comp-filter></C:comp-filter>`: true,
+	}
+	for src, expected := range testCases {
+		doc := `<C:filter xmlns:C="urn:ietf:params:xml:ns:caldav">` + src + `</C:filter>`
+		var wrapper struct {
+			Comp CompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		}
+		if err := xml.Unmarshal([]byte(doc), &wrapper); err != nil {
+			t.Fatalf("\nunexpected error in case %s:\n%s\n", src, err)
+		}
+		if got := wrapper.Comp.Matches(cal); got != expected {
+			t.Errorf("\nin case %s:\nexpected: %t\ngot:      %t\n", src, expected, got)
+		}
+	}
+	bad := CompFilter{Name: "VCALENDAR", Props: []PropFilter{{Name: "UID", TextMatch: &TextMatch{Collation: "i;unicode-casemap"}}}}
+	if err := bad.validate(); err != errUnsupportedCollation {
+		t.Errorf("\nexpected errUnsupportedCollation, got %v\n", err)
+	}
+}
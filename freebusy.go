@@ -0,0 +1,67 @@
+package caldav
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+var errNoTimeRange = httpError{http.StatusBadRequest, "free-busy-query requires a time-range"}
+
+// Answers a free-busy-query on a calendar with a VFREEBUSY covering the
+// requested range, see RFC 4791 s. 7.10. It needs only the read-free-busy
+// privilege, so it reveals when the calendar is busy but nothing else.
+func (h *Handler) serveFreeBusyQuery(w http.ResponseWriter, p string, query freeBusyQuery) error {
+	if query.TimeRange == nil {
+		return errNoTimeRange
+	}
+	tr, err := query.TimeRange.parse()
+	if err != nil {
+		return err
+	}
+	tr = tr.bounded()
+	cal, _, err := h.resolve(p)
+	if err != nil {
+		return err
+	}
+	if cal == nil {
+		return errMethodNotAllowed
+	}
+	objs, err := h.Backend.QueryObjects(cal.Path, tr.start, tr.end)
+	if err != nil {
+		return err
+	}
+	cals := make([]icalendar.Component, len(objs))
+	for i, obj := range objs {
+		cals[i] = obj.Data
+	}
+	busy, err := icalendar.FreeBusy(cals, tr.start, tr.end)
+	if err != nil {
+		return err
+	}
+	fb := icalendar.VFreeBusy{
+		Stamp: time.Now().UTC().Truncate(time.Second),
+		Start: tr.start,
+		End:   tr.end,
+		Busy:  busy,
+	}
+	out := icalendar.Component{
+		Name: "VCALENDAR",
+		Fields: []icalendar.Field{
+			{Name: "VERSION", Value: "2.0"},
+			{Name: "PRODID", Value: prodID},
+		},
+		Components: []icalendar.Component{fb.Component()},
+	}
+	raw, err := encodeObject(out)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(raw)
+	return nil
+}
@@ -0,0 +1,465 @@
+package caldav
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// An FSBackend stores each calendar collection as a directory under Root, and
+// each object as a .ics file in its collection's directory. Collection
+// properties live in a hidden metadata file alongside the objects. Object
+// names must end in .ics and must not start with a dot.
+//
+// Every change to a collection is appended to a hidden log file, from which
+// Changes answers.
+//
+// Writes go through a temporary file and a rename, so readers never see a
+// partial object. The lock that makes Conditions atomic is held in memory,
+// so only one FSBackend (in one process) should use a given Root at a time.
+// The same goes for the index of UIDs, which is built from a calendar's
+// objects the first time one is written to it.
+type FSBackend struct {
+	Root string
+	mu   sync.RWMutex
+	uids map[string]uidIndex // by calendar path
+}
+
+const (
+	calendarMetaFile = ".calendar.json"
+	changeLogFile    = ".changes"
+)
+
+type calendarMeta struct {
+	DisplayName         string
+	Description         string
+	TimeZone            string
+	SupportedComponents []string
+	ACL                 []ACE
+	Token               int64
+	Created             int64 // the token the calendar started out with
+}
+
+func NewFSBackend(root string) *FSBackend {
+	return &FSBackend{Root: root}
+}
+
+// Maps a URL path onto the filesystem, making sure it can't escape Root.
+func (b *FSBackend) localPath(p string) string {
+	return filepath.Join(b.Root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// Reports whether err means there's nothing at a path, either because it
+// doesn't exist or because part of it is a file rather than a directory, as
+// for the calendar an object path like /cal/e1.ics/ would name.
+func notExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func (b *FSBackend) readMeta(calPath string) (calendarMeta, error) {
+	var meta calendarMeta
+	raw, err := os.ReadFile(filepath.Join(b.localPath(calPath), calendarMetaFile))
+	if notExist(err) {
+		return meta, ErrNotFound
+	}
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(raw, &meta)
+	return meta, err
+}
+
+func (b *FSBackend) writeMeta(calPath string, meta calendarMeta) error {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(b.localPath(calPath), calendarMetaFile), raw)
+}
+
+// Bumps a calendar's change token and logs the change to the object at p.
+// Tokens start from the creation time so that a calendar deleted and
+// recreated doesn't reuse old tokens.
+func (b *FSBackend) touch(p string, deleted bool) error {
+	calPath := parentPath(p)
+	meta, err := b.readMeta(calPath)
+	if err != nil {
+		return err
+	}
+	meta.Token++
+	kind := "M"
+	if deleted {
+		kind = "D"
+	}
+	log, err := os.OpenFile(filepath.Join(b.localPath(calPath), changeLogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(log, "%d %s %s\n", meta.Token, kind, path.Base(p))
+	if cerr := log.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return b.writeMeta(calPath, meta)
+}
+
+func (b *FSBackend) Calendars(home string) ([]Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	home = collectionPath(home)
+	entries, err := os.ReadDir(b.localPath(home))
+	if notExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cals []Calendar
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		cal, err := b.calendar(home + entry.Name() + "/")
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cals = append(cals, cal)
+	}
+	return cals, nil
+}
+
+func (b *FSBackend) Calendar(p string) (Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.calendar(p)
+}
+
+func (b *FSBackend) calendar(p string) (Calendar, error) {
+	meta, err := b.readMeta(p)
+	if err != nil {
+		return Calendar{}, err
+	}
+	return Calendar{
+		Path:                p,
+		DisplayName:         meta.DisplayName,
+		Description:         meta.Description,
+		TimeZone:            meta.TimeZone,
+		SupportedComponents: meta.SupportedComponents,
+		ACL:                 meta.ACL,
+	}, nil
+}
+
+func (b *FSBackend) CreateCalendar(cal Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal.Path = collectionPath(cal.Path)
+	if _, err := b.readMeta(cal.Path); err == nil {
+		return ErrAlreadyExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := os.MkdirAll(b.localPath(cal.Path), 0755); err != nil {
+		return err
+	}
+	token := time.Now().UnixNano()
+	return b.writeMeta(cal.Path, calendarMeta{
+		DisplayName:         cal.DisplayName,
+		Description:         cal.Description,
+		TimeZone:            cal.TimeZone,
+		SupportedComponents: cal.SupportedComponents,
+		ACL:                 cal.ACL,
+		Token:               token,
+		Created:             token,
+	})
+}
+
+func (b *FSBackend) UpdateCalendar(cal Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal.Path = collectionPath(cal.Path)
+	meta, err := b.readMeta(cal.Path)
+	if err != nil {
+		return err
+	}
+	meta.DisplayName = cal.DisplayName
+	meta.Description = cal.Description
+	meta.TimeZone = cal.TimeZone
+	meta.SupportedComponents = cal.SupportedComponents
+	meta.ACL = cal.ACL
+	return b.writeMeta(cal.Path, meta)
+}
+
+func (b *FSBackend) DeleteCalendar(p string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.readMeta(p); err != nil {
+		return err
+	}
+	delete(b.uids, p)
+	return os.RemoveAll(b.localPath(p))
+}
+
+func (b *FSBackend) Objects(calPath string) ([]Object, error) {
+	return b.query(calPath, func(icalendar.Component) bool { return true })
+}
+
+func (b *FSBackend) QueryObjects(calPath string, start, end time.Time) ([]Object, error) {
+	return b.query(calPath, func(data icalendar.Component) bool {
+		return mayOverlap(data, start, end)
+	})
+}
+
+func (b *FSBackend) query(calPath string, match func(icalendar.Component) bool) ([]Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if _, err := b.readMeta(calPath); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(b.localPath(calPath))
+	if err != nil {
+		return nil, err
+	}
+	var objs []Object
+	for _, entry := range entries {
+		if entry.IsDir() || !validObjectName(entry.Name()) {
+			continue
+		}
+		obj, err := b.object(calPath + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match(obj.Data) {
+			objs = append(objs, obj)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Path < objs[j].Path })
+	return objs, nil
+}
+
+func validObjectName(name string) bool {
+	return strings.HasSuffix(name, ".ics") && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, "/\\\n")
+}
+
+func (b *FSBackend) Object(p string) (Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !validObjectName(path.Base(p)) {
+		return Object{}, ErrNotFound
+	}
+	return b.object(p)
+}
+
+func (b *FSBackend) object(p string) (Object, error) {
+	local := b.localPath(p)
+	raw, err := os.ReadFile(local)
+	if notExist(err) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		return Object{}, err
+	}
+	return newObject(p, raw, info.ModTime())
+}
+
+// Returns the object at p, if it exists, for checking a Condition against.
+func (b *FSBackend) current(p string) (Object, bool, error) {
+	obj, err := b.object(p)
+	if errors.Is(err, ErrNotFound) {
+		return obj, false, nil
+	}
+	return obj, err == nil, err
+}
+
+func (b *FSBackend) PutObject(p string, data icalendar.Component, cond Condition) (Object, error) {
+	if !validObjectName(path.Base(p)) {
+		return Object{}, ErrForbidden
+	}
+	raw, err := encodeObject(data)
+	if err != nil {
+		return Object{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	calPath := parentPath(p)
+	if _, err := b.readMeta(calPath); err != nil {
+		return Object{}, err
+	}
+	current, exists, err := b.current(p)
+	if err != nil {
+		return Object{}, err
+	}
+	if !cond.Holds(current, exists) {
+		return Object{}, ErrPreconditionFailed
+	}
+	uids, err := b.uidIndex(calPath)
+	if err != nil {
+		return Object{}, err
+	}
+	uid := uidOf(data)
+	if err := uids.check(cond, uid, p); err != nil {
+		return Object{}, err
+	}
+	if err := writeFileAtomic(b.localPath(p), raw); err != nil {
+		return Object{}, err
+	}
+	if exists {
+		uids.remove(uidOf(current.Data), p)
+	}
+	uids.add(uid, p)
+	if err := b.touch(p, false); err != nil {
+		return Object{}, err
+	}
+	return b.object(p)
+}
+
+// Returns the UID index of a calendar, building it if this is the first
+// write to the calendar. Must be called with the write lock held.
+func (b *FSBackend) uidIndex(calPath string) (uidIndex, error) {
+	if idx, has := b.uids[calPath]; has {
+		return idx, nil
+	}
+	entries, err := os.ReadDir(b.localPath(calPath))
+	if err != nil {
+		return nil, err
+	}
+	idx := uidIndex{}
+	for _, entry := range entries {
+		if entry.IsDir() || !validObjectName(entry.Name()) {
+			continue
+		}
+		obj, err := b.object(calPath + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		idx.add(uidOf(obj.Data), obj.Path)
+	}
+	if b.uids == nil {
+		b.uids = make(map[string]uidIndex)
+	}
+	b.uids[calPath] = idx
+	return idx, nil
+}
+
+func (b *FSBackend) DeleteObject(p string, cond Condition) error {
+	if !validObjectName(path.Base(p)) {
+		return ErrNotFound
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current, exists, err := b.current(p)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	if !cond.Holds(current, exists) {
+		return ErrPreconditionFailed
+	}
+	if err := os.Remove(b.localPath(p)); err != nil {
+		return err
+	}
+	if idx, has := b.uids[parentPath(p)]; has {
+		idx.remove(uidOf(current.Data), p)
+	}
+	return b.touch(p, true)
+}
+
+func (b *FSBackend) ChangeToken(calPath string) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	meta, err := b.readMeta(calPath)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(meta.Token, 10), nil
+}
+
+func (b *FSBackend) Changes(calPath, since string) (changed, deleted []string, token string, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	meta, err := b.readMeta(calPath)
+	if err != nil {
+		return
+	}
+	token = strconv.FormatInt(meta.Token, 10)
+	if since == "" {
+		var entries []fs.DirEntry
+		if entries, err = os.ReadDir(b.localPath(calPath)); err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && validObjectName(entry.Name()) {
+				changed = append(changed, calPath+entry.Name())
+			}
+		}
+		return
+	}
+	n, perr := strconv.ParseInt(since, 10, 64)
+	if perr != nil || n < meta.Created || n > meta.Token {
+		err = ErrInvalidSyncToken
+		return
+	}
+	raw, err := os.ReadFile(filepath.Join(b.localPath(calPath), changeLogFile))
+	if notExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	state := make(map[string]bool) // whether each changed path ended up deleted
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if t, perr := strconv.ParseInt(fields[0], 10, 64); perr == nil && t > n {
+			state[calPath+fields[2]] = fields[1] == "D"
+		}
+	}
+	changed, deleted = splitChanges(state)
+	return
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package caldav
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testEvent = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:event-1@example.com\r\n" +
+	"DTSTAMP:20240101T000000Z\r\n" +
+	"DTSTART:20240101T090000Z\r\n" +
+	"DTEND:20240101T100000Z\r\n" +
+	"SUMMARY:Standup\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func do(t *testing.T, h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func Test_Handler(t *testing.T) {
+	testHandler(t, NewMemoryBackend())
+}
+
+func Test_Handler_FSBackend(t *testing.T) {
+	testHandler(t, NewFSBackend(t.TempDir()))
+}
+
+func testHandler(t *testing.T, b Backend) {
+	h := &Handler{Backend: b}
+
+	rec := do(t, h, "OPTIONS", "/", "")
+	if !strings.Contains(rec.Header().Get("DAV"), "calendar-access") {
+		t.Errorf("\nmissing calendar-access in DAV header: %#v\n", rec.Header())
+	}
+
+	rec = do(t, h, "MKCALENDAR", "/cal/work/", `<?xml version="1.0"?>
+<C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:set><D:prop>
+    <D:displayname>Work &amp; stuff</D:displayname>
+    <C:supported-calendar-component-set><C:comp name="VEVENT"/></C:supported-calendar-component-set>
+  </D:prop></D:set>
+</C:mkcalendar>`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("\nMKCALENDAR: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	if rec = do(t, h, "MKCALENDAR", "/cal/work/", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("\nMKCALENDAR on existing: expected 405, got %d\n", rec.Code)
+	}
+
+	rec = do(t, h, "PUT", "/cal/work/e1.ics", testEvent, "Content-Type", "text/calendar")
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") == "" {
+		t.Fatalf("\nPUT: expected 201 with ETag, got %d: %s\n", rec.Code, rec.Body)
+	}
+	if rec = do(t, h, "PUT", "/cal/work/e1.ics", testEvent); rec.Code != http.StatusNoContent {
+		t.Errorf("\nPUT over existing: expected 204, got %d\n", rec.Code)
+	}
+	if rec = do(t, h, "PUT", "/cal/home/e1.ics", testEvent); rec.Code != http.StatusConflict {
+		t.Errorf("\nPUT without collection: expected 409, got %d\n", rec.Code)
+	}
+	if rec = do(t, h, "PUT", "/cal/work/e2.ics", "BEGIN:VEVENT\r\n"); rec.Code != http.StatusBadRequest {
+		t.Errorf("\nPUT of garbage: expected 400, got %d\n", rec.Code)
+	}
+	if rec = do(t, h, "PUT", "/cal/work/e2.ics", testEvent, "Content-Type", "text/plain"); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("\nPUT of text/plain: expected 415, got %d\n", rec.Code)
+	}
+
+	rec = do(t, h, "GET", "/cal/work/e1.ics", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != testEvent {
+		t.Errorf("\nGET: expected the event back, got %d:\n%s\n", rec.Code, rec.Body)
+	}
+
+	rec = do(t, h, "PROPFIND", "/cal/work/", `<?xml version="1.0"?>
+<D:propfind xmlns:D="DAV:"><D:prop>
+  <D:displayname/><D:getetag/><D:resourcetype/><D:quota-used-bytes/>
+</D:prop></D:propfind>`, "Depth", "1")
+	body := rec.Body.String()
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("\nPROPFIND: expected 207, got %d\n", rec.Code)
+	}
+	for _, want := range []string{
+		"<href>/cal/work/</href>", "<href>/cal/work/e1.ics</href>",
+		"Work &amp; stuff", `<calendar xmlns="urn:ietf:params:xml:ns:caldav"/>`,
+		"HTTP/1.1 404 Not Found",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("\nPROPFIND response lacks %s:\n%s\n", want, body)
+		}
+	}
+	rec = do(t, h, "PROPFIND", "/cal/work/", "", "Depth", "0")
+	if strings.Contains(rec.Body.String(), "e1.ics") {
+		t.Errorf("\nDepth: 0 PROPFIND listed members:\n%s\n", rec.Body)
+	}
+	rec = do(t, h, "PROPFIND", "/cal/work/e1.ics", "", "Depth", "0")
+	if rec.Code != http.StatusMultiStatus || !strings.Contains(rec.Body.String(), "<href>/cal/work/e1.ics</href>") {
+		t.Errorf("\nPROPFIND of an object: expected 207, got %d:\n%s\n", rec.Code, rec.Body)
+	}
+
+	if rec = do(t, h, "DELETE", "/cal/work/e1.ics", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("\nDELETE: expected 204, got %d\n", rec.Code)
+	}
+	if rec = do(t, h, "GET", "/cal/work/e1.ics", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("\nGET after DELETE: expected 404, got %d\n", rec.Code)
+	}
+	if rec = do(t, h, "PATCH", "/cal/work/", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("\nPATCH: expected 405, got %d\n", rec.Code)
+	}
+}
+
+// A backend whose storage has failed.
+type failingBackend struct{ Backend }
+
+func (failingBackend) Calendar(p string) (Calendar, error) {
+	return Calendar{}, errors.New("open /srv/caldav" + p + ".calendar.json: input/output error")
+}
+
+func Test_serveError(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	h := &Handler{Backend: failingBackend{NewMemoryBackend()}}
+	rec := do(t, h, "GET", "/cal/e1.ics", "")
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "/srv") {
+		t.Errorf("\nGET with failing storage: expected a bare 500, got %d: %s\n", rec.Code, rec.Body)
+	}
+
+	h = &Handler{Backend: NewMemoryBackend(), Limits: Limits{MaxRequestSize: 64}}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/"})
+	body := `<propfind xmlns="DAV:"><prop><displayname/></prop></propfind>` + strings.Repeat(" ", 64)
+	for method, target := range map[string]string{
+		"PROPFIND": "/cal/", "REPORT": "/cal/", "MKCALENDAR": "/new/", "PUT": "/cal/e1.ics",
+	} {
+		if rec := do(t, h, method, target, body); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("\n%s of a large body: expected 413, got %d: %s\n", method, rec.Code, rec.Body)
+		}
+	}
+}
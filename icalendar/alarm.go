@@ -0,0 +1,272 @@
+package icalendar
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AlarmAction string
+
+const (
+	AAAudio   AlarmAction = "AUDIO"
+	AADisplay             = "DISPLAY"
+	AAEmail               = "EMAIL"
+	// X-* and IANA registered actions also allowed
+)
+
+// See RFC 9074 s. 8.1.
+type Proximity string
+
+const (
+	PXArrive     Proximity = "ARRIVE"
+	PXDepart               = "DEPART"
+	PXConnect              = "CONNECT"
+	PXDisconnect           = "DISCONNECT"
+)
+
+// A Trigger is either relative, in which case Offset is measured from the
+// start or end of the instance the alarm belongs to, or absolute, in which
+// case At is set and the other members are ignored.
+type Trigger struct {
+	Offset  Duration
+	Related AlarmTriggerRelationship
+	At      time.Time
+}
+
+func (t Trigger) Absolute() bool {
+	return !t.At.IsZero()
+}
+
+// An Alarm is a typed view of a VALARM component.
+type Alarm struct {
+	Action      AlarmAction
+	Trigger     Trigger
+	Repeat      int
+	Interval    Duration // the DURATION between repetitions
+	Description string
+	Summary     string
+	Attachments []Field
+	Attendees   []Attendee
+	// RFC 9074 extensions
+	UID          string
+	Acknowledged time.Time // zero if never acknowledged
+	SnoozeOf     string    // UID of the alarm this one snoozes, if any
+	DefaultAlarm bool
+	Proximity    Proximity
+}
+
+var (
+	notAnAlarm            = errors.New("Component is not a VALARM")
+	missingAction         = errors.New("VALARM has no ACTION")
+	missingTrigger        = errors.New("VALARM has no TRIGGER")
+	repeatWithoutDuration = errors.New("VALARM REPEAT and DURATION must appear together")
+	invalidRepeat         = errors.New("Invalid REPEAT value")
+	noAnchor              = errors.New("Component has no start or end to anchor the alarm")
+)
+
+func ParseAlarm(c Component) (a Alarm, err error) {
+	if !strings.EqualFold(c.Name, "VALARM") {
+		err = notAnAlarm
+		return
+	}
+	action, has := c.Field("ACTION")
+	if !has {
+		err = missingAction
+		return
+	}
+	a.Action = AlarmAction(strings.ToUpper(action.Value))
+	trigger, has := c.Field("TRIGGER")
+	if !has {
+		err = missingTrigger
+		return
+	}
+	if a.Trigger, err = parseTrigger(trigger); err != nil {
+		return
+	}
+	repeat, hasRepeat := c.Field("REPEAT")
+	duration, hasDuration := c.Field("DURATION")
+	if hasRepeat != hasDuration {
+		err = repeatWithoutDuration
+		return
+	}
+	if hasRepeat {
+		if a.Repeat, err = strconv.Atoi(repeat.Value); err != nil || a.Repeat < 0 {
+			err = invalidRepeat
+			return
+		}
+		if a.Interval, err = duration.Duration(); err != nil {
+			return
+		}
+	}
+	a.UID = c.Value("UID")
+	if ack, has := c.Field("ACKNOWLEDGED"); has {
+		if a.Acknowledged, err = ack.DateTime(); err != nil {
+			return
+		}
+	}
+	for _, rel := range c.FieldsNamed("RELATED-TO") {
+		if strings.EqualFold(string(rel.RelationshipType()), RTSnooze) {
+			a.SnoozeOf = rel.Value
+		}
+	}
+	a.DefaultAlarm = strings.EqualFold(c.Value("DEFAULT-ALARM"), "TRUE")
+	a.Proximity = Proximity(strings.ToUpper(c.Value("PROXIMITY")))
+	a.Description = c.Value("DESCRIPTION")
+	a.Summary = c.Value("SUMMARY")
+	a.Attachments = c.FieldsNamed("ATTACH")
+	for _, f := range c.FieldsNamed("ATTENDEE") {
+		var attendee Attendee
+		if attendee, err = ParseAttendee(f); err != nil {
+			return
+		}
+		a.Attendees = append(a.Attendees, attendee)
+	}
+	return
+}
+
+func parseTrigger(f Field) (t Trigger, err error) {
+	if f.DataType() == DTDateTime {
+		t.At, err = f.DateTime()
+		return
+	}
+	t.Related = f.AlarmTrigerRelationship()
+	t.Offset, err = f.Duration()
+	return
+}
+
+// Returns the times at which the alarm fires for an instance spanning start
+// to end, including repetitions.
+func (a Alarm) Times(start, end time.Time) []time.Time {
+	var first time.Time
+	switch {
+	case a.Trigger.Absolute():
+		first = a.Trigger.At
+	case a.Trigger.Related == ATREnd:
+		first = a.Trigger.Offset.From(end)
+	default:
+		first = a.Trigger.Offset.From(start)
+	}
+	times := []time.Time{first}
+	for i := 1; i <= a.Repeat; i++ {
+		times = append(times, a.Interval.From(times[i-1]))
+	}
+	return times
+}
+
+// An AlarmFiring records one point at which an alarm goes off. Instance is
+// the start of the recurrence instance the firing belongs to, and is zero for
+// alarms with absolute triggers.
+type AlarmFiring struct {
+	Alarm    Alarm
+	Instance time.Time
+	At       time.Time
+}
+
+// Computes when the alarms of a VEVENT or VTODO fire within [from, to).
+// instances holds the start times of the component's recurrence instances; if
+// it is empty the component's own DTSTART is used. Relative triggers are
+// measured from each instance's start, or from its end when RELATED=END, where
+// the end is derived from DTEND, DUE or DURATION. The result is sorted by
+// firing time.
+//
+// Firings at or before an alarm's ACKNOWLEDGED time are omitted, as are
+// PROXIMITY alarms, which are triggered by location rather than by time.
+func AlarmTimes(c Component, instances []time.Time, from, to time.Time) (firings []AlarmFiring, err error) {
+	var alarms []Alarm
+	for _, child := range c.ComponentsNamed("VALARM") {
+		var alarm Alarm
+		if alarm, err = ParseAlarm(child); err != nil {
+			return
+		}
+		alarms = append(alarms, alarm)
+	}
+	if len(alarms) == 0 {
+		return
+	}
+	start, length, hasStart, err := componentSpan(c, time.UTC)
+	if err != nil {
+		return
+	}
+	if len(instances) == 0 && hasStart {
+		instances = []time.Time{start}
+	}
+	inWindow := func(alarm Alarm, at time.Time) bool {
+		if !alarm.Acknowledged.IsZero() && !at.After(alarm.Acknowledged) {
+			return false
+		}
+		return !at.Before(from) && at.Before(to)
+	}
+	for _, alarm := range alarms {
+		if alarm.Proximity != "" {
+			continue
+		}
+		if alarm.Trigger.Absolute() {
+			for _, at := range alarm.Times(time.Time{}, time.Time{}) {
+				if inWindow(alarm, at) {
+					firings = append(firings, AlarmFiring{alarm, time.Time{}, at})
+				}
+			}
+			continue
+		}
+		if len(instances) == 0 {
+			err = noAnchor
+			return
+		}
+		for _, instance := range instances {
+			for _, at := range alarm.Times(instance, length.From(instance)) {
+				if inWindow(alarm, at) {
+					firings = append(firings, AlarmFiring{alarm, instance, at})
+				}
+			}
+		}
+	}
+	sort.SliceStable(firings, func(i, j int) bool {
+		return firings[i].At.Before(firings[j].At)
+	})
+	return
+}
+
+// Returns the start of a VEVENT or VTODO along with the length of each
+// instance. For a VTODO without DTSTART, the DUE time is reported as the start
+// and the length is zero. Events without DTEND or DURATION last one day when
+// they start on a DATE, and no time at all otherwise (RFC 5545 s. 3.6.1). A
+// length from DTEND or DUE is exact, and one from DURATION nominal, so that
+// each instance of a recurring component gets the kind of length the RFC
+// gives it (s. 3.8.5.3).
+// Floating times are read in the floating zone.
+func componentSpan(c Component, floating *time.Location) (start time.Time, length Duration, has bool, err error) {
+	dtstart, hasStart := c.Field("DTSTART")
+	if hasStart {
+		if start, err = dtstart.DateTimeIn(floating); err != nil {
+			return
+		}
+		has = true
+	}
+	if dur, hasDur := c.Field("DURATION"); hasDur {
+		length, err = dur.Duration()
+		return
+	}
+	endName := "DTEND"
+	if strings.EqualFold(c.Name, "VTODO") {
+		endName = "DUE"
+	}
+	if dtend, hasEnd := c.Field(endName); hasEnd {
+		var end time.Time
+		if end, err = dtend.DateTimeIn(floating); err != nil {
+			return
+		}
+		if !hasStart {
+			start, has = end, true
+			return
+		}
+		length.Time = end.Sub(start)
+		return
+	}
+	if hasStart && dtstart.IsDate() && !strings.EqualFold(c.Name, "VTODO") {
+		length.Days = 1
+	}
+	return
+}
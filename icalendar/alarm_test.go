@@ -0,0 +1,103 @@
+package icalendar
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func decodeString(t *testing.T, src string) Component {
+	c, err := NewDecoder(bytes.NewBufferString(src)).Decode()
+	if err != nil {
+		t.Fatalf("\nunexpected error decoding %#v:\n%s\n", src, err)
+	}
+	return c
+}
+
+func Test_AlarmTimes(t *testing.T) {
+	event := decodeString(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART:20240101T090000Z\r\n"+
+		"DTEND:20240101T100000Z\r\n"+
+		"BEGIN:VALARM\r\n"+
+		"ACTION:DISPLAY\r\n"+
+		"TRIGGER:-PT15M\r\n"+
+		"REPEAT:2\r\n"+
+		"DURATION:PT5M\r\n"+
+		"END:VALARM\r\n"+
+		"BEGIN:VALARM\r\n"+
+		"ACTION:AUDIO\r\n"+
+		"TRIGGER;RELATED=END:PT0S\r\n"+
+		"END:VALARM\r\n"+
+		"BEGIN:VALARM\r\n"+
+		"ACTION:EMAIL\r\n"+
+		"TRIGGER;VALUE=DATE-TIME:20240102T120000Z\r\n"+
+		"ATTENDEE:mailto:a@example.com\r\n"+
+		"END:VALARM\r\n"+
+		"END:VEVENT\r\n")
+	day := func(d, h, m int) time.Time {
+		return time.Date(2024, 1, d, h, m, 0, 0, time.UTC)
+	}
+	instances := []time.Time{day(1, 9, 0), day(2, 9, 0)}
+	firings, err := AlarmTimes(event, instances, day(1, 9, 0), day(3, 0, 0))
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	expected := []time.Time{
+		day(1, 10, 0),
+		day(2, 8, 45), day(2, 8, 50), day(2, 8, 55), day(2, 10, 0),
+		day(2, 12, 0),
+	}
+	if len(firings) != len(expected) {
+		t.Fatalf("\nexpected %d firings, got %d: %#v\n",
+			len(expected), len(firings), firings)
+	}
+	for i := range expected {
+		if !firings[i].At.Equal(expected[i]) {
+			t.Errorf("\nfiring %d:\nexpected: %s\ngot:      %s\n",
+				i, expected[i], firings[i].At)
+		}
+	}
+	if last := firings[len(firings)-1]; last.Alarm.Action != AAEmail ||
+		len(last.Alarm.Attendees) != 1 || !last.Instance.IsZero() {
+		t.Errorf("\nunexpected absolute firing: %#v\n", last)
+	}
+
+	// A day before 09:00 is 09:00 the day before, even across a DST change
+	event = decodeString(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART;TZID=America/New_York:20240310T090000\r\n"+
+		"DURATION:P1D\r\n"+
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-P1D\r\nEND:VALARM\r\n"+
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER;RELATED=END:PT0S\r\nEND:VALARM\r\n"+
+		"END:VEVENT\r\n")
+	ny, _ := time.LoadLocation("America/New_York")
+	firings, err = AlarmTimes(event, nil, day(1, 0, 0), day(31, 0, 0).AddDate(0, 3, 0))
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	expected = []time.Time{time.Date(2024, 3, 9, 9, 0, 0, 0, ny), time.Date(2024, 3, 11, 9, 0, 0, 0, ny)}
+	if len(firings) != len(expected) {
+		t.Fatalf("\nexpected %d firings, got %d: %#v\n", len(expected), len(firings), firings)
+	}
+	for i := range expected {
+		if !firings[i].At.Equal(expected[i]) {
+			t.Errorf("\nnominal firing %d:\nexpected: %s\ngot:      %s\n", i, expected[i], firings[i].At)
+		}
+	}
+}
+
+func Test_ParseAlarm(t *testing.T) {
+	testCases := map[string]error{
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT1H\r\nEND:VALARM\r\n":             nil,
+		"BEGIN:VALARM\r\nTRIGGER:-PT1H\r\nEND:VALARM\r\n":                               missingAction,
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nEND:VALARM\r\n":                              missingTrigger,
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT1H\r\nREPEAT:2\r\nEND:VALARM\r\n": repeatWithoutDuration,
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:soon\r\nEND:VALARM\r\n":              invalidDuration,
+		"BEGIN:VEVENT\r\nEND:VEVENT\r\n":                                                notAnAlarm,
+	}
+	for src, expectedErr := range testCases {
+		if _, err := ParseAlarm(decodeString(t, src)); err != expectedErr {
+			t.Errorf("\nerror mismatch in case %#v:\nexpected: %v\ngot:      %v\n",
+				src, expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package icalendar
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// An Attendee gathers the parameters of an ATTENDEE field alongside its
+// CAL-ADDRESS value. String and enumeration members are left empty when the
+// corresponding parameter is absent, so that converting back to a Field does
+// not introduce parameters that weren't there to begin with, and Rsvp is nil
+// for the same reason. Use the Field accessors if you want the RFC defaults
+// filled in.
+type Attendee struct {
+	Address     string
+	CommonName  string
+	UserType    UserType
+	Delegators  []string
+	Delegatees  []string
+	Members     []string
+	Role        ParticipantRole
+	Status      ParticipantStatus
+	Rsvp        *bool
+	SentBy      string
+	DirEntryRef string
+	Language    string
+	// Any parameters not listed above, preserved verbatim.
+	Params map[string][]string
+}
+
+// An Organizer gathers the parameters of an ORGANIZER field alongside its
+// CAL-ADDRESS value. See Attendee.
+type Organizer struct {
+	Address     string
+	CommonName  string
+	SentBy      string
+	DirEntryRef string
+	Language    string
+	Params      map[string][]string
+}
+
+var (
+	notAnAttendee  = errors.New("Field is not an ATTENDEE")
+	notAnOrganizer = errors.New("Field is not an ORGANIZER")
+)
+
+var attendeeParams = []string{
+	"CN", "CUTYPE", "DELEGATED-FROM", "DELEGATED-TO", "MEMBER", "ROLE",
+	"PARTSTAT", "RSVP", "SENT-BY", "DIR", "LANGUAGE",
+}
+
+var organizerParams = []string{"CN", "SENT-BY", "DIR", "LANGUAGE"}
+
+func ParseAttendee(f Field) (a Attendee, err error) {
+	if !strings.EqualFold(f.Name, "ATTENDEE") {
+		err = notAnAttendee
+		return
+	}
+	if err = f.validate(); err != nil {
+		return
+	}
+	a.Address = f.Value
+	a.CommonName = f.CommonName()
+	a.UserType = UserType(scalarParam(f, "CUTYPE"))
+	a.Delegators = listParam(f, "DELEGATED-FROM")
+	a.Delegatees = listParam(f, "DELEGATED-TO")
+	a.Members = listParam(f, "MEMBER")
+	a.Role = ParticipantRole(scalarParam(f, "ROLE"))
+	a.Status = ParticipantStatus(scalarParam(f, "PARTSTAT"))
+	if rsvp := scalarParam(f, "RSVP"); rsvp != "" {
+		a.Rsvp = new(bool)
+		*a.Rsvp = strings.EqualFold(rsvp, "TRUE")
+	}
+	a.SentBy = f.SentBy()
+	a.DirEntryRef = f.DirEntryRef()
+	a.Language = scalarParam(f, "LANGUAGE")
+	a.Params = otherParams(f, attendeeParams)
+	return
+}
+
+func ParseOrganizer(f Field) (o Organizer, err error) {
+	if !strings.EqualFold(f.Name, "ORGANIZER") {
+		err = notAnOrganizer
+		return
+	}
+	if err = f.validate(); err != nil {
+		return
+	}
+	o.Address = f.Value
+	o.CommonName = f.CommonName()
+	o.SentBy = f.SentBy()
+	o.DirEntryRef = f.DirEntryRef()
+	o.Language = scalarParam(f, "LANGUAGE")
+	o.Params = otherParams(f, organizerParams)
+	return
+}
+
+func (a Attendee) Field() Field {
+	f := Field{Name: "ATTENDEE", Params: copyParams(a.Params), Value: a.Address}
+	setScalarParam(f, "CN", a.CommonName)
+	setScalarParam(f, "CUTYPE", string(a.UserType))
+	setListParam(f, "DELEGATED-FROM", a.Delegators)
+	setListParam(f, "DELEGATED-TO", a.Delegatees)
+	setListParam(f, "MEMBER", a.Members)
+	setScalarParam(f, "ROLE", string(a.Role))
+	setScalarParam(f, "PARTSTAT", string(a.Status))
+	if a.Rsvp != nil {
+		f.Params["RSVP"] = []string{strings.ToUpper(strconv.FormatBool(*a.Rsvp))}
+	}
+	setScalarParam(f, "SENT-BY", a.SentBy)
+	setScalarParam(f, "DIR", a.DirEntryRef)
+	setScalarParam(f, "LANGUAGE", a.Language)
+	return f
+}
+
+func (o Organizer) Field() Field {
+	f := Field{Name: "ORGANIZER", Params: copyParams(o.Params), Value: o.Address}
+	setScalarParam(f, "CN", o.CommonName)
+	setScalarParam(f, "SENT-BY", o.SentBy)
+	setScalarParam(f, "DIR", o.DirEntryRef)
+	setScalarParam(f, "LANGUAGE", o.Language)
+	return f
+}
+
+// Reports whether the attendee is the calendar user at addr, comparing
+// addresses as NormalizeAddress does.
+func (a Attendee) Is(addr string) bool {
+	return SameAddress(a.Address, addr)
+}
+
+func (o Organizer) Is(addr string) bool {
+	return SameAddress(o.Address, addr)
+}
+
+// Returns a copy of the field with its PARTSTAT parameter replaced. All other
+// parameters are preserved, and the receiver's parameter map is not modified.
+func (f Field) WithParticipantStatus(status ParticipantStatus) Field {
+	f.Params = copyParams(f.Params)
+	f.Params["PARTSTAT"] = []string{string(status)}
+	return f
+}
+
+// Puts a CAL-ADDRESS into a form suitable for equality comparison. The URI
+// scheme is lowercased and percent-encoding is decoded. mailto: addresses are
+// lowercased entirely, since in practice mail systems treat them
+// case-insensitively and clients are inconsistent about it.
+func NormalizeAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	colon := strings.IndexByte(addr, ':')
+	if colon < 0 {
+		return addr
+	}
+	scheme := strings.ToLower(addr[:colon])
+	rest := addr[colon+1:]
+	if unescaped, err := url.PathUnescape(rest); err == nil {
+		rest = unescaped
+	}
+	if scheme == "mailto" {
+		rest = strings.ToLower(rest)
+	}
+	return scheme + ":" + rest
+}
+
+func SameAddress(a, b string) bool {
+	return NormalizeAddress(a) == NormalizeAddress(b)
+}
+
+func scalarParam(f Field, name string) string {
+	if val, has := f.Params[name]; has && len(val) == 1 {
+		return val[0]
+	}
+	return ""
+}
+
+func listParam(f Field, name string) []string {
+	return append([]string(nil), f.Params[name]...)
+}
+
+func setScalarParam(f Field, name, val string) {
+	if val != "" {
+		f.Params[name] = []string{val}
+	}
+}
+
+func setListParam(f Field, name string, vals []string) {
+	if len(vals) > 0 {
+		f.Params[name] = append([]string(nil), vals...)
+	}
+}
+
+func otherParams(f Field, known []string) map[string][]string {
+	params := copyParams(f.Params)
+	for _, name := range known {
+		delete(params, name)
+	}
+	return params
+}
+
+func copyParams(params map[string][]string) map[string][]string {
+	cp := make(map[string][]string, len(params))
+	for k, v := range params {
+		cp[k] = append([]string(nil), v...)
+	}
+	return cp
+}
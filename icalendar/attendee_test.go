@@ -0,0 +1,102 @@
+package icalendar
+
+import (
+	"testing"
+)
+
+func Test_ParseAttendee(t *testing.T) {
+	src := "ATTENDEE;ROLE=CHAIR;PARTSTAT=ACCEPTED;CN=\"Jane Doe\";" +
+		"DELEGATED-TO=\"mailto:jdoe@example.com\";X-FOO=bar:mailto:JANE@example.com"
+	field, err := readField([]byte(src))
+	if err != nil {
+		t.Fatalf("\nparsing error: %s\n", err)
+	}
+	a, err := ParseAttendee(field)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if a.Role != PRChair || a.Status != PSAccepted || a.CommonName != "Jane Doe" {
+		t.Errorf("\nparameters not gathered: %#v\n", a)
+	}
+	if a.UserType != "" || a.Rsvp != nil {
+		t.Errorf("\nabsent parameters should be left empty: %#v\n", a)
+	}
+	if len(a.Delegatees) != 1 || a.Delegatees[0] != "mailto:jdoe@example.com" {
+		t.Errorf("\ndelegatees mismatch: %#v\n", a.Delegatees)
+	}
+	if len(a.Params) != 1 || a.Params["X-FOO"][0] != "bar" {
+		t.Errorf("\nunknown parameters not preserved: %#v\n", a.Params)
+	}
+	if !fieldEq(a.Field(), field) {
+		t.Errorf("\nround trip mismatch:\nexpected: %#v\ngot:      %#v\n",
+			field, a.Field())
+	}
+	a.Delegatees[0] = "mailto:other@example.com"
+	if field.Params["DELEGATED-TO"][0] != "mailto:jdoe@example.com" {
+		t.Errorf("\nmodifying the attendee modified the field: %#v\n", field.Params)
+	}
+	b := a.Field()
+	b.Params["DELEGATED-TO"][0] = "mailto:jdoe@example.com"
+	if a.Delegatees[0] != "mailto:other@example.com" {
+		t.Errorf("\nmodifying the field modified the attendee: %#v\n", a.Delegatees)
+	}
+
+	field, _ = readField([]byte("ATTENDEE;RSVP=FALSE:mailto:bob@example.com"))
+	if a, _ = ParseAttendee(field); a.Rsvp == nil || *a.Rsvp {
+		t.Errorf("\nexplicit RSVP=FALSE not kept: %#v\n", a.Rsvp)
+	}
+	if !fieldEq(a.Field(), field) {
+		t.Errorf("\nround trip mismatch:\nexpected: %#v\ngot:      %#v\n",
+			field, a.Field())
+	}
+	if _, err := ParseAttendee(Field{Name: "ORGANIZER", Value: "mailto:a@b"}); err != notAnAttendee {
+		t.Errorf("\nexpected notAnAttendee, got %s\n", err)
+	}
+}
+
+func Test_ParseOrganizer(t *testing.T) {
+	field, _ := readField([]byte(
+		"ORGANIZER;CN=John;SENT-BY=\"mailto:sray@example.com\":mailto:jsmith@example.com"))
+	o, err := ParseOrganizer(field)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if o.SentBy != "mailto:sray@example.com" || o.CommonName != "John" {
+		t.Errorf("\nparameters not gathered: %#v\n", o)
+	}
+	if !fieldEq(o.Field(), field) {
+		t.Errorf("\nround trip mismatch:\nexpected: %#v\ngot:      %#v\n",
+			field, o.Field())
+	}
+}
+
+func Test_WithParticipantStatus(t *testing.T) {
+	field, _ := readField([]byte(
+		"ATTENDEE;RSVP=TRUE;PARTSTAT=NEEDS-ACTION;ROLE=OPT-PARTICIPANT:mailto:a@example.com"))
+	updated := field.WithParticipantStatus(PSDeclined)
+	if updated.ParticipantStatus() != PSDeclined {
+		t.Errorf("\nexpected DECLINED, got %s\n", updated.ParticipantStatus())
+	}
+	if field.ParticipantStatus() != PSNeedsAction {
+		t.Errorf("\noriginal field was modified\n")
+	}
+	if !updated.Rsvp() || updated.ParticipantRole() != PROptParticipant {
+		t.Errorf("\nother parameters not preserved: %#v\n", updated.Params)
+	}
+}
+
+func Test_SameAddress(t *testing.T) {
+	testCases := map[[2]string]bool{
+		{"mailto:jsmith@example.com", "MAILTO:JSmith@Example.com"}:     true,
+		{"mailto:j%20smith@example.com", "mailto:j smith@example.com"}: true,
+		{"mailto:jsmith@example.com", "mailto:jdoe@example.com"}:       false,
+		{"HTTP://example.com/Users/A", "http://example.com/Users/A"}:   true,
+		{"http://example.com/Users/A", "http://example.com/users/a"}:   false,
+	}
+	for testCase, expected := range testCases {
+		if got := SameAddress(testCase[0], testCase[1]); got != expected {
+			t.Errorf("\nin case %#v:\nexpected: %t\ngot:      %t\n",
+				testCase, expected, got)
+		}
+	}
+}
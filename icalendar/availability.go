@@ -0,0 +1,156 @@
+package icalendar
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A VAvailability is a typed view of a VAVAILABILITY component, see RFC 7953.
+// Within [Start, End) the calendar user is busy with BusyType, except during
+// the instances of the AVAILABLE subcomponents. A zero Start or End leaves
+// that side unbounded. Priority runs from 1 (highest) to 9 (lowest), with 0
+// meaning undefined and ranking below 9.
+type VAvailability struct {
+	UID       string
+	Start     time.Time
+	End       time.Time
+	BusyType  FreeBusyType
+	Priority  int
+	Available []Component
+}
+
+var (
+	notAnAvailability = errors.New("Component is not a VAVAILABILITY")
+	invalidPriority   = errors.New("Invalid PRIORITY value")
+)
+
+func ParseVAvailability(c Component) (a VAvailability, err error) {
+	if !strings.EqualFold(c.Name, "VAVAILABILITY") {
+		err = notAnAvailability
+		return
+	}
+	a.UID = c.Value("UID")
+	a.BusyType = FBBusyUnavailable
+	if bt, has := c.Field("BUSYTYPE"); has {
+		a.BusyType = FreeBusyType(strings.ToUpper(bt.Value))
+	}
+	if p, has := c.Field("PRIORITY"); has {
+		if a.Priority, err = strconv.Atoi(p.Value); err != nil || a.Priority < 0 || a.Priority > 9 {
+			err = invalidPriority
+			return
+		}
+	}
+	start, length, hasStart, err := componentSpan(c, time.UTC)
+	if err != nil {
+		return
+	}
+	if hasStart {
+		a.Start = start
+		_, hasEnd := c.Field("DTEND")
+		_, hasDur := c.Field("DURATION")
+		if hasEnd || hasDur {
+			a.End = length.From(start)
+		}
+	} else if dtend, hasEnd := c.Field("DTEND"); hasEnd {
+		if a.End, err = dtend.DateTime(); err != nil {
+			return
+		}
+	}
+	a.Available = c.ComponentsNamed("AVAILABLE")
+	return
+}
+
+// Returns the time in [from, to) that the availability components found in a
+// set of VCALENDARs mark as busy, keyed by BUSYTYPE. Components are applied
+// from lowest to highest priority, each one overriding whatever lower priority
+// components said about the time it covers (RFC 7953 s. 4).
+func Unavailability(cals []Component, from, to time.Time) (map[FreeBusyType][]Period, error) {
+	var avails []VAvailability
+	for _, cal := range cals {
+		for _, c := range cal.ComponentsNamed("VAVAILABILITY") {
+			a, err := ParseVAvailability(c)
+			if err != nil {
+				return nil, err
+			}
+			avails = append(avails, a)
+		}
+	}
+	rank := func(priority int) int {
+		if priority == 0 {
+			return 10
+		}
+		return priority
+	}
+	sort.SliceStable(avails, func(i, j int) bool {
+		return rank(avails[i].Priority) > rank(avails[j].Priority)
+	})
+	var timeline []fbSegment
+	for _, a := range avails {
+		span := Period{from, to}
+		if !a.Start.IsZero() && a.Start.After(span.Start) {
+			span.Start = a.Start
+		}
+		if !a.End.IsZero() && a.End.Before(span.End) {
+			span.End = a.End
+		}
+		if !span.End.After(span.Start) {
+			continue
+		}
+		timeline = paint(timeline, fbSegment{span, a.BusyType})
+		instances, err := CalendarInstances(Component{Components: a.Available}, "AVAILABLE", span.Start, span.End)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range instances {
+			p := Period{inst.Start, inst.End}
+			if p.Start.Before(span.Start) {
+				p.Start = span.Start
+			}
+			if p.End.After(span.End) {
+				p.End = span.End
+			}
+			timeline = paint(timeline, fbSegment{p, FBFree})
+		}
+	}
+	busy := make(map[FreeBusyType][]Period)
+	for _, seg := range timeline {
+		if seg.fbtype != FBFree {
+			busy[seg.fbtype] = append(busy[seg.fbtype], seg.Period)
+		}
+	}
+	for fbtype, periods := range busy {
+		busy[fbtype] = MergePeriods(periods)
+	}
+	return busy, nil
+}
+
+type fbSegment struct {
+	Period
+	fbtype FreeBusyType
+}
+
+// Lays seg over the timeline, trimming or splitting whatever it covers.
+func paint(timeline []fbSegment, seg fbSegment) []fbSegment {
+	if !seg.End.After(seg.Start) {
+		return timeline
+	}
+	var out []fbSegment
+	for _, old := range timeline {
+		if !old.End.After(seg.Start) || !old.Start.Before(seg.End) {
+			out = append(out, old)
+			continue
+		}
+		if old.Start.Before(seg.Start) {
+			out = append(out, fbSegment{Period{old.Start, seg.Start}, old.fbtype})
+		}
+		if old.End.After(seg.End) {
+			out = append(out, fbSegment{Period{seg.End, old.End}, old.fbtype})
+		}
+	}
+	out = append(out, seg)
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
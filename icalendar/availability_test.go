@@ -0,0 +1,80 @@
+package icalendar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Unavailability(t *testing.T) {
+	cal := decodeString(t, "BEGIN:VCALENDAR\r\n"+
+		// Working hours are 9-17 on weekdays
+		"BEGIN:VAVAILABILITY\r\n"+
+		"UID:hours\r\n"+
+		"DTSTART:20240101T000000Z\r\n"+
+		"BEGIN:AVAILABLE\r\n"+
+		"UID:weekdays\r\n"+
+		"DTSTART:20240101T090000Z\r\n"+
+		"DTEND:20240101T170000Z\r\n"+
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR\r\n"+
+		"END:AVAILABLE\r\n"+
+		"END:VAVAILABILITY\r\n"+
+		// except on Tuesday, which is tentatively taken up by travel, save for
+		// a window in the afternoon
+		"BEGIN:VAVAILABILITY\r\n"+
+		"UID:travel\r\n"+
+		"PRIORITY:1\r\n"+
+		"BUSYTYPE:BUSY-TENTATIVE\r\n"+
+		"DTSTART:20240102T000000Z\r\n"+
+		"DTEND:20240103T000000Z\r\n"+
+		"BEGIN:AVAILABLE\r\n"+
+		"UID:layover\r\n"+
+		"DTSTART:20240102T140000Z\r\n"+
+		"DURATION:PT1H\r\n"+
+		"END:AVAILABLE\r\n"+
+		"END:VAVAILABILITY\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:standup\r\n"+
+		"DTSTART:20240101T093000Z\r\n"+
+		"DTEND:20240101T100000Z\r\n"+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	busy, err := FreeBusy([]Component{cal}, from, to)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	expected := []string{
+		"BUSY:20240101T093000Z/20240101T100000Z",
+		"BUSY-TENTATIVE:20240102T000000Z/20240102T140000Z,20240102T150000Z/20240103T000000Z",
+		"BUSY-UNAVAILABLE:20240101T000000Z/20240101T090000Z,20240101T170000Z/20240102T000000Z",
+	}
+	fields := FreeBusyFields(busy)
+	if len(fields) != len(expected) {
+		t.Fatalf("\nexpected %d fields, got %#v\n", len(expected), fields)
+	}
+	for i, field := range fields {
+		if got := string(field.FreeBusyType()) + ":" + field.Value; got != expected[i] {
+			t.Errorf("\nexpected: %s\ngot:      %s\n", expected[i], got)
+		}
+	}
+}
+
+func Test_ParseVAvailability(t *testing.T) {
+	testCases := map[string]error{
+		"BEGIN:VAVAILABILITY\r\nPRIORITY:5\r\nEND:VAVAILABILITY\r\n":  nil,
+		"BEGIN:VAVAILABILITY\r\nPRIORITY:10\r\nEND:VAVAILABILITY\r\n": invalidPriority,
+		"BEGIN:VAVAILABILITY\r\nPRIORITY:hi\r\nEND:VAVAILABILITY\r\n": invalidPriority,
+		"BEGIN:AVAILABLE\r\nEND:AVAILABLE\r\n":                        notAnAvailability,
+	}
+	for src, expectedErr := range testCases {
+		if _, err := ParseVAvailability(decodeString(t, src)); err != expectedErr {
+			t.Errorf("\nerror mismatch in case %#v:\nexpected: %v\ngot:      %v\n",
+				src, expectedErr, err)
+		}
+	}
+	a, _ := ParseVAvailability(decodeString(t, "BEGIN:VAVAILABILITY\r\nEND:VAVAILABILITY\r\n"))
+	if a.BusyType != FBBusyUnavailable || !a.Start.IsZero() || !a.End.IsZero() {
+		t.Errorf("\nunexpected defaults: %#v\n", a)
+	}
+}
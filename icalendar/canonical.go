@@ -0,0 +1,125 @@
+package icalendar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Parameters whose values are enumerations, compared case-insensitively.
+var enumParams = map[string]bool{
+	"CUTYPE": true, "ENCODING": true, "FBTYPE": true, "PARTSTAT": true, "RANGE": true,
+	"RELATED": true, "RELTYPE": true, "ROLE": true, "RSVP": true, "VALUE": true,
+}
+
+// Properties holding a single TEXT value, whose escaping can be redone from
+// scratch. Lists such as CATEGORIES can't, since there an unescaped comma
+// separates values.
+var textFields = map[string]bool{
+	"COMMENT": true, "CONTACT": true, "DESCRIPTION": true, "LOCATION": true,
+	"SUMMARY": true, "TZNAME": true, "UID": true,
+}
+
+// Properties holding DATE-TIMEs, or lists of them.
+var timeFields = map[string]bool{
+	"COMPLETED": true, "CREATED": true, "DTEND": true, "DTSTAMP": true, "DTSTART": true,
+	"DUE": true, "EXDATE": true, "LAST-MODIFIED": true, "RDATE": true, "RECURRENCE-ID": true,
+}
+
+// Zone names that always mean UTC, so that local times in them can be written
+// as UTC times without losing anything.
+var utcZones = map[string]bool{
+	"UTC": true, "ETC/UTC": true, "GMT": true, "ETC/GMT": true, "Z": true, "ZULU": true,
+	"UNIVERSAL": true, "ETC/UNIVERSAL": true,
+}
+
+// Returns the field in canonical form, equal for all spellings of the same
+// property: names and enumerated parameter values upper-cased, parameter
+// values in sorted order, TEXT escaped the same way, the parts of a RECUR in
+// sorted order after FREQ, and times in a zone that is UTC by another name
+// written as UTC times. The String of a canonical field, which sorts
+// parameters, is the canonical serialization.
+func (f Field) Canonical() Field {
+	out := Field{Name: strings.ToUpper(f.Name), Value: f.Value}
+	if len(f.Params) > 0 {
+		out.Params = make(map[string][]string, len(f.Params))
+		for name, vals := range f.Params {
+			name = strings.ToUpper(name)
+			for _, val := range vals {
+				if enumParams[name] {
+					val = strings.ToUpper(val)
+				}
+				out.Params[name] = append(out.Params[name], val)
+			}
+			sort.Strings(out.Params[name])
+		}
+	}
+	switch {
+	case textFields[out.Name] && out.DataType() == DTText:
+		out.Value = escapeText(out.Text())
+	case timeFields[out.Name] && len(out.Params["TZID"]) == 1 && utcZones[strings.ToUpper(out.Params["TZID"][0])]:
+		vals := strings.Split(out.Value, ",")
+		for i, val := range vals {
+			if len(val) == len(dateTimeLayout) {
+				vals[i] = val + "Z"
+			}
+		}
+		out.Value = strings.Join(vals, ",")
+		delete(out.Params, "TZID")
+	case out.DataType() == DTRecur:
+		parts := strings.Split(out.Value, ";")
+		sort.SliceStable(parts, func(i, j int) bool {
+			return strings.HasPrefix(parts[i], "FREQ=") && !strings.HasPrefix(parts[j], "FREQ=") ||
+				!strings.HasPrefix(parts[j], "FREQ=") && parts[i] < parts[j]
+		})
+		out.Value = strings.Join(parts, ";")
+	}
+	if len(out.Params) == 0 {
+		out.Params = nil
+	}
+	return out
+}
+
+// Returns the component in canonical form: its name upper-cased, its fields
+// canonical and, since their order carries no meaning, sorted, and likewise
+// its nested components.
+func (c Component) Canonical() Component {
+	out := Component{Name: strings.ToUpper(c.Name)}
+	for _, f := range c.Fields {
+		out.Fields = append(out.Fields, f.Canonical())
+	}
+	sort.SliceStable(out.Fields, func(i, j int) bool {
+		return out.Fields[i].String() < out.Fields[j].String()
+	})
+	for _, child := range c.Components {
+		out.Components = append(out.Components, child.Canonical())
+	}
+	sort.SliceStable(out.Components, func(i, j int) bool {
+		return componentText(out.Components[i]) < componentText(out.Components[j])
+	})
+	return out
+}
+
+// Returns a stable hash of the field's canonical serialization, equal for
+// fields that differ only in spelling.
+func (f Field) Hash() string {
+	return hashString(f.Canonical().String())
+}
+
+// Returns a stable hash of the component's canonical serialization, equal for
+// components, such as whole calendars, that differ only in spelling and in
+// the order of their contents.
+func (c Component) Hash() string {
+	return hashString(componentText(c.Canonical()))
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Escapes TEXT, see RFC 5545 s. 3.3.11.
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\n", `\n`).Replace(text)
+}
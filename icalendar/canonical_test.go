@@ -0,0 +1,54 @@
+package icalendar
+
+import (
+	"testing"
+)
+
+func Test_Canonical(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"summary;language=en:Lunch\\, maybe", "SUMMARY;LANGUAGE=en:Lunch\\, maybe", true},
+		{"SUMMARY:Lunch, maybe", "SUMMARY:Lunch\\, maybe", true},
+		{"DESCRIPTION:Line\\Nbreak", "DESCRIPTION:Line\\nbreak", true},
+		{"ATTENDEE;RSVP=true;PARTSTAT=accepted:mailto:bob@example.com",
+			"ATTENDEE;PARTSTAT=ACCEPTED;RSVP=TRUE:mailto:bob@example.com", true},
+		{"ATTENDEE;MEMBER=\"mailto:b@example.com\",\"mailto:a@example.com\":mailto:bob@example.com",
+			"ATTENDEE;MEMBER=\"mailto:a@example.com\",\"mailto:b@example.com\":mailto:bob@example.com", true},
+		{"DTSTART;TZID=Etc/UTC:20240101T090000", "DTSTART:20240101T090000Z", true},
+		{"EXDATE;TZID=UTC:20240101T090000,20240102T090000", "EXDATE:20240101T090000Z,20240102T090000Z", true},
+		{"DTSTART;TZID=Europe/Paris:20240101T090000", "DTSTART:20240101T080000Z", false},
+		{"CATEGORIES:a,b", "CATEGORIES:a\\,b", false},
+		{"SUMMARY:Lunch", "SUMMARY:lunch", false},
+		{"RRULE:COUNT=5;FREQ=DAILY;BYHOUR=9", "RRULE:FREQ=DAILY;BYHOUR=9;COUNT=5", true},
+	}
+	for _, test := range tests {
+		a, errA := readField([]byte(test.a))
+		b, errB := readField([]byte(test.b))
+		if errA != nil || errB != nil {
+			t.Fatalf("\nunexpected error: %v %v\n", errA, errB)
+		}
+		if (a.Hash() == b.Hash()) != test.same {
+			t.Errorf("\n%s\n%s\nexpected same: %v\ngot:      %s\n          %s\n", test.a, test.b, test.same,
+				a.Canonical(), b.Canonical())
+		}
+	}
+
+	cal := decodeString(t, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Test//EN\r\n"+
+		"BEGIN:VEVENT\r\nUID:m1\r\nSUMMARY:Planning\r\nDTSTART;TZID=UTC:20240101T090000\r\nEND:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\nUID:m2\r\nSUMMARY:Lunch\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	reordered := decodeString(t, "begin:vcalendar\r\nprodid:-//Example//Test//EN\r\nversion:2.0\r\n"+
+		"BEGIN:VEVENT\r\nSUMMARY:Lunch\r\nUID:m2\r\nEND:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\nDTSTART:20240101T090000Z\r\nSUMMARY:Plan\r\n ning\r\nUID:m1\r\nEND:VEVENT\r\nend:vcalendar\r\n")
+	if cal.Hash() != reordered.Hash() {
+		t.Errorf("\nexpected equal hashes:\n%#v\n%#v\n", cal.Canonical(), reordered.Canonical())
+	}
+	reordered.Components[0].SetField(Field{Name: "SUMMARY", Value: "Dinner"})
+	if cal.Hash() == reordered.Hash() {
+		t.Errorf("\nexpected different hashes after a change\n")
+	}
+	if c := cal.Canonical(); c.Components[0].Value("UID") != "m1" || c.Fields[0].Name != "PRODID" {
+		t.Errorf("\nunexpected canonical order: %#v\n", c)
+	}
+}
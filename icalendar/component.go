@@ -0,0 +1,205 @@
+package icalendar
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// A Component is a BEGIN/END delimited block such as VCALENDAR, VEVENT or
+// VALARM, holding its fields in the order they appeared and any nested
+// components.
+type Component struct {
+	Name       string
+	Fields     []Field
+	Components []Component
+}
+
+var (
+	expectedBegin         = errors.New("Expected BEGIN field at start of component")
+	mismatchedEnd         = errors.New("END field does not match the open component")
+	unterminatedComponent = errors.New("Unexpected end of input inside component")
+)
+
+type Decoder struct {
+	iter fieldIter
+}
+
+func NewDecoder(src io.Reader) *Decoder {
+	return &Decoder{newfieldIter(src)}
+}
+
+// Reads the next top-level component from the input. Returns io.EOF when
+// there are no more components.
+func (d *Decoder) Decode() (c Component, err error) {
+	var field Field
+	field, err = d.next()
+	if err != nil {
+		return
+	}
+	if !strings.EqualFold(field.Name, "BEGIN") {
+		err = expectedBegin
+		return
+	}
+	return d.readComponent(strings.ToUpper(field.Value))
+}
+
+func (d *Decoder) next() (field Field, err error) {
+	field, err = d.iter.nextField()
+	if err == endOfFields {
+		err = io.EOF
+	}
+	return
+}
+
+func (d *Decoder) readComponent(name string) (c Component, err error) {
+	c.Name = name
+	for {
+		var field Field
+		field, err = d.next()
+		if err == io.EOF {
+			err = unterminatedComponent
+			return
+		}
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.EqualFold(field.Name, "BEGIN"):
+			var child Component
+			child, err = d.readComponent(strings.ToUpper(field.Value))
+			if err != nil {
+				return
+			}
+			c.Components = append(c.Components, child)
+		case strings.EqualFold(field.Name, "END"):
+			if !strings.EqualFold(field.Value, name) {
+				err = mismatchedEnd
+			}
+			return
+		default:
+			c.Fields = append(c.Fields, field)
+		}
+	}
+}
+
+// Returns the first field with the given name. Field names are compared
+// case-insensitively.
+func (c Component) Field(name string) (Field, bool) {
+	for _, f := range c.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (c Component) FieldsNamed(name string) []Field {
+	var fields []Field
+	for _, f := range c.Fields {
+		if strings.EqualFold(f.Name, name) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func (c Component) ComponentsNamed(name string) []Component {
+	var comps []Component
+	for _, child := range c.Components {
+		if strings.EqualFold(child.Name, name) {
+			comps = append(comps, child)
+		}
+	}
+	return comps
+}
+
+// Returns the value of the first field with the given name, or the empty
+// string if there is none.
+func (c Component) Value(name string) string {
+	f, _ := c.Field(name)
+	return f.Value
+}
+
+// Replaces the fields named f.Name with f, keeping the position of the first
+// one, or appends f if there is none. Like RemoveFields, this never writes to
+// the existing Fields slice, so copies of the component are unaffected.
+func (c *Component) SetField(f Field) {
+	var fields []Field
+	replaced := false
+	for _, old := range c.Fields {
+		if !strings.EqualFold(old.Name, f.Name) {
+			fields = append(fields, old)
+		} else if !replaced {
+			fields = append(fields, f)
+			replaced = true
+		}
+	}
+	if !replaced {
+		fields = append(fields, f)
+	}
+	c.Fields = fields
+}
+
+func (c *Component) RemoveFields(name string) {
+	var fields []Field
+	for _, f := range c.Fields {
+		if !strings.EqualFold(f.Name, name) {
+			fields = append(fields, f)
+		}
+	}
+	c.Fields = fields
+}
+
+var (
+	missingVersion = errors.New("VCALENDAR must have VERSION:2.0")
+	missingProdID  = errors.New("VCALENDAR must have a PRODID")
+)
+
+// Fields whose values must parse as a DATE or DATE-TIME.
+var dateTimeFields = []string{
+	"DTSTART", "DTEND", "DUE", "RECURRENCE-ID", "COMPLETED", "CREATED",
+	"DTSTAMP", "LAST-MODIFIED",
+}
+
+// Checks a component and everything nested in it for the errors the package
+// knows how to detect: malformed parameters, unparseable dates, durations and
+// recurrence rules, and a VCALENDAR without VERSION or PRODID.
+func (c Component) Validate() error {
+	if c.Name == "VCALENDAR" {
+		if c.Value("VERSION") != "2.0" {
+			return missingVersion
+		}
+		if c.Value("PRODID") == "" {
+			return missingProdID
+		}
+	}
+	for _, f := range c.Fields {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+	for _, name := range dateTimeFields {
+		for _, f := range c.FieldsNamed(name) {
+			if _, err := f.DateTime(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range c.FieldsNamed("DURATION") {
+		if _, err := f.Duration(); err != nil {
+			return err
+		}
+	}
+	for _, f := range c.FieldsNamed("RRULE") {
+		if _, err := ParseRecur(f.Value); err != nil {
+			return err
+		}
+	}
+	for _, child := range c.Components {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
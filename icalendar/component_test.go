@@ -0,0 +1,90 @@
+package icalendar
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_Decode(t *testing.T) {
+	src := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1@example.com\r\n" +
+		"SUMMARY:Lunch\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"TRIGGER:-PT15M\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	dec := NewDecoder(bytes.NewBufferString(src))
+	cal, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if cal.Name != "VCALENDAR" || cal.Value("VERSION") != "2.0" {
+		t.Errorf("\nunexpected calendar: %#v\n", cal)
+	}
+	events := cal.ComponentsNamed("VEVENT")
+	if len(events) != 1 || events[0].Value("summary") != "Lunch" {
+		t.Fatalf("\nunexpected events: %#v\n", events)
+	}
+	if alarms := events[0].ComponentsNamed("VALARM"); len(alarms) != 1 {
+		t.Errorf("\nunexpected alarms: %#v\n", alarms)
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("\nexpected EOF, got %s\n", err)
+	}
+
+	errCases := map[string]error{
+		"VERSION:2.0\r\n":                                expectedBegin,
+		"BEGIN:VEVENT\r\nUID:1\r\n":                      unterminatedComponent,
+		"BEGIN:VEVENT\r\nUID:1\r\nEND:VTODO\r\n":         mismatchedEnd,
+		"BEGIN:VEVENT\r\nBEGIN:VALARM\r\nEND:VEVENT\r\n": mismatchedEnd,
+	}
+	for src, expectedErr := range errCases {
+		if _, err := NewDecoder(bytes.NewBufferString(src)).Decode(); err != expectedErr {
+			t.Errorf("\nerror mismatch in case %#v:\nexpected: %s\ngot:      %s\n",
+				src, expectedErr, err)
+		}
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	const valid = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//Example//Test//EN\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1@example.com\r\n" +
+		"DTSTAMP:20240101T000000Z\r\n" +
+		"DTSTART;TZID=Europe/Paris:20240101T090000\r\n" +
+		"DURATION:PT1H\r\n" +
+		"RRULE:FREQ=WEEKLY;COUNT=3\r\n" +
+		"ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	tests := []struct {
+		from, to string
+		err      error
+	}{
+		{"", "", nil},
+		{"VERSION:2.0", "VERSION:1.0", missingVersion},
+		{"PRODID:-//Example//Test//EN\r\n", "", missingProdID},
+		{"20240101T090000\r\n", "20240101T0900\r\n", invalidDateTime},
+		{"PT1H", "1H", invalidDuration},
+		{"PARTSTAT=ACCEPTED", "PARTSTAT=ACCEPTED,DECLINED", expectedScalar},
+		{"FREQ=WEEKLY", "FREQ=SOMETIMES", invalidRecur},
+	}
+	for _, test := range tests {
+		src := strings.Replace(valid, test.from, test.to, 1)
+		cal, err := NewDecoder(bytes.NewBufferString(src)).Decode()
+		if err != nil {
+			t.Fatalf("\nunexpected error decoding %#v:\n%s\n", src, err)
+		}
+		if err := cal.Validate(); err != test.err {
+			t.Errorf("\nvalidating with %s replaced by %s:\nexpected: %v\ngot:      %v\n", test.from, test.to, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package icalendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// What a Change did.
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+// A Change is a difference Diff found between two versions of a component.
+// Path holds the keys of the components leading to it, from the outermost,
+// as for a Conflict. When Property is empty the change is to the whole
+// component at Path, which Component holds: added or removed. Otherwise it is
+// to a property, with Address telling which attendee for ATTENDEE, or to one
+// parameter of the property when Param is set. Old and New are the values
+// before and after, empty for what didn't exist.
+type Change struct {
+	Kind      ChangeKind
+	Path      []string
+	Component Component
+	Property  string
+	Address   string
+	Param     string
+	Old       string
+	New       string
+}
+
+// Finds what changed between two versions of a component, such as a calendar
+// feed before and after an update. Nested components are matched up as Merge
+// matches them, so that events are compared by UID and overrides by
+// RECURRENCE-ID, and ATTENDEEs are compared one calendar user at a time.
+// Differences that don't change the meaning are ignored: line folding, the
+// order and case of parameters, and how TEXT values are escaped.
+func Diff(old, new Component) []Change {
+	var changes []Change
+	diffComponent(&changes, nil, old, new)
+	return changes
+}
+
+func diffComponent(changes *[]Change, path []string, old, new Component) {
+	oldSlots, newSlots := fieldSlots(old), fieldSlots(new)
+	for _, key := range slotOrder(oldSlots.order, newSlots.order) {
+		o, n := oldSlots.fields[key], newSlots.fields[key]
+		c := Change{Path: path, Property: key}
+		if i := strings.IndexByte(key, ' '); i >= 0 {
+			c.Property, c.Address = key[:i], key[i+1:]
+		}
+		if len(o) == 1 && len(n) == 1 {
+			diffField(changes, c, o[0], n[0])
+			continue
+		}
+		// Properties that repeat, such as EXDATE, are compared as sets
+		oldSet, newSet := fieldSet(o), fieldSet(n)
+		for _, f := range o {
+			if !newSet[canonicalField(f)] {
+				c.Kind, c.Old, c.New = ChangeRemoved, normalValue(f), ""
+				*changes = append(*changes, c)
+			}
+		}
+		for _, f := range n {
+			if !oldSet[canonicalField(f)] {
+				c.Kind, c.Old, c.New = ChangeAdded, "", normalValue(f)
+				*changes = append(*changes, c)
+			}
+		}
+	}
+
+	oldComps, newComps := componentSlots(old), componentSlots(new)
+	for _, key := range slotOrder(oldComps.order, newComps.order) {
+		o, inOld := oldComps.comps[key]
+		n, inNew := newComps.comps[key]
+		sub := append(path[:len(path):len(path)], key)
+		switch {
+		case !inNew:
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Path: sub, Component: o})
+		case !inOld:
+			*changes = append(*changes, Change{Kind: ChangeAdded, Path: sub, Component: n})
+		default:
+			diffComponent(changes, sub, o, n)
+		}
+	}
+}
+
+// Compares a property present once in both versions, value first, then
+// parameter by parameter.
+func diffField(changes *[]Change, c Change, old, new Field) {
+	if normalValue(old) != normalValue(new) {
+		c.Kind, c.Old, c.New = ChangeModified, normalValue(old), normalValue(new)
+		*changes = append(*changes, c)
+	}
+	oldParams, newParams := normalParams(old), normalParams(new)
+	var names []string
+	for name := range oldParams {
+		names = append(names, name)
+	}
+	for name := range newParams {
+		if _, has := oldParams[name]; !has {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		o, inOld := oldParams[name]
+		n, inNew := newParams[name]
+		c.Param, c.Old, c.New = name, o, n
+		switch {
+		case !inNew:
+			c.Kind = ChangeRemoved
+		case !inOld:
+			c.Kind = ChangeAdded
+		case o != n:
+			c.Kind = ChangeModified
+		default:
+			continue
+		}
+		*changes = append(*changes, c)
+	}
+}
+
+// Returns the value of a field in a form equal for all spellings Diff
+// ignores: calendar user addresses normalized, and TEXT unescaped.
+func normalValue(f Field) string {
+	if strings.EqualFold(f.Name, "ATTENDEE") || strings.EqualFold(f.Name, "ORGANIZER") {
+		return NormalizeAddress(f.Value)
+	}
+	if f.DataType() == DTText {
+		return f.Text()
+	}
+	return f.Value
+}
+
+// Returns the parameters of a field by upper-case name, their values joined
+// by commas.
+func normalParams(f Field) map[string]string {
+	params := make(map[string]string, len(f.Params))
+	for name, vals := range f.Params {
+		name = strings.ToUpper(name)
+		if params[name] != "" {
+			vals = append([]string{params[name]}, vals...)
+		}
+		params[name] = strings.Join(vals, ",")
+	}
+	return params
+}
+
+// Renders a field in a form equal for all spellings Diff ignores.
+func canonicalField(f Field) string {
+	f = f.Canonical()
+	f.Value = normalValue(f)
+	return f.String()
+}
+
+func fieldSet(fields []Field) map[string]bool {
+	set := map[string]bool{}
+	for _, f := range fields {
+		set[canonicalField(f)] = true
+	}
+	return set
+}
+
+// Renders changes as a changelog for people, one line per change, such as
+//
+//	VEVENT m1: SUMMARY changed from "Planning" to "Review"
+func Changelog(changes []Change) string {
+	var lines []string
+	for _, c := range changes {
+		where := strings.Join(c.Path, " > ")
+		var line string
+		switch {
+		case c.Property == "":
+			verb := "Added"
+			if c.Kind == ChangeRemoved {
+				verb = "Removed"
+			}
+			line = verb + " " + where
+			if f, has := c.Component.Field("SUMMARY"); has {
+				line += fmt.Sprintf(" %q", f.Text())
+			}
+		default:
+			what := c.Property
+			if c.Address != "" {
+				what += " " + c.Address
+			}
+			if c.Param != "" {
+				what += " " + c.Param
+			}
+			if where != "" {
+				what = where + ": " + what
+			}
+			switch c.Kind {
+			case ChangeAdded:
+				line = fmt.Sprintf("%s added: %q", what, c.New)
+			case ChangeRemoved:
+				line = fmt.Sprintf("%s removed: %q", what, c.Old)
+			default:
+				line = fmt.Sprintf("%s changed from %q to %q", what, c.Old, c.New)
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,57 @@
+package icalendar
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Diff(t *testing.T) {
+	feed := func(lines ...string) Component {
+		return decodeString(t, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Test//EN\r\n"+
+			strings.Join(append(lines, ""), "\r\n")+"END:VCALENDAR\r\n")
+	}
+	old := feed(
+		"BEGIN:VEVENT", "UID:m1", "SUMMARY:Planning\\, part 1", "DTSTART:20240101T090000Z",
+		"ATTENDEE;RSVP=TRUE;PARTSTAT=NEEDS-ACTION:mailto:bob@example.com",
+		"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:carol@example.com",
+		"EXDATE:20240103T090000Z", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:m2", "SUMMARY:Lunch", "END:VEVENT")
+	// Refolded, reordered and re-escaped, but otherwise the same
+	same := feed(
+		"BEGIN:VEVENT", "UID:m1", "SUMMARY:Plan", " ning\\, part 1", "DTSTART:20240101T090000Z",
+		"ATTENDEE;partstat=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com",
+		"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:carol@example.com",
+		"EXDATE:20240103T090000Z", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:m2", "SUMMARY:Lunch", "END:VEVENT")
+	if changes := Diff(old, same); len(changes) != 0 {
+		t.Errorf("\nunexpected changes between equivalent feeds:\n%s", Changelog(changes))
+	}
+
+	updated := feed(
+		"BEGIN:VEVENT", "UID:m1", "SUMMARY:Planning\\, part 2", "DTSTART:20240101T090000Z",
+		"ATTENDEE;RSVP=TRUE;PARTSTAT=ACCEPTED:mailto:Bob@Example.com",
+		"EXDATE:20240103T090000Z", "EXDATE:20240104T090000Z", "LOCATION:Room 1", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:m1", "RECURRENCE-ID:20240102T090000Z", "DTSTART:20240102T100000Z", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:m3", "SUMMARY:Review", "END:VEVENT")
+	expected := `VEVENT m1: SUMMARY changed from "Planning, part 1" to "Planning, part 2"
+VEVENT m1: ATTENDEE mailto:bob@example.com PARTSTAT changed from "NEEDS-ACTION" to "ACCEPTED"
+VEVENT m1: ATTENDEE mailto:carol@example.com removed: "mailto:carol@example.com"
+VEVENT m1: EXDATE added: "20240104T090000Z"
+VEVENT m1: LOCATION added: "Room 1"
+Removed VEVENT m2 "Lunch"
+Added VEVENT m1 2024-01-02T09:00:00Z
+Added VEVENT m3 "Review"
+`
+	changes := Diff(old, updated)
+	if got := Changelog(changes); got != expected {
+		t.Errorf("\nunexpected changelog:\nexpected: %s\ngot:      %s\n", expected, got)
+	}
+	for _, c := range changes {
+		if c.Param == "PARTSTAT" && (c.Kind != ChangeModified || c.Address != "mailto:bob@example.com") {
+			t.Errorf("\nunexpected PARTSTAT change %#v\n", c)
+		}
+		if c.Property == "" && c.Kind == ChangeRemoved && c.Component.Value("UID") != "m2" {
+			t.Errorf("\nunexpected removal %#v\n", c)
+		}
+	}
+}
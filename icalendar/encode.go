@@ -0,0 +1,87 @@
+package icalendar
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lines longer than this many octets are folded, see RFC 5545 s. 3.1.
+const maxLineOctets = 75
+
+type Encoder struct {
+	dst *bufio.Writer
+}
+
+func NewEncoder(dst io.Writer) *Encoder {
+	return &Encoder{bufio.NewWriter(dst)}
+}
+
+func (e *Encoder) Encode(c Component) error {
+	e.writeComponent(c)
+	return e.dst.Flush()
+}
+
+func (e *Encoder) writeComponent(c Component) {
+	e.writeLine(Field{Name: "BEGIN", Value: c.Name}.String())
+	for _, f := range c.Fields {
+		e.writeLine(f.String())
+	}
+	for _, child := range c.Components {
+		e.writeComponent(child)
+	}
+	e.writeLine(Field{Name: "END", Value: c.Name}.String())
+}
+
+func (e *Encoder) writeLine(line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		e.dst.WriteString(line[:cut])
+		e.dst.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the continuation line's length
+		limit = maxLineOctets - 1
+	}
+	e.dst.WriteString(line)
+	e.dst.WriteString("\r\n")
+}
+
+// Renders the field as an unfolded content line without the trailing CRLF.
+// Parameters are written in sorted order so that output is deterministic, and
+// parameter values are quoted when they contain characters that would
+// otherwise end them.
+func (f Field) String() string {
+	var b strings.Builder
+	b.WriteString(f.Name)
+	names := make([]string, 0, len(f.Params))
+	for name := range f.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteByte(';')
+		b.WriteString(name)
+		b.WriteByte('=')
+		for i, val := range f.Params[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if strings.ContainsAny(val, ":;,") {
+				b.WriteByte('"')
+				b.WriteString(val)
+				b.WriteByte('"')
+			} else {
+				b.WriteString(val)
+			}
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(f.Value)
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package icalendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Encode(t *testing.T) {
+	src := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"ATTENDEE;CN=\"Doe, Jane\";ROLE=CHAIR:mailto:jane@example.com\r\n" +
+		"DESCRIPTION:" + strings.Repeat("Ünïcödé ", 30) + "\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	cal := decodeString(t, src)
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(cal); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("\nline not folded: %#v\n", line)
+		}
+	}
+	// Folding must never split a multi-byte character, so unfolding gets the
+	// original text back.
+	again := decodeString(t, buf.String())
+	if again.Components[0].Value("DESCRIPTION") != cal.Components[0].Value("DESCRIPTION") {
+		t.Errorf("\nround trip mismatch:\n%s\n", buf.String())
+	}
+	if line := again.Components[0].Fields[0].String(); line !=
+		"ATTENDEE;CN=\"Doe, Jane\";ROLE=CHAIR:mailto:jane@example.com" {
+		t.Errorf("\nunexpected attendee line: %s\n", line)
+	}
+}
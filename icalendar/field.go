@@ -3,6 +3,7 @@ package icalendar
 import (
 	"errors"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -411,6 +412,7 @@ const (
 	RTParent  RelationshipType = "PARENT"
 	RTChild                    = "CHILD"
 	RTSibling                  = "SIBLING"
+	RTSnooze                   = "SNOOZE" // RFC 9074
 )
 
 func (f Field) RelationshipType() RelationshipType {
@@ -475,14 +477,41 @@ const (
 	DTPeriod              = "PERIOD"
 	DTRecur               = "RECUR"
 	DTText                = "TEXT"
+	DTTime                = "TIME"
 	DTUri                 = "URI"
 	DTUtcOffset           = "UTC-OFFSET"
 )
 
+// The types of the properties of RFC 5545 and RFC 9074 when they have no
+// VALUE parameter.
+var defaultDataTypes = map[string]DataType{
+	"ATTACH": DTUri, "TZURL": DTUri, "URL": DTUri,
+	"GEO": DTFloat, "FREEBUSY": DTPeriod,
+	"PERCENT-COMPLETE": DTInteger, "PRIORITY": DTInteger, "REPEAT": DTInteger, "SEQUENCE": DTInteger,
+	"COMPLETED": DTDateTime, "DTEND": DTDateTime, "DUE": DTDateTime, "DTSTART": DTDateTime,
+	"RECURRENCE-ID": DTDateTime, "EXDATE": DTDateTime, "RDATE": DTDateTime, "CREATED": DTDateTime,
+	"DTSTAMP": DTDateTime, "LAST-MODIFIED": DTDateTime, "ACKNOWLEDGED": DTDateTime,
+	"DURATION": DTDuration, "TRIGGER": DTDuration,
+	"TZOFFSETFROM": DTUtcOffset, "TZOFFSETTO": DTUtcOffset,
+	"ATTENDEE": DTCalAddress, "ORGANIZER": DTCalAddress,
+	"RRULE": DTRecur, "EXRULE": DTRecur,
+	"CALSCALE": DTText, "METHOD": DTText, "PRODID": DTText, "VERSION": DTText,
+	"CATEGORIES": DTText, "CLASS": DTText, "COMMENT": DTText, "DESCRIPTION": DTText,
+	"LOCATION": DTText, "RESOURCES": DTText, "STATUS": DTText, "SUMMARY": DTText,
+	"TRANSP": DTText, "TZID": DTText, "TZNAME": DTText, "CONTACT": DTText,
+	"RELATED-TO": DTText, "UID": DTText, "ACTION": DTText, "REQUEST-STATUS": DTText,
+	"PROXIMITY": DTText,
+}
+
+// Returns the type of the field's value: the one its VALUE parameter names,
+// or else the default for the property. Properties the package doesn't know
+// default to TEXT.
 func (f Field) DataType() DataType {
 	if val, has := f.Params["VALUE"]; has && len(val) == 1 {
-		return DataType(val[0])
+		return DataType(strings.ToUpper(val[0]))
+	}
+	if dt, known := defaultDataTypes[strings.ToUpper(f.Name)]; known {
+		return dt
 	}
-	// TODO the default value should depend on the fieldname
 	return DTText
 }
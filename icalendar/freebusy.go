@@ -0,0 +1,110 @@
+package icalendar
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Computes the busy time in [from, to) from the VEVENTs of a set of
+// VCALENDARs, expanding recurrences. Events marked TRANSP:TRANSPARENT or
+// STATUS:CANCELLED are ignored, STATUS:TENTATIVE events count as
+// BUSY-TENTATIVE, and everything else as BUSY (RFC 4791 s. 7.10). Time that
+// VAVAILABILITY components mark as unavailable is included with their
+// BUSYTYPE, usually BUSY-UNAVAILABLE. Periods are clipped to the range and
+// merged within each FBTYPE, but periods of different types may overlap.
+func FreeBusy(cals []Component, from, to time.Time) (map[FreeBusyType][]Period, error) {
+	busy := make(map[FreeBusyType][]Period)
+	for _, cal := range cals {
+		instances, err := CalendarInstances(cal, "VEVENT", from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range instances {
+			fbtype, counts := eventBusyType(inst.Component)
+			if !counts || !inst.End.After(inst.Start) {
+				continue
+			}
+			p := Period{inst.Start, inst.End}
+			if p.Start.Before(from) {
+				p.Start = from
+			}
+			if p.End.After(to) {
+				p.End = to
+			}
+			busy[fbtype] = append(busy[fbtype], p)
+		}
+	}
+	unavailable, err := Unavailability(cals, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for fbtype, periods := range unavailable {
+		busy[fbtype] = append(busy[fbtype], periods...)
+	}
+	for fbtype, periods := range busy {
+		busy[fbtype] = MergePeriods(periods)
+	}
+	return busy, nil
+}
+
+func eventBusyType(event Component) (fbtype FreeBusyType, counts bool) {
+	if strings.EqualFold(event.Value("TRANSP"), "TRANSPARENT") {
+		return
+	}
+	switch strings.ToUpper(event.Value("STATUS")) {
+	case "CANCELLED":
+		return
+	case "TENTATIVE":
+		return FBBusyTentative, true
+	}
+	return FBBusy, true
+}
+
+// Sorts periods and merges those that overlap or abut. The result is a new
+// slice; the argument is left untouched.
+func MergePeriods(periods []Period) []Period {
+	sorted := make([]Period, len(periods))
+	copy(sorted, periods)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+	var merged []Period
+	for _, p := range sorted {
+		if n := len(merged); n > 0 && !p.Start.After(merged[n-1].End) {
+			if p.End.After(merged[n-1].End) {
+				merged[n-1].End = p.End
+			}
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// Renders busy periods as FREEBUSY fields, one per FBTYPE, in UTC as RFC 5545
+// s. 3.8.2.6 requires. Fields are ordered by FBTYPE so output is stable.
+func FreeBusyFields(busy map[FreeBusyType][]Period) []Field {
+	var types []string
+	for fbtype := range busy {
+		types = append(types, string(fbtype))
+	}
+	sort.Strings(types)
+	var fields []Field
+	for _, fbtype := range types {
+		periods := busy[FreeBusyType(fbtype)]
+		if len(periods) == 0 {
+			continue
+		}
+		vals := make([]string, len(periods))
+		for i, p := range periods {
+			vals[i] = formatPeriod(p)
+		}
+		fields = append(fields, Field{
+			Name:   "FREEBUSY",
+			Params: map[string][]string{"FBTYPE": {fbtype}},
+			Value:  strings.Join(vals, ","),
+		})
+	}
+	return fields
+}
@@ -0,0 +1,68 @@
+package icalendar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_FreeBusy(t *testing.T) {
+	cal := decodeString(t, "BEGIN:VCALENDAR\r\n"+
+		// Weekly on Mondays, with one instance moved and one cancelled
+		"BEGIN:VEVENT\r\n"+
+		"UID:weekly\r\n"+
+		"DTSTART:20240101T090000Z\r\n"+
+		"DTEND:20240101T100000Z\r\n"+
+		"RRULE:FREQ=WEEKLY\r\n"+
+		"EXDATE:20240115T090000Z\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:weekly\r\n"+
+		"RECURRENCE-ID:20240108T090000Z\r\n"+
+		"DTSTART:20240108T093000Z\r\n"+
+		"DTEND:20240108T103000Z\r\n"+
+		"END:VEVENT\r\n"+
+		// Overlaps the first instance
+		"BEGIN:VEVENT\r\n"+
+		"UID:overlap\r\n"+
+		"DTSTART:20240101T093000Z\r\n"+
+		"DURATION:PT1H\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:maybe\r\n"+
+		"STATUS:TENTATIVE\r\n"+
+		"DTSTART:20240102T090000Z\r\n"+
+		"DTEND:20240102T100000Z\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:cancelled\r\n"+
+		"STATUS:CANCELLED\r\n"+
+		"DTSTART:20240103T090000Z\r\n"+
+		"DTEND:20240103T100000Z\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:transparent\r\n"+
+		"TRANSP:TRANSPARENT\r\n"+
+		"DTSTART;VALUE=DATE:20240104\r\n"+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 22, 9, 30, 0, 0, time.UTC)
+	busy, err := FreeBusy([]Component{cal}, from, to)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	fields := FreeBusyFields(busy)
+	expected := []string{
+		"BUSY:20240101T090000Z/20240101T103000Z,20240108T093000Z/20240108T103000Z," +
+			"20240122T090000Z/20240122T093000Z",
+		"BUSY-TENTATIVE:20240102T090000Z/20240102T100000Z",
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("\nexpected %d fields, got %#v\n", len(expected), fields)
+	}
+	for i, field := range fields {
+		if got := string(field.FreeBusyType()) + ":" + field.Value; got != expected[i] {
+			t.Errorf("\nexpected: %s\ngot:      %s\n", expected[i], got)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package icalendar
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// A Mail is an iMIP email carrying an iTIP message, see RFC 6047. From and To
+// are plain email addresses, such as alice@example.com, and Text and HTML are
+// summaries of the message for people reading it without a calendar client.
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Date    time.Time
+	Text    string
+	HTML    string
+	Message Component
+}
+
+var (
+	noCalendarPart = errors.New("Mail has no text/calendar part")
+	methodMismatch = errors.New("Content-Type method does not match the METHOD of the calendar")
+	wrongSender    = errors.New("Mail sender may not send this iTIP message")
+)
+
+// Builds the email that sends an iTIP message from one calendar user to
+// others, with a subject and summaries describing it.
+func NewMail(msg Component, from string, to []string, date time.Time) (Mail, error) {
+	method, err := MessageMethod(msg)
+	if err != nil {
+		return Mail{}, err
+	}
+	comps := schedulingComponents(msg)
+	if len(comps) == 0 {
+		return Mail{}, noScheduling
+	}
+	c := comps[0]
+	title := c.Value("SUMMARY")
+	if f, has := c.Field("SUMMARY"); has {
+		title = f.Text()
+	}
+	if title == "" {
+		title = "(untitled)"
+	}
+	sender := from
+	for _, f := range append(c.FieldsNamed("ORGANIZER"), c.FieldsNamed("ATTENDEE")...) {
+		if SameAddress(f.Value, "mailto:"+from) && f.CommonName() != "" {
+			sender = f.CommonName()
+		}
+	}
+	subject, action := mailWording(method, c, from)
+	lines := []string{fmt.Sprintf("%s %s %q.", sender, action, title)}
+	if start, err := dateTimeField(c, "DTSTART"); err == nil {
+		lines = append(lines, "When: "+start.UTC().Format("Monday, January 2, 2006 15:04 MST"))
+	}
+	if f, has := c.Field("LOCATION"); has {
+		lines = append(lines, "Where: "+f.Text())
+	}
+	var htmlLines []string
+	for _, line := range lines {
+		htmlLines = append(htmlLines, "<p>"+html.EscapeString(line)+"</p>")
+	}
+	return Mail{
+		From:    from,
+		To:      to,
+		Subject: subject + ": " + title,
+		Date:    date,
+		Text:    strings.Join(lines, "\r\n") + "\r\n",
+		HTML:    "<html><body>" + strings.Join(htmlLines, "") + "</body></html>",
+		Message: msg,
+	}, nil
+}
+
+// Picks the subject prefix and the verb describing what the sender did.
+func mailWording(method Method, c Component, from string) (subject, action string) {
+	switch method {
+	case MethodRequest:
+		return "Invitation", "has invited you to"
+	case MethodAdd:
+		return "Updated invitation", "has added occurrences to"
+	case MethodCancel:
+		return "Cancelled", "has cancelled"
+	case MethodRefresh:
+		return "Update requested", "has asked for the latest version of"
+	case MethodCounter:
+		return "New proposal", "has proposed changes to"
+	case MethodDeclineCounter:
+		return "Proposal declined", "has declined your proposed changes to"
+	case MethodReply:
+		status := ParticipantStatus(PSNeedsAction)
+		if f, found := findAttendee(c, "mailto:"+from); found {
+			status = f.ParticipantStatus()
+		}
+		switch status {
+		case PSAccepted:
+			return "Accepted", "has accepted"
+		case PSDeclined:
+			return "Declined", "has declined"
+		case PSTentative:
+			return "Tentative", "has tentatively accepted"
+		}
+		return "Reply", "has replied to"
+	}
+	return "Published", "has published"
+}
+
+// Writes the mail as a multipart/alternative MIME message whose last part is
+// the text/calendar one, as RFC 6047 s. 2.4 suggests.
+func (m Mail) Encode(w io.Writer) error {
+	var cal bytes.Buffer
+	if err := NewEncoder(&cal).Encode(m.Message); err != nil {
+		return err
+	}
+	method, err := MessageMethod(m.Message)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+		{"text/calendar; charset=UTF-8; method=" + string(method), cal.String()},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := io.WriteString(qw, part.content); err != nil {
+			return err
+		}
+		if err := qw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	var to []string
+	for _, addr := range m.To {
+		to = append(to, (&mail.Address{Address: addr}).String())
+	}
+	headers := []string{
+		"From: " + (&mail.Address{Address: m.From}).String(),
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("UTF-8", m.Subject),
+		"Date: " + m.Date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	if _, err := io.WriteString(w, strings.Join(headers, "\r\n")+"\r\n\r\n"); err != nil {
+		return err
+	}
+	_, err = body.WriteTo(w)
+	return err
+}
+
+// Reads an iMIP email, finding its text/calendar part wherever it is nested.
+// The method parameter of that part must agree with the calendar's METHOD.
+// This doesn't check the sender; see VerifySender.
+func DecodeMail(r io.Reader) (m Mail, err error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return
+	}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		m.From = from.Address
+	}
+	if to, err := msg.Header.AddressList("To"); err == nil {
+		for _, addr := range to {
+			m.To = append(m.To, addr.Address)
+		}
+	}
+	dec := new(mime.WordDecoder)
+	if m.Subject, err = dec.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		return
+	}
+	m.Date, _ = msg.Header.Date()
+	found := false
+	err = m.readPart(textproto.MIMEHeader(msg.Header), msg.Body, &found)
+	if err == nil && !found {
+		err = noCalendarPart
+	}
+	return
+}
+
+func (m *Mail) readPart(header textproto.MIMEHeader, body io.Reader, found *bool) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.readPart(part.Header, part, found); err != nil {
+				return err
+			}
+		}
+	}
+	// multipart.Reader undoes quoted-printable in parts itself, dropping the
+	// header, but not base64
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case "text/plain":
+		if m.Text == "" {
+			m.Text = string(content)
+		}
+	case "text/html":
+		if m.HTML == "" {
+			m.HTML = string(content)
+		}
+	case "text/calendar":
+		if *found {
+			return nil
+		}
+		cal, err := NewDecoder(bytes.NewReader(content)).Decode()
+		if err != nil {
+			return err
+		}
+		method, err := MessageMethod(cal)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(params["method"], string(method)) {
+			return methodMismatch
+		}
+		m.Message = cal
+		*found = true
+	}
+	return nil
+}
+
+// Checks that the sender of a mail may send the iTIP message in it, since
+// anybody can put anything in an email, see RFC 6047 s. 3. Methods only
+// organizers send must come from the ORGANIZER, and REPLY, REFRESH and
+// COUNTER from the ATTENDEE, so they may not name any other attendee, see
+// RFC 5546 s. 3.2.3. Someone acting for them, as SENT-BY says, counts as
+// them.
+func (m Mail) VerifySender() error {
+	method, err := MessageMethod(m.Message)
+	if err != nil {
+		return err
+	}
+	sender := "mailto:" + m.From
+	for _, c := range schedulingComponents(m.Message) {
+		var candidates []Field
+		fromAttendee := false
+		switch method {
+		case MethodReply, MethodRefresh, MethodCounter:
+			candidates, fromAttendee = c.FieldsNamed("ATTENDEE"), true
+		default:
+			candidates = c.FieldsNamed("ORGANIZER")
+		}
+		allowed := false
+		for _, f := range candidates {
+			from := SameAddress(f.Value, sender) || (f.SentBy() != "" && SameAddress(f.SentBy(), sender))
+			if fromAttendee && !from {
+				return wrongSender
+			}
+			allowed = allowed || from
+		}
+		if !allowed {
+			return wrongSender
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package icalendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Mail(t *testing.T) {
+	date := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	invite := Request(meeting(t, "SUMMARY:Planning ünd more", "LOCATION:Room 1\\, upstairs",
+		"ORGANIZER;CN=Alice Liddell:mailto:alice@example.com"))
+	m, err := NewMail(invite, "alice@example.com", []string{"bob@example.com", "carol@example.com"}, date)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if m.Subject != "Invitation: Planning ünd more" ||
+		!strings.Contains(m.Text, `Alice Liddell has invited you to "Planning ünd more".`) ||
+		!strings.Contains(m.Text, "Where: Room 1, upstairs") || !strings.Contains(m.HTML, "&#34;Planning ünd more&#34;") {
+		t.Errorf("\nunexpected summary:\n%s\n%s\n%s\n", m.Subject, m.Text, m.HTML)
+	}
+
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if !strings.Contains(buf.String(), "Content-Type: text/calendar; charset=UTF-8; method=REQUEST") {
+		t.Errorf("\ncalendar part lacks its method:\n%s\n", buf.String())
+	}
+	got, err := DecodeMail(&buf)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if got.From != m.From || len(got.To) != 2 || got.Subject != m.Subject || !got.Date.Equal(date) ||
+		got.Text != m.Text || got.HTML != m.HTML {
+		t.Errorf("\nround trip:\nexpected: %#v\ngot:      %#v\n", m, got)
+	}
+	if summary, _ := got.Message.Components[0].Field("SUMMARY"); summary.Text() != "Planning ünd more" || got.Message.Value("METHOD") != "REQUEST" {
+		t.Errorf("\ncalendar did not survive the round trip: %#v\n", got.Message)
+	}
+	if err := got.VerifySender(); err != nil {
+		t.Errorf("\nunexpected error verifying the organizer: %s\n", err)
+	}
+
+	reply, _ := Reply(invite, "mailto:bob@example.com", PSDeclined, date)
+	// An attendee answering for somebody else as well
+	forged, _ := Reply(invite, "mailto:bob@example.com", PSAccepted, date)
+	forged.Components[0].Fields = append(forged.Components[0].Fields,
+		Field{Name: "ATTENDEE", Params: map[string][]string{"PARTSTAT": {"DECLINED"}}, Value: "mailto:carol@example.com"})
+	tests := []struct {
+		name string
+		msg  Component
+		from string
+		err  error
+	}{
+		{"request from organizer", invite, "Alice@Example.com", nil},
+		{"request from attendee", invite, "bob@example.com", wrongSender},
+		{"reply from attendee", reply, "bob@example.com", nil},
+		{"reply from someone else", reply, "carol@example.com", wrongSender},
+		{"reply for another attendee", forged, "bob@example.com", wrongSender},
+		{"request from delegate", Request(meeting(t, "ORGANIZER;SENT-BY=\"mailto:dan@example.com\":mailto:alice@example.com")), "dan@example.com", nil},
+	}
+	for _, test := range tests {
+		m := Mail{From: test.from, Message: test.msg}
+		if err := m.VerifySender(); err != test.err {
+			t.Errorf("\n%s:\nexpected: %v\ngot:      %v\n", test.name, test.err, err)
+		}
+	}
+	if m, _ := NewMail(reply, "bob@example.com", []string{"alice@example.com"}, date); m.Subject != "Declined: (untitled)" {
+		t.Errorf("\nunexpected reply subject %q\n", m.Subject)
+	}
+}
+
+func Test_DecodeMail(t *testing.T) {
+	cal := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Test//EN\r\nMETHOD:CANCEL\r\n" +
+		"BEGIN:VEVENT\r\nUID:m1\r\nORGANIZER:mailto:alice@example.com\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	mixed := func(method, encoding, body string) string {
+		return "From: Alice <alice@example.com>\r\n" +
+			"To: bob@example.com\r\n" +
+			"Subject: =?UTF-8?Q?Cancelled=3A_Planning?=\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+			"--outer\r\n" +
+			"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+			"--inner\r\n" +
+			"Content-Type: text/plain\r\n\r\n" +
+			"Cancelled\r\n" +
+			"--inner\r\n" +
+			"Content-Type: text/calendar; method=" + method + "\r\n" +
+			"Content-Transfer-Encoding: " + encoding + "\r\n\r\n" +
+			body + "\r\n" +
+			"--inner--\r\n" +
+			"--outer--\r\n"
+	}
+	b64 := "QkVHSU46VkNBTEVOREFSDQpWRVJTSU9OOjIuMA0KUFJPRElEOi0vL0V4YW1wbGUvL1Rlc3QvL0VODQpNRVRIT0Q6Q0FOQ0VMDQpCRUdJTjpWRVZFTlQNClVJRDptMQ0KT1JHQU5JWkVSOm1haWx0bzphbGljZUBleGFtcGxlLmNvbQ0KRU5EOlZFVkVOVA0KRU5EOlZDQUxFTkRBUg0K"
+	tests := []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{"nested", mixed("CANCEL", "7bit", cal), nil},
+		{"base64", mixed("CANCEL", "base64", b64), nil},
+		{"method mismatch", mixed("REQUEST", "7bit", cal), methodMismatch},
+		{"no calendar", "From: alice@example.com\r\nContent-Type: text/plain\r\n\r\nHello\r\n", noCalendarPart},
+	}
+	for _, test := range tests {
+		m, err := DecodeMail(strings.NewReader(test.src))
+		if err != test.err {
+			t.Errorf("\n%s:\nexpected: %v\ngot:      %v\n", test.name, test.err, err)
+			continue
+		}
+		if err == nil && (m.Message.Value("METHOD") != "CANCEL" || m.Subject != "Cancelled: Planning" ||
+			m.From != "alice@example.com" || m.Text != "Cancelled") {
+			t.Errorf("\n%s: unexpected mail %#v\n", test.name, m)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package icalendar
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// An Instance is one occurrence of a VEVENT or VTODO. Component is the master
+// component, or the override whose RECURRENCE-ID matched this occurrence.
+// RecurrenceID is the occurrence's original start, and is zero for components
+// that don't recur.
+type Instance struct {
+	Start        time.Time
+	End          time.Time
+	RecurrenceID time.Time
+	Component    Component
+}
+
+// Expands a VEVENT or VTODO and its overrides (components with the same UID
+// and a RECURRENCE-ID) into the instances that overlap [from, to), sorted by
+// start. RRULE, RDATE and EXDATE are honoured. A zero-length instance overlaps
+// the range if it starts within it. RANGE=THISANDFUTURE overrides are treated
+// as applying to their own instance only. Floating times are read as UTC; use
+// InstancesIn to pick a different zone for them.
+func Instances(master Component, overrides []Component, from, to time.Time) ([]Instance, error) {
+	return InstancesIn(master, overrides, from, to, time.UTC)
+}
+
+func InstancesIn(master Component, overrides []Component, from, to time.Time, floating *time.Location) (instances []Instance, err error) {
+	start, length, hasStart, err := componentSpan(master, floating)
+	if err != nil || !hasStart {
+		return
+	}
+	var starts []time.Time
+	explicit := make(map[int64]time.Duration) // RDATE periods with their own length
+	rrules := master.FieldsNamed("RRULE")
+	rdates := master.FieldsNamed("RDATE")
+	if len(rrules) == 0 && len(rdates) == 0 {
+		starts = []time.Time{start}
+	}
+	for _, f := range rrules {
+		var r Recur
+		if r, err = ParseRecur(f.Value); err != nil {
+			return
+		}
+		starts = append(starts, r.Expand(start, to)...)
+	}
+	if len(rrules) == 0 && len(rdates) > 0 {
+		starts = append(starts, start)
+	}
+	for _, f := range rdates {
+		for _, val := range strings.Split(f.Value, ",") {
+			if f.DataType() == DTPeriod || strings.IndexByte(val, '/') >= 0 {
+				var p Period
+				if p, err = parsePeriod(val, f.location(floating)); err != nil {
+					return
+				}
+				starts = append(starts, p.Start)
+				explicit[p.Start.Unix()] = p.End.Sub(p.Start)
+				continue
+			}
+			var t time.Time
+			if t, err = parseDateTime(val, f.location(floating)); err != nil {
+				return
+			}
+			starts = append(starts, t)
+		}
+	}
+	excluded := make(map[int64]bool)
+	for _, f := range master.FieldsNamed("EXDATE") {
+		for _, val := range strings.Split(f.Value, ",") {
+			var t time.Time
+			if t, err = parseDateTime(val, f.location(floating)); err != nil {
+				return
+			}
+			excluded[t.Unix()] = true
+		}
+	}
+	overridden := make(map[int64]Component)
+	for _, o := range overrides {
+		rid, has := o.Field("RECURRENCE-ID")
+		if !has {
+			continue
+		}
+		var t time.Time
+		if t, err = rid.DateTimeIn(floating); err != nil {
+			return
+		}
+		overridden[t.Unix()] = o
+	}
+	overlaps := func(s, e time.Time) bool {
+		if e.Equal(s) {
+			return !s.Before(from) && s.Before(to)
+		}
+		return s.Before(to) && e.After(from)
+	}
+	recurring := len(rrules) > 0 || len(rdates) > 0
+	seen := make(map[int64]bool)
+	for _, s := range starts {
+		key := s.Unix()
+		if seen[key] || excluded[key] {
+			continue
+		}
+		seen[key] = true
+		instLength := length
+		if l, has := explicit[key]; has {
+			instLength = Duration{Time: l}
+		}
+		inst := Instance{Start: s, End: instLength.From(s), Component: master}
+		if recurring {
+			inst.RecurrenceID = s
+		}
+		if o, has := overridden[key]; has {
+			var oStart time.Time
+			var oLength Duration
+			var oHas bool
+			if oStart, oLength, oHas, err = componentSpan(o, floating); err != nil {
+				return
+			}
+			if !oHas {
+				oStart = s
+			}
+			if _, hasEnd := o.Field("DTEND"); !hasEnd {
+				if _, hasDur := o.Field("DURATION"); !hasDur {
+					oLength = instLength
+				}
+			}
+			inst.Start, inst.End, inst.Component = oStart, oLength.From(oStart), o
+		}
+		if overlaps(inst.Start, inst.End) {
+			instances = append(instances, inst)
+		}
+	}
+	// Overrides may move an instance into the range from a start the rule
+	// didn't reach, since expansion stops at the end of the range.
+	for key, o := range overridden {
+		if seen[key] || excluded[key] {
+			continue
+		}
+		var oStart time.Time
+		var oLength Duration
+		var oHas bool
+		if oStart, oLength, oHas, err = componentSpan(o, floating); err != nil {
+			return
+		}
+		if oHas && overlaps(oStart, oLength.From(oStart)) && !oStart.Before(start) {
+			instances = append(instances, Instance{oStart, oLength.From(oStart), time.Unix(key, 0), o})
+		}
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instances[i].Start.Before(instances[j].Start)
+	})
+	return
+}
+
+// Expands every component with the given name (VEVENT or VTODO) in a
+// VCALENDAR, grouping overrides with their masters by UID. Overrides whose
+// master is missing are treated as standalone components. Masters that share
+// a UID, which only non-conforming data has, are each expanded, and an
+// override replaces the one instance with its UID and RECURRENCE-ID.
+func CalendarInstances(cal Component, name string, from, to time.Time) ([]Instance, error) {
+	return CalendarInstancesIn(cal, name, from, to, time.UTC)
+}
+
+func CalendarInstancesIn(cal Component, name string, from, to time.Time, floating *time.Location) (instances []Instance, err error) {
+	var masters []Component
+	hasMaster := make(map[string]bool)
+	overrides := make(map[string][]Component)
+	for _, c := range cal.ComponentsNamed(name) {
+		uid := c.Value("UID")
+		if _, has := c.Field("RECURRENCE-ID"); has {
+			overrides[uid] = append(overrides[uid], c)
+			continue
+		}
+		masters = append(masters, c)
+		hasMaster[uid] = true
+	}
+	for uid, orphans := range overrides {
+		if hasMaster[uid] {
+			continue
+		}
+		for _, o := range orphans {
+			var insts []Instance
+			if insts, err = InstancesIn(o, nil, from, to, floating); err != nil {
+				return
+			}
+			instances = append(instances, insts...)
+		}
+	}
+	type overrideKey struct {
+		uid string
+		rid int64
+	}
+	overridden := make(map[overrideKey]bool)
+	for _, m := range masters {
+		uid := m.Value("UID")
+		var insts []Instance
+		if insts, err = InstancesIn(m, overrides[uid], from, to, floating); err != nil {
+			return
+		}
+		for _, inst := range insts {
+			if _, has := inst.Component.Field("RECURRENCE-ID"); has {
+				key := overrideKey{uid, inst.RecurrenceID.Unix()}
+				if overridden[key] {
+					continue
+				}
+				overridden[key] = true
+			}
+			instances = append(instances, inst)
+		}
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instances[i].Start.Before(instances[j].Start)
+	})
+	return
+}
@@ -0,0 +1,42 @@
+package icalendar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_CalendarInstances(t *testing.T) {
+	event := func(lines ...string) string {
+		out := "BEGIN:VEVENT\r\n"
+		for _, line := range lines {
+			out += line + "\r\n"
+		}
+		return out + "END:VEVENT\r\n"
+	}
+	cal := decodeString(t, "BEGIN:VCALENDAR\r\n"+
+		// Two masters sharing a UID, one of them with an override
+		event("UID:twice", "DTSTART:20240101T090000Z", "DURATION:PT1H", "RRULE:FREQ=DAILY;COUNT=2")+
+		event("UID:twice", "DTSTART:20240101T140000Z", "DURATION:PT1H", "RRULE:FREQ=DAILY;COUNT=2")+
+		event("UID:twice", "RECURRENCE-ID:20240102T140000Z", "DTSTART:20240102T160000Z", "DURATION:PT1H")+
+		// And two without one
+		event("DTSTART:20240101T110000Z", "DURATION:PT1H")+
+		event("DTSTART:20240101T120000Z", "DURATION:PT1H")+
+		"END:VCALENDAR\r\n")
+	insts, err := CalendarInstances(cal, "VEVENT", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	var got []string
+	for _, inst := range insts {
+		got = append(got, inst.Start.Format("02T15"))
+	}
+	expected := []string{"01T09", "01T11", "01T12", "01T14", "02T09", "02T16"}
+	if len(got) != len(expected) {
+		t.Fatalf("\nexpected: %v\ngot:      %v\n", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("\nexpected: %v\ngot:      %v\n", expected, got)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package icalendar
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Method is the METHOD of an iTIP message, which says what the calendar
+// user sending it wants done with it, see RFC 5546 s. 1.4.
+type Method string
+
+const (
+	MethodPublish        Method = "PUBLISH"
+	MethodRequest               = "REQUEST"
+	MethodReply                 = "REPLY"
+	MethodAdd                   = "ADD"
+	MethodCancel                = "CANCEL"
+	MethodRefresh               = "REFRESH"
+	MethodCounter               = "COUNTER"
+	MethodDeclineCounter        = "DECLINECOUNTER"
+)
+
+var (
+	notAnITIPMessage = errors.New("VCALENDAR has no METHOD")
+	unknownMethod    = errors.New("Unknown iTIP method")
+	notInvited       = errors.New("Calendar user is not an attendee")
+	noScheduling     = errors.New("VCALENDAR has no scheduling component")
+	uidMismatch      = errors.New("iTIP message is about another UID")
+)
+
+// Returns the METHOD of an iTIP message.
+func MessageMethod(msg Component) (Method, error) {
+	m := strings.ToUpper(msg.Value("METHOD"))
+	switch Method(m) {
+	case "":
+		return "", notAnITIPMessage
+	case MethodPublish, MethodRequest, MethodReply, MethodAdd, MethodCancel,
+		MethodRefresh, MethodCounter, MethodDeclineCounter:
+		return Method(m), nil
+	}
+	return "", unknownMethod
+}
+
+// Publishes an event without inviting anybody, so the message has no
+// ATTENDEEs, see RFC 5546 s. 3.2.1.
+func Publish(cal Component) Component {
+	msg := message(cal, MethodPublish)
+	for i := range msg.Components {
+		msg.Components[i].RemoveFields("ATTENDEE")
+	}
+	return msg
+}
+
+// Invites the attendees of an event, or updates them on its changes, see RFC
+// 5546 s. 3.2.2. The organizer should have incremented SEQUENCE for changes
+// that need the attendees to answer again.
+func Request(cal Component) Component {
+	return message(cal, MethodRequest)
+}
+
+// Builds an attendee's answer to an invitation, see RFC 5546 s. 3.2.3. Only
+// the attendee's own ATTENDEE field is included, with its PARTSTAT set to
+// status.
+func Reply(cal Component, attendee string, status ParticipantStatus, stamp time.Time) (Component, error) {
+	msg := message(Component{Name: "VCALENDAR", Fields: cal.Fields}, MethodReply)
+	for _, c := range schedulingComponents(cal) {
+		reply := Component{Name: c.Name}
+		found := false
+		for _, f := range c.Fields {
+			switch strings.ToUpper(f.Name) {
+			case "UID", "RECURRENCE-ID", "SEQUENCE", "ORGANIZER", "REQUEST-STATUS":
+				reply.Fields = append(reply.Fields, f)
+			case "ATTENDEE":
+				if SameAddress(f.Value, attendee) {
+					reply.Fields = append(reply.Fields, f.WithParticipantStatus(status))
+					found = true
+				}
+			}
+		}
+		if found {
+			reply.SetField(Field{Name: "DTSTAMP", Value: formatDateTime(stamp)})
+			msg.Components = append(msg.Components, reply)
+		}
+	}
+	if len(msg.Components) == 0 {
+		return Component{}, notInvited
+	}
+	return msg, nil
+}
+
+// Adds instances to a recurring event, see RFC 5546 s. 3.2.4. The instances
+// are components with the event's UID and no RECURRENCE-ID.
+func Add(cal Component, instances []Component, stamp time.Time) (Component, error) {
+	master, err := masterComponent(cal)
+	if err != nil {
+		return Component{}, err
+	}
+	msg := message(Component{Name: "VCALENDAR", Fields: cal.Fields}, MethodAdd)
+	for _, inst := range instances {
+		if inst.Value("UID") != master.Value("UID") {
+			return Component{}, uidMismatch
+		}
+		inst.SetField(Field{Name: "DTSTAMP", Value: formatDateTime(stamp)})
+		if seq, has := master.Field("SEQUENCE"); has {
+			inst.SetField(seq)
+		}
+		msg.Components = append(msg.Components, inst)
+	}
+	return msg, nil
+}
+
+// Cancels an event, see RFC 5546 s. 3.2.5. With attendees given, the message
+// only lists them, which is how an organizer tells attendees it removed that
+// the event is off for them. SEQUENCE is incremented, as the RFC requires of
+// the organizer.
+func Cancel(cal Component, stamp time.Time, attendees ...string) Component {
+	msg := message(cal, MethodCancel)
+	for i, c := range msg.Components {
+		if c.Name == "VTIMEZONE" {
+			continue
+		}
+		if len(attendees) > 0 {
+			var fields []Field
+			for _, f := range c.Fields {
+				if !strings.EqualFold(f.Name, "ATTENDEE") || containsAddress(attendees, f.Value) {
+					fields = append(fields, f)
+				}
+			}
+			c.Fields = fields
+		}
+		c.SetField(Field{Name: "STATUS", Value: "CANCELLED"})
+		c.SetField(Field{Name: "SEQUENCE", Value: strconv.Itoa(sequence(c) + 1)})
+		c.SetField(Field{Name: "DTSTAMP", Value: formatDateTime(stamp)})
+		msg.Components[i] = c
+	}
+	return msg
+}
+
+// Asks the organizer for the latest version of an event, see RFC 5546
+// s. 3.2.6.
+func Refresh(cal Component, attendee string, stamp time.Time) (Component, error) {
+	master, err := masterComponent(cal)
+	if err != nil {
+		return Component{}, err
+	}
+	att, found := findAttendee(master, attendee)
+	if !found {
+		return Component{}, notInvited
+	}
+	refresh := Component{Name: master.Name, Fields: []Field{
+		{Name: "UID", Value: master.Value("UID")},
+		{Name: "DTSTAMP", Value: formatDateTime(stamp)},
+	}}
+	if org, has := master.Field("ORGANIZER"); has {
+		refresh.Fields = append(refresh.Fields, org)
+	}
+	refresh.Fields = append(refresh.Fields, att)
+	msg := message(Component{Name: "VCALENDAR", Fields: cal.Fields}, MethodRefresh)
+	msg.Components = []Component{refresh}
+	return msg, nil
+}
+
+// Proposes changes to an event on behalf of an attendee, see RFC 5546
+// s. 3.2.7. proposal is the event as the attendee would like it to be.
+func Counter(proposal Component, stamp time.Time) Component {
+	msg := message(proposal, MethodCounter)
+	for i, c := range msg.Components {
+		if c.Name != "VTIMEZONE" {
+			msg.Components[i].SetField(Field{Name: "DTSTAMP", Value: formatDateTime(stamp)})
+		}
+	}
+	return msg
+}
+
+// Turns down the proposal in a COUNTER, see RFC 5546 s. 3.2.8.
+func DeclineCounter(counter Component, stamp time.Time) Component {
+	msg := message(Component{Name: "VCALENDAR", Fields: counter.Fields}, MethodDeclineCounter)
+	for _, c := range schedulingComponents(counter) {
+		decline := Component{Name: c.Name}
+		for _, f := range c.Fields {
+			switch strings.ToUpper(f.Name) {
+			case "UID", "RECURRENCE-ID", "SEQUENCE", "ORGANIZER", "ATTENDEE", "COMMENT":
+				decline.Fields = append(decline.Fields, f)
+			}
+		}
+		decline.SetField(Field{Name: "DTSTAMP", Value: formatDateTime(stamp)})
+		msg.Components = append(msg.Components, decline)
+	}
+	return msg
+}
+
+// Applies an iTIP message to the recipient's stored copy of the event, which
+// is the zero Component if there is none yet, and returns the updated copy.
+//
+// Each component of a message only applies if it is newer than the stored
+// component it is about, as RFC 5546 s. 2.1.5 orders them: by SEQUENCE, then
+// by DTSTAMP. Older ones are skipped, while the rest of the message still
+// applies. REPLYs update the PARTSTAT of the attendee that sent them, and add
+// delegates the delegator named. REFRESH, COUNTER and DECLINECOUNTER call for
+// an answer rather than a change, so they leave the copy as it is.
+func Apply(stored, msg Component) (Component, error) {
+	method, err := MessageMethod(msg)
+	if err != nil {
+		return Component{}, err
+	}
+	if stored.Name == "" {
+		stored = Component{Name: "VCALENDAR", Fields: withoutMethod(msg.Fields)}
+	}
+	if uid, other := messageUID(msg), messageUID(stored); uid == "" {
+		return Component{}, noScheduling
+	} else if other != "" && other != uid {
+		return Component{}, uidMismatch
+	}
+	stored.Components = append([]Component(nil), stored.Components...)
+	switch method {
+	case MethodPublish, MethodRequest:
+		err = applyUpdate(&stored, msg)
+	case MethodAdd:
+		err = applyAdd(&stored, msg)
+	case MethodCancel:
+		err = applyCancel(&stored, msg)
+	case MethodReply:
+		err = applyReply(&stored, msg)
+	}
+	if err != nil {
+		return Component{}, err
+	}
+	return stored, nil
+}
+
+func applyUpdate(stored *Component, msg Component) error {
+	for _, c := range msg.Components {
+		if c.Name == "VTIMEZONE" {
+			replaceTimeZone(stored, c)
+			continue
+		}
+		i := findInstance(*stored, c)
+		if i < 0 {
+			stored.Components = append(stored.Components, c)
+			continue
+		}
+		old := stored.Components[i]
+		if !newer(c, old) {
+			continue
+		}
+		// Alarms belong to the recipient
+		c.Components = append(withoutComponents(c.Components, "VALARM"), old.ComponentsNamed("VALARM")...)
+		stored.Components[i] = c
+		if _, has := c.Field("RECURRENCE-ID"); !has {
+			dropOverrides(stored, c)
+		}
+	}
+	return nil
+}
+
+// Removes the overrides of a new revision of the master component that are
+// from an older SEQUENCE, since the organizer sends those it still wants
+// along with the master, see RFC 5546 s. 2.1.5.
+func dropOverrides(stored *Component, master Component) {
+	var kept []Component
+	for _, o := range stored.Components {
+		if _, has := o.Field("RECURRENCE-ID"); has && strings.EqualFold(o.Name, master.Name) &&
+			sequence(o) < sequence(master) {
+			continue
+		}
+		kept = append(kept, o)
+	}
+	stored.Components = kept
+}
+
+func applyAdd(stored *Component, msg Component) error {
+	master, err := masterComponent(*stored)
+	if err != nil {
+		return err
+	}
+	for _, c := range schedulingComponents(msg) {
+		if sequence(c) < sequence(master) {
+			continue
+		}
+		stored.Components = append(stored.Components, c)
+	}
+	return nil
+}
+
+func applyCancel(stored *Component, msg Component) error {
+	for _, c := range schedulingComponents(msg) {
+		i := findInstance(*stored, c)
+		if i < 0 {
+			// Cancelling an instance without an override of its own
+			if rid, has := c.Field("RECURRENCE-ID"); has {
+				if m := masterIndex(*stored); m >= 0 {
+					exdate := rid
+					exdate.Name = "EXDATE"
+					stored.Components[m].Fields = append(append([]Field(nil), stored.Components[m].Fields...), exdate)
+				}
+			}
+			continue
+		}
+		old := stored.Components[i]
+		if !newer(c, old) {
+			continue
+		}
+		cancelled := []int{i}
+		// Cancelling the whole event cancels its overrides too, see RFC 5546
+		// s. 3.2.5
+		if _, has := c.Field("RECURRENCE-ID"); !has {
+			for j, o := range stored.Components {
+				if _, has := o.Field("RECURRENCE-ID"); has && strings.EqualFold(o.Name, c.Name) && newer(c, o) {
+					cancelled = append(cancelled, j)
+				}
+			}
+		}
+		for _, j := range cancelled {
+			old := stored.Components[j]
+			old.SetField(Field{Name: "STATUS", Value: "CANCELLED"})
+			if seq, has := c.Field("SEQUENCE"); has {
+				old.SetField(seq)
+			}
+			stored.Components[j] = old
+		}
+	}
+	return nil
+}
+
+func applyReply(stored *Component, msg Component) error {
+	for _, c := range schedulingComponents(msg) {
+		i := findInstance(*stored, c)
+		if i < 0 {
+			i = masterIndex(*stored)
+		}
+		if i < 0 {
+			continue
+		}
+		old := stored.Components[i]
+		if !newer(c, old) {
+			continue
+		}
+		// A REPLY answers for the one attendee that sent it, see RFC 5546
+		// s. 3.2.3, so components naming others are ignored rather than
+		// letting anybody answer for them
+		answers := c.FieldsNamed("ATTENDEE")
+		if len(answers) != 1 {
+			continue
+		}
+		answer := answers[0]
+		fields := append([]Field(nil), old.Fields...)
+		replaced := false
+		for j, f := range fields {
+			if strings.EqualFold(f.Name, "ATTENDEE") && SameAddress(f.Value, answer.Value) {
+				fields[j] = f.WithParticipantStatus(answer.ParticipantStatus())
+				if delegatees := answer.Delegatees(); len(delegatees) > 0 {
+					fields[j].Params["DELEGATED-TO"] = delegatees
+				}
+				replaced = true
+			}
+		}
+		// Delegates answer for themselves without having been invited, which
+		// only counts once an attendee has delegated to them
+		if !replaced && delegatedTo(fields, answer) {
+			fields = append(fields, answer)
+		}
+		old.Fields = fields
+		stored.Components[i] = old
+	}
+	return nil
+}
+
+// Reports whether one of the attendees in fields delegated to an answer's
+// attendee, and is named by it as a delegator.
+func delegatedTo(fields []Field, answer Field) bool {
+	for _, delegator := range answer.Delegators() {
+		for _, f := range fields {
+			if strings.EqualFold(f.Name, "ATTENDEE") && SameAddress(f.Value, delegator) &&
+				containsAddress(f.Delegatees(), answer.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reports whether a component of a message supersedes the stored one.
+func newer(c, old Component) bool {
+	if seq, oldSeq := sequence(c), sequence(old); seq != oldSeq {
+		return seq > oldSeq
+	}
+	stamp, err := dateTimeField(c, "DTSTAMP")
+	if err != nil {
+		return true
+	}
+	oldStamp, err := dateTimeField(old, "DTSTAMP")
+	return err != nil || !stamp.Before(oldStamp)
+}
+
+func dateTimeField(c Component, name string) (time.Time, error) {
+	f, has := c.Field(name)
+	if !has {
+		return time.Time{}, noValue
+	}
+	return f.DateTime()
+}
+
+func sequence(c Component) int {
+	seq, _ := strconv.Atoi(c.Value("SEQUENCE"))
+	return seq
+}
+
+// Copies a VCALENDAR into an iTIP message with the given method. Alarms are
+// personal, so they are left out.
+func message(cal Component, method Method) Component {
+	msg := Component{Name: "VCALENDAR", Fields: append([]Field(nil), cal.Fields...)}
+	msg.SetField(Field{Name: "METHOD", Value: string(method)})
+	for _, c := range cal.Components {
+		c.Components = withoutComponents(c.Components, "VALARM")
+		msg.Components = append(msg.Components, c)
+	}
+	return msg
+}
+
+func withoutMethod(fields []Field) []Field {
+	c := Component{Fields: fields}
+	c.RemoveFields("METHOD")
+	return c.Fields
+}
+
+func withoutComponents(comps []Component, name string) []Component {
+	var kept []Component
+	for _, c := range comps {
+		if !strings.EqualFold(c.Name, name) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// Returns the components of a VCALENDAR other than its time zones.
+func schedulingComponents(cal Component) []Component {
+	return withoutComponents(cal.Components, "VTIMEZONE")
+}
+
+func messageUID(cal Component) string {
+	for _, c := range schedulingComponents(cal) {
+		if uid := c.Value("UID"); uid != "" {
+			return uid
+		}
+	}
+	return ""
+}
+
+func masterIndex(cal Component) int {
+	for i, c := range cal.Components {
+		if c.Name == "VTIMEZONE" {
+			continue
+		}
+		if _, has := c.Field("RECURRENCE-ID"); !has {
+			return i
+		}
+	}
+	return -1
+}
+
+func masterComponent(cal Component) (Component, error) {
+	i := masterIndex(cal)
+	if i < 0 {
+		return Component{}, noScheduling
+	}
+	return cal.Components[i], nil
+}
+
+// Finds the stored component c is about: the one with the same name and
+// RECURRENCE-ID, compared as instants.
+func findInstance(cal Component, c Component) int {
+	rid, hasRID := c.Field("RECURRENCE-ID")
+	for i, other := range cal.Components {
+		if !strings.EqualFold(other.Name, c.Name) {
+			continue
+		}
+		otherRID, otherHas := other.Field("RECURRENCE-ID")
+		if hasRID != otherHas {
+			continue
+		}
+		if !hasRID || sameInstant(rid, otherRID) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameInstant(a, b Field) bool {
+	at, errA := a.DateTime()
+	bt, errB := b.DateTime()
+	if errA != nil || errB != nil {
+		return a.Value == b.Value
+	}
+	return at.Equal(bt)
+}
+
+func replaceTimeZone(cal *Component, tz Component) {
+	for i, c := range cal.Components {
+		if c.Name == "VTIMEZONE" && c.Value("TZID") == tz.Value("TZID") {
+			cal.Components[i] = tz
+			return
+		}
+	}
+	cal.Components = append([]Component{tz}, cal.Components...)
+}
+
+func findAttendee(c Component, addr string) (Field, bool) {
+	for _, f := range c.FieldsNamed("ATTENDEE") {
+		if SameAddress(f.Value, addr) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func containsAddress(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if SameAddress(a, addr) {
+			return true
+		}
+	}
+	return false
+}
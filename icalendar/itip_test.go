@@ -0,0 +1,221 @@
+package icalendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Builds a VCALENDAR holding a meeting organized by alice with bob and carol
+// invited, with extra lines added to the VEVENT.
+func meeting(t *testing.T, lines ...string) Component {
+	return decodeString(t, "BEGIN:VCALENDAR\r\n"+
+		"VERSION:2.0\r\n"+
+		"PRODID:-//Example//Test//EN\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:m1\r\n"+
+		"DTSTART:20240101T090000Z\r\n"+
+		"RRULE:FREQ=DAILY;COUNT=5\r\n"+
+		"ORGANIZER:mailto:alice@example.com\r\n"+
+		"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:bob@example.com\r\n"+
+		"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:carol@example.com\r\n"+
+		strings.Join(append(lines, ""), "\r\n")+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+}
+
+func Test_iTIPMessages(t *testing.T) {
+	stamp := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	cal := meeting(t, "SEQUENCE:1", "DTSTAMP:20240101T000000Z",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "TRIGGER:-PT5M", "END:VALARM")
+
+	req := Request(cal)
+	if m, _ := MessageMethod(req); m != MethodRequest || len(req.Components[0].Components) != 0 {
+		t.Errorf("\nexpected a REQUEST without alarms, got %#v\n", req)
+	}
+	if cal.Value("METHOD") != "" || len(cal.Components[0].Components) != 1 {
+		t.Errorf("\nbuilding a message changed the event\n")
+	}
+	if pub := Publish(cal); len(pub.Components[0].FieldsNamed("ATTENDEE")) != 0 || pub.Value("METHOD") != "PUBLISH" {
+		t.Errorf("\nexpected a PUBLISH without attendees, got %#v\n", pub)
+	}
+
+	reply, err := Reply(cal, "MAILTO:Bob@example.com", PSAccepted, stamp)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	attendees := reply.Components[0].FieldsNamed("ATTENDEE")
+	if reply.Value("METHOD") != "REPLY" || len(attendees) != 1 || attendees[0].ParticipantStatus() != PSAccepted ||
+		reply.Components[0].Value("DTSTAMP") != "20240201T000000Z" || reply.Components[0].Value("DTSTART") != "" {
+		t.Errorf("\nunexpected REPLY: %#v\n", reply)
+	}
+	if _, err := Reply(cal, "mailto:eve@example.com", PSAccepted, stamp); err != notInvited {
+		t.Errorf("\nReply by a stranger:\nexpected: %s\ngot:      %v\n", notInvited, err)
+	}
+
+	cancel := Cancel(cal, stamp, "mailto:carol@example.com")
+	c := cancel.Components[0]
+	if cancel.Value("METHOD") != "CANCEL" || c.Value("STATUS") != "CANCELLED" || c.Value("SEQUENCE") != "2" ||
+		len(c.FieldsNamed("ATTENDEE")) != 1 || c.Value("ATTENDEE") != "mailto:carol@example.com" {
+		t.Errorf("\nunexpected CANCEL: %#v\n", cancel)
+	}
+
+	refresh, err := Refresh(cal, "mailto:carol@example.com", stamp)
+	if err != nil || refresh.Value("METHOD") != "REFRESH" || len(refresh.Components[0].Fields) != 4 {
+		t.Errorf("\nunexpected REFRESH: %#v %v\n", refresh, err)
+	}
+
+	proposal := meeting(t, "SEQUENCE:1", "DTSTAMP:20240101T000000Z", "COMMENT:Can we start later?")
+	proposal.Components[0].SetField(Field{Name: "DTSTART", Value: "20240101T100000Z"})
+	counter := Counter(proposal, stamp)
+	decline := DeclineCounter(counter, stamp)
+	if counter.Value("METHOD") != "COUNTER" || counter.Components[0].Value("DTSTART") != "20240101T100000Z" ||
+		decline.Value("METHOD") != "DECLINECOUNTER" || decline.Components[0].Value("DTSTART") != "" ||
+		decline.Components[0].Value("COMMENT") == "" {
+		t.Errorf("\nunexpected COUNTER and DECLINECOUNTER:\n%#v\n%#v\n", counter, decline)
+	}
+
+	extra := Component{Name: "VEVENT", Fields: []Field{{Name: "UID", Value: "m1"}, {Name: "DTSTART", Value: "20240110T090000Z"}}}
+	add, err := Add(cal, []Component{extra}, stamp)
+	if err != nil || add.Value("METHOD") != "ADD" || add.Components[0].Value("SEQUENCE") != "1" {
+		t.Errorf("\nunexpected ADD: %#v %v\n", add, err)
+	}
+	extra.SetField(Field{Name: "UID", Value: "other"})
+	if _, err := Add(cal, []Component{extra}, stamp); err != uidMismatch {
+		t.Errorf("\nADD of another UID:\nexpected: %s\ngot:      %v\n", uidMismatch, err)
+	}
+}
+
+func Test_Apply(t *testing.T) {
+	stored := meeting(t, "SEQUENCE:1", "DTSTAMP:20240101T000000Z",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "TRIGGER:-PT5M", "END:VALARM")
+	stamp := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	summary := func(c Component) string { return c.Components[0].Value("SUMMARY") }
+	update := func(lines ...string) Component {
+		return Request(meeting(t, append(lines, "SUMMARY:Updated")...))
+	}
+	reply := func(seq string, stamp time.Time) Component {
+		msg, _ := Reply(meeting(t, "SEQUENCE:"+seq), "mailto:bob@example.com", PSTentative, stamp)
+		return msg
+	}
+	// A REPLY carrying just the one ATTENDEE line
+	answer := func(attendee string) Component {
+		msg, _ := Reply(meeting(t, "SEQUENCE:1"), "mailto:bob@example.com", PSTentative, stamp)
+		msg.Components[0].RemoveFields("ATTENDEE")
+		msg.Components[0].Fields = append(msg.Components[0].Fields,
+			decodeString(t, "BEGIN:X\r\n"+attendee+"\r\nEND:X\r\n").Fields...)
+		return msg
+	}
+	delegated := func(delegator string) Component {
+		c, _ := Apply(stored, answer("ATTENDEE;PARTSTAT=DELEGATED;DELEGATED-TO=\"mailto:dave@example.com\":"+delegator))
+		return c
+	}
+	daveAnswer := answer("ATTENDEE;PARTSTAT=ACCEPTED;DELEGATED-FROM=\"mailto:bob@example.com\":mailto:dave@example.com")
+	attendees := func(c Component) int { return len(c.Components[0].FieldsNamed("ATTENDEE")) }
+	bobStatus := func(c Component) ParticipantStatus {
+		f, _ := findAttendee(c.Components[0], "mailto:bob@example.com")
+		return f.ParticipantStatus()
+	}
+
+	tests := []struct {
+		name  string
+		msg   Component
+		err   error
+		check func(Component) bool
+	}{
+		{"newer sequence", update("SEQUENCE:2", "DTSTAMP:20231201T000000Z"), nil, func(c Component) bool {
+			return summary(c) == "Updated" && len(c.Components[0].ComponentsNamed("VALARM")) == 1
+		}},
+		{"same sequence, newer stamp", update("SEQUENCE:1", "DTSTAMP:20240102T000000Z"), nil, func(c Component) bool {
+			return summary(c) == "Updated"
+		}},
+		{"same sequence, older stamp", update("SEQUENCE:1", "DTSTAMP:20231231T000000Z"), nil, func(c Component) bool {
+			return summary(c) == ""
+		}},
+		{"older sequence", update("SEQUENCE:0", "DTSTAMP:20240102T000000Z"), nil, func(c Component) bool {
+			return summary(c) == ""
+		}},
+		{"older sequence with a newer instance", func() Component {
+			msg := update("SEQUENCE:0", "DTSTAMP:20240102T000000Z")
+			instance := meeting(t, "SEQUENCE:1", "DTSTAMP:20240102T000000Z", "RECURRENCE-ID:20240103T090000Z", "SUMMARY:Moved")
+			msg.Components = append(msg.Components, instance.Components[0])
+			return msg
+		}(), nil, func(c Component) bool {
+			return summary(c) == "" && len(c.Components) == 2 && c.Components[1].Value("SUMMARY") == "Moved"
+		}},
+		{"reply", reply("1", stamp), nil, func(c Component) bool { return bobStatus(c) == PSTentative }},
+		{"outdated reply", reply("0", stamp), nil, func(c Component) bool { return bobStatus(c) == PSNeedsAction }},
+		{"reply with an older stamp", reply("1", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)), nil, func(c Component) bool {
+			return bobStatus(c) == PSNeedsAction
+		}},
+		{"delegate without delegator", daveAnswer, nil, func(c Component) bool { return attendees(c) == 2 }},
+		{"reply for others", func() Component {
+			msg := reply("1", stamp)
+			msg.Components[0].Fields = append(msg.Components[0].Fields,
+				Field{Name: "ATTENDEE", Params: map[string][]string{"PARTSTAT": {"DECLINED"}}, Value: "mailto:carol@example.com"})
+			return msg
+		}(), nil, func(c Component) bool {
+			carol, _ := findAttendee(c.Components[0], "mailto:carol@example.com")
+			return bobStatus(c) == PSNeedsAction && carol.ParticipantStatus() == PSNeedsAction
+		}},
+		{"cancel", Cancel(stored, stamp), nil, func(c Component) bool {
+			return c.Components[0].Value("STATUS") == "CANCELLED" && c.Components[0].Value("SEQUENCE") == "2"
+		}},
+		{"cancel instance", func() Component {
+			instance := meeting(t, "SEQUENCE:1", "RECURRENCE-ID:20240103T090000Z")
+			instance.Components[0].RemoveFields("RRULE")
+			return Cancel(instance, stamp)
+		}(), nil, func(c Component) bool {
+			return len(c.Components) == 1 && c.Components[0].Value("EXDATE") == "20240103T090000Z" &&
+				c.Components[0].Value("STATUS") == ""
+		}},
+		{"counter", Counter(meeting(t, "SUMMARY:Later"), stamp), nil, func(c Component) bool { return summary(c) == "" }},
+		{"other UID", Request(decodeString(t, "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:m2\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")), uidMismatch, nil},
+		{"no method", meeting(t), notAnITIPMessage, nil},
+	}
+	for _, test := range tests {
+		got, err := Apply(stored, test.msg)
+		if err != test.err {
+			t.Errorf("\n%s:\nexpected: %v\ngot:      %v\n", test.name, test.err, err)
+			continue
+		}
+		if test.check != nil && !test.check(got) {
+			t.Errorf("\n%s: unexpected result %#v\n", test.name, got)
+		}
+	}
+	if summary(stored) != "" || len(stored.Components) != 1 {
+		t.Errorf("\nApply changed the stored copy in place\n")
+	}
+
+	// Overrides of an older SEQUENCE go with a new master, and are cancelled
+	// with it
+	withOverride := meeting(t, "SEQUENCE:1", "DTSTAMP:20240101T000000Z")
+	moved := meeting(t, "SEQUENCE:1", "DTSTAMP:20240101T000000Z", "RECURRENCE-ID:20240103T090000Z", "SUMMARY:Moved")
+	moved.Components[0].RemoveFields("RRULE")
+	withOverride.Components = append(withOverride.Components, moved.Components[0])
+	if got, err := Apply(withOverride, update("SEQUENCE:2", "DTSTAMP:20240102T000000Z")); err != nil || len(got.Components) != 1 || summary(got) != "Updated" {
+		t.Errorf("\nnew master kept an old override: %#v %v\n", got, err)
+	}
+	got, err := Apply(withOverride, Cancel(meeting(t, "SEQUENCE:1"), stamp))
+	if err != nil || len(got.Components) != 2 {
+		t.Fatalf("\nunexpected result of cancelling: %#v %v\n", got, err)
+	}
+	for _, c := range got.Components {
+		if c.Value("STATUS") != "CANCELLED" {
+			t.Errorf("\ncancelling the event left a component live: %#v\n", c)
+		}
+	}
+
+	// Delegates are added once their delegator has named them
+	for delegator, want := range map[string]int{"mailto:bob@example.com": 3, "mailto:carol@example.com": 2} {
+		if got, err := Apply(delegated(delegator), daveAnswer); err != nil || attendees(got) != want {
+			t.Errorf("\ndelegated by %s:\nexpected: %d attendees\ngot:      %d %v\n", delegator, want, attendees(got), err)
+		}
+	}
+
+	// A first REQUEST creates the copy
+	got, err = Apply(Component{}, update("SEQUENCE:0"))
+	if err != nil || got.Value("METHOD") != "" || summary(got) != "Updated" {
+		t.Errorf("\nunexpected copy from a first REQUEST: %#v %v\n", got, err)
+	}
+}
@@ -0,0 +1,453 @@
+package icalendar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	invalidJCal  = errors.New("Invalid jCal")
+	invalidValue = errors.New("Value does not match its type")
+)
+
+// jCal's type for properties whose type isn't known, see RFC 7265 s. 5.
+const jCalUnknown = "unknown"
+
+// Properties holding lists of values, which jCal spreads out after the type.
+// TEXT lists separate their values with unescaped commas.
+var listFields = map[string]bool{"CATEGORIES": true, "RESOURCES": true, "EXDATE": true, "RDATE": true, "FREEBUSY": true}
+
+// Encodes a component as jCal, the JSON form of iCalendar of RFC 7265:
+// ["vcalendar", [properties...], [components...]]. Each property becomes
+// [name, {parameters}, type, values...], its type being what DataType says
+// and its values typed to match, except that a property this package doesn't
+// know without a VALUE parameter has the type "unknown" and its value as it
+// is written in iCalendar.
+func EncodeJCal(c Component) ([]byte, error) {
+	v, err := jCalComponent(c)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func jCalComponent(c Component) ([]interface{}, error) {
+	props := []interface{}{}
+	for _, f := range c.Fields {
+		prop, err := jCalProperty(f)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+	comps := []interface{}{}
+	for _, child := range c.Components {
+		comp, err := jCalComponent(child)
+		if err != nil {
+			return nil, err
+		}
+		comps = append(comps, comp)
+	}
+	return []interface{}{strings.ToLower(c.Name), props, comps}, nil
+}
+
+func jCalProperty(f Field) ([]interface{}, error) {
+	params := map[string]interface{}{}
+	for name, vals := range f.Params {
+		switch {
+		case strings.EqualFold(name, "VALUE"):
+		case len(vals) == 1:
+			params[strings.ToLower(name)] = vals[0]
+		default:
+			params[strings.ToLower(name)] = vals
+		}
+	}
+	name := strings.ToUpper(f.Name)
+	typ := strings.ToLower(string(f.DataType()))
+	_, explicit := f.Params["VALUE"]
+	if _, known := defaultDataTypes[name]; !known && !explicit {
+		typ = jCalUnknown
+	}
+	if typ == "date-time" && len(f.Value) == len(dateLayout) {
+		typ = "date"
+	}
+	prop := []interface{}{strings.ToLower(f.Name), params, typ}
+
+	vals := []string{f.Value}
+	switch {
+	case typ == jCalUnknown:
+	case name == "GEO" || name == "REQUEST-STATUS":
+		// Structured values, see RFC 7265 s. 3.4.1.3
+		var parts []interface{}
+		for _, part := range splitUnescaped(f.Value, ';') {
+			if name == "GEO" {
+				n, err := jCalNumber(part, true)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, n)
+			} else {
+				parts = append(parts, Field{Value: part}.Text())
+			}
+		}
+		return append(prop, parts), nil
+	case listFields[name] && typ == "text":
+		vals = splitUnescaped(f.Value, ',')
+	case listFields[name] || strings.ContainsRune(f.Value, ',') && (typ == "date" || typ == "date-time" || typ == "period"):
+		vals = strings.Split(f.Value, ",")
+	}
+	for _, val := range vals {
+		v, err := jCalValue(typ, val)
+		if err != nil {
+			return nil, err
+		}
+		prop = append(prop, v)
+	}
+	return prop, nil
+}
+
+// Converts a single value of an iCalendar property to its jCal form, see
+// RFC 7265 s. 3.5.
+func jCalValue(typ, val string) (interface{}, error) {
+	switch typ {
+	case "text":
+		return Field{Value: val}.Text(), nil
+	case "boolean":
+		return strings.EqualFold(val, "TRUE"), nil
+	case "integer":
+		return jCalNumber(val, false)
+	case "float":
+		return jCalNumber(val, true)
+	case "date", "date-time", "time":
+		return jCalTime(val)
+	case "period":
+		slash := strings.IndexByte(val, '/')
+		if slash < 0 {
+			return nil, invalidValue
+		}
+		start, err := jCalTime(val[:slash])
+		if err != nil {
+			return nil, err
+		}
+		end := val[slash+1:]
+		if !strings.Contains(end, "P") {
+			if end, err = jCalTime(end); err != nil {
+				return nil, err
+			}
+		}
+		return start + "/" + end, nil
+	case "utc-offset":
+		if len(val) != 5 && len(val) != 7 {
+			return nil, invalidValue
+		}
+		offset := val[:3] + ":" + val[3:5]
+		if len(val) == 7 {
+			offset += ":" + val[5:]
+		}
+		return offset, nil
+	case "recur":
+		return jCalRecur(val)
+	}
+	return val, nil
+}
+
+func jCalNumber(val string, float bool) (json.Number, error) {
+	var err error
+	if float {
+		_, err = strconv.ParseFloat(val, 64)
+	} else {
+		_, err = strconv.Atoi(val)
+	}
+	if err != nil {
+		return "", invalidValue
+	}
+	return json.Number(strings.TrimPrefix(val, "+")), nil
+}
+
+// Punctuates a DATE, DATE-TIME or TIME: 20240101T090000Z becomes
+// 2024-01-01T09:00:00Z.
+func jCalTime(val string) (string, error) {
+	date, clock := val, ""
+	if t := strings.IndexByte(val, 'T'); t >= 0 {
+		date, clock = val[:t], val[t+1:]
+	} else if len(val) != len(dateLayout) {
+		date, clock = "", val
+	}
+	var b strings.Builder
+	if date != "" {
+		if len(date) != len(dateLayout) {
+			return "", invalidValue
+		}
+		b.WriteString(date[:4] + "-" + date[4:6] + "-" + date[6:])
+		if clock != "" || strings.Contains(val, "T") {
+			b.WriteByte('T')
+		}
+	}
+	if clock != "" {
+		utc := strings.HasSuffix(clock, "Z")
+		clock = strings.TrimSuffix(clock, "Z")
+		if len(clock) != 6 {
+			return "", invalidValue
+		}
+		b.WriteString(clock[:2] + ":" + clock[2:4] + ":" + clock[4:])
+		if utc {
+			b.WriteByte('Z')
+		}
+	}
+	return b.String(), nil
+}
+
+// Parts of a RECUR whose values are numbers, see RFC 7265 s. 3.6.10.
+var recurNumbers = map[string]bool{
+	"COUNT": true, "INTERVAL": true, "BYSECOND": true, "BYMINUTE": true, "BYHOUR": true,
+	"BYMONTHDAY": true, "BYYEARDAY": true, "BYWEEKNO": true, "BYMONTH": true, "BYSETPOS": true,
+}
+
+func jCalRecur(val string) (map[string]interface{}, error) {
+	recur := map[string]interface{}{}
+	for _, part := range strings.Split(val, ";") {
+		eq := strings.IndexByte(part, '=')
+		if eq < 0 {
+			return nil, invalidValue
+		}
+		key, rest := strings.ToUpper(part[:eq]), part[eq+1:]
+		var vals []interface{}
+		for _, v := range strings.Split(rest, ",") {
+			switch {
+			case recurNumbers[key]:
+				n, err := jCalNumber(v, false)
+				if err != nil {
+					return nil, err
+				}
+				vals = append(vals, n)
+			case key == "UNTIL":
+				t, err := jCalTime(v)
+				if err != nil {
+					return nil, err
+				}
+				vals = append(vals, t)
+			default:
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 1 {
+			recur[strings.ToLower(key)] = vals[0]
+		} else {
+			recur[strings.ToLower(key)] = vals
+		}
+	}
+	return recur, nil
+}
+
+// Splits s at the occurrences of sep that aren't escaped with a backslash,
+// keeping the escapes.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Decodes a component from jCal, the inverse of EncodeJCal. Properties get a
+// VALUE parameter when their type isn't the default for them, and those of
+// type "unknown" take their value as it is.
+func DecodeJCal(data []byte) (Component, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return Component{}, err
+	}
+	return componentFromJCal(v)
+}
+
+func componentFromJCal(v interface{}) (c Component, err error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 3 {
+		err = invalidJCal
+		return
+	}
+	name, ok := arr[0].(string)
+	props, okProps := arr[1].([]interface{})
+	comps, okComps := arr[2].([]interface{})
+	if !ok || !okProps || !okComps {
+		err = invalidJCal
+		return
+	}
+	c.Name = strings.ToUpper(name)
+	for _, p := range props {
+		var f Field
+		if f, err = fieldFromJCal(p); err != nil {
+			return
+		}
+		c.Fields = append(c.Fields, f)
+	}
+	for _, child := range comps {
+		var sub Component
+		if sub, err = componentFromJCal(child); err != nil {
+			return
+		}
+		c.Components = append(c.Components, sub)
+	}
+	return
+}
+
+func fieldFromJCal(v interface{}) (f Field, err error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) < 4 {
+		err = invalidJCal
+		return
+	}
+	name, ok := arr[0].(string)
+	params, okParams := arr[1].(map[string]interface{})
+	typ, okType := arr[2].(string)
+	if !ok || !okParams || !okType {
+		err = invalidJCal
+		return
+	}
+	f.Name = strings.ToUpper(name)
+	typ = strings.ToLower(typ)
+	for pname, pval := range params {
+		if f.Params == nil {
+			f.Params = map[string][]string{}
+		}
+		pname = strings.ToUpper(pname)
+		switch pval := pval.(type) {
+		case string:
+			f.Params[pname] = []string{pval}
+		case []interface{}:
+			for _, item := range pval {
+				s, ok := item.(string)
+				if !ok {
+					err = invalidJCal
+					return
+				}
+				f.Params[pname] = append(f.Params[pname], s)
+			}
+		default:
+			err = invalidJCal
+			return
+		}
+	}
+	if typ != jCalUnknown {
+		dt, known := defaultDataTypes[f.Name]
+		if !known || strings.ToLower(string(dt)) != typ {
+			if f.Params == nil {
+				f.Params = map[string][]string{}
+			}
+			f.Params["VALUE"] = []string{strings.ToUpper(typ)}
+		}
+	}
+
+	if f.Name == "GEO" || f.Name == "REQUEST-STATUS" {
+		parts, ok := arr[3].([]interface{})
+		if !ok {
+			err = invalidJCal
+			return
+		}
+		var vals []string
+		for _, part := range parts {
+			var s string
+			if s, err = valueFromJCal("text", part); err != nil {
+				return
+			}
+			if f.Name == "REQUEST-STATUS" {
+				s = escapeText(s)
+			}
+			vals = append(vals, s)
+		}
+		f.Value = strings.Join(vals, ";")
+		return
+	}
+	var vals []string
+	for _, val := range arr[3:] {
+		var s string
+		if s, err = valueFromJCal(typ, val); err != nil {
+			return
+		}
+		if typ == "text" {
+			s = escapeText(s)
+		}
+		vals = append(vals, s)
+	}
+	f.Value = strings.Join(vals, ",")
+	return
+}
+
+// Converts a single jCal value back to its iCalendar form, leaving TEXT
+// unescaped.
+func valueFromJCal(typ string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		switch typ {
+		case "utc-offset":
+			return strings.Replace(v, ":", "", -1), nil
+		case "date", "date-time", "time", "period":
+			return strings.NewReplacer("-", "", ":", "").Replace(v), nil
+		}
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case map[string]interface{}:
+		if typ != "recur" {
+			return "", invalidJCal
+		}
+		return recurFromJCal(v)
+	}
+	return "", invalidJCal
+}
+
+func recurFromJCal(recur map[string]interface{}) (string, error) {
+	keys := make([]string, 0, len(recur))
+	upper := map[string]interface{}{}
+	for key, v := range recur {
+		keys = append(keys, strings.ToUpper(key))
+		upper[strings.ToUpper(key)] = v
+	}
+	// FREQ goes first, as some readers insist
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "FREQ") != (keys[j] == "FREQ") {
+			return keys[i] == "FREQ"
+		}
+		return keys[i] < keys[j]
+	})
+	var parts []string
+	for _, key := range keys {
+		v := upper[key]
+		items, isList := v.([]interface{})
+		if !isList {
+			items = []interface{}{v}
+		}
+		var vals []string
+		for _, item := range items {
+			typ := "text"
+			if key == "UNTIL" {
+				typ = "date-time"
+			}
+			s, err := valueFromJCal(typ, item)
+			if err != nil {
+				return "", err
+			}
+			vals = append(vals, s)
+		}
+		parts = append(parts, key+"="+strings.Join(vals, ","))
+	}
+	return strings.Join(parts, ";"), nil
+}
@@ -0,0 +1,94 @@
+package icalendar
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_jCal(t *testing.T) {
+	cal := decodeString(t, "BEGIN:VCALENDAR\r\n"+
+		"VERSION:2.0\r\n"+
+		"PRODID:-//Example//Test//EN\r\n"+
+		"X-WR-CALNAME:Work\\, mostly\r\n"+
+		"BEGIN:VTIMEZONE\r\n"+
+		"TZID:America/New_York\r\n"+
+		"BEGIN:STANDARD\r\n"+
+		"DTSTART:19701101T020000\r\n"+
+		"TZOFFSETFROM:-0400\r\n"+
+		"TZOFFSETTO:-0500\r\n"+
+		"RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\n"+
+		"END:STANDARD\r\n"+
+		"END:VTIMEZONE\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:m1\r\n"+
+		"SUMMARY:Planning\\; part 1\r\n"+
+		"DTSTART;TZID=America/New_York:20240101T090000\r\n"+
+		"DURATION:PT1H\r\n"+
+		"RRULE:FREQ=WEEKLY;COUNT=10;BYDAY=MO,WE;UNTIL=20240301T000000Z\r\n"+
+		"EXDATE:20240103T140000Z,20240108T140000Z\r\n"+
+		"CATEGORIES:Work,Meetings\\, internal\r\n"+
+		"GEO:37.386013;-122.082932\r\n"+
+		"SEQUENCE:2\r\n"+
+		"ATTENDEE;PARTSTAT=ACCEPTED;DELEGATED-FROM=\"mailto:a@example.com\",\"mailto:b@example.com\":mailto:bob@example.com\r\n"+
+		"X-PRIORITY-SCORE;VALUE=INTEGER:7\r\n"+
+		"END:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:m2\r\n"+
+		"DTSTART;VALUE=DATE:20240105\r\n"+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+
+	data, err := EncodeJCal(cal)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	for _, expected := range []string{
+		`["vcalendar",[["version",{},"text","2.0"],`,
+		`["x-wr-calname",{},"unknown","Work\\, mostly"]`,
+		`["tzoffsetfrom",{},"utc-offset","-04:00"]`,
+		`["rrule",{},"recur",{"byday":"1SU","bymonth":11,"freq":"YEARLY"}]`,
+		`["summary",{},"text","Planning; part 1"]`,
+		`["dtstart",{"tzid":"America/New_York"},"date-time","2024-01-01T09:00:00"]`,
+		`["duration",{},"duration","PT1H"]`,
+		`{"byday":["MO","WE"],"count":10,"freq":"WEEKLY","until":"2024-03-01T00:00:00Z"}`,
+		`["exdate",{},"date-time","2024-01-03T14:00:00Z","2024-01-08T14:00:00Z"]`,
+		`["categories",{},"text","Work","Meetings, internal"]`,
+		`["geo",{},"float",[37.386013,-122.082932]]`,
+		`["sequence",{},"integer",2]`,
+		`"delegated-from":["mailto:a@example.com","mailto:b@example.com"]`,
+		`"cal-address","mailto:bob@example.com"]`,
+		`["x-priority-score",{},"integer",7]`,
+		`["dtstart",{},"date","2024-01-05"]`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("\njCal lacks %s:\n%s\n", expected, data)
+		}
+	}
+
+	back, err := DecodeJCal(data)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if back.Hash() != cal.Hash() {
+		t.Errorf("\nround trip:\nexpected: %#v\ngot:      %#v\n", cal.Canonical(), back.Canonical())
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{"not an array", `{"vcalendar":[]}`, invalidJCal},
+		{"short property", `["vcalendar",[["version",{}]],[]]`, invalidJCal},
+		{"bad parameter", `["vcalendar",[["version",{"x":1},"text","2.0"]],[]]`, invalidJCal},
+		{"minimal", `["vcalendar",[],[]]`, nil},
+	}
+	for _, test := range tests {
+		if _, err := DecodeJCal([]byte(test.src)); err != test.err {
+			t.Errorf("\n%s:\nexpected: %v\ngot:      %v\n", test.name, test.err, err)
+		}
+	}
+	if _, err := EncodeJCal(Component{Name: "VEVENT", Fields: []Field{{Name: "SEQUENCE", Value: "two"}}}); err != invalidValue {
+		t.Errorf("\nbad INTEGER:\nexpected: %s\ngot:      %v\n", invalidValue, err)
+	}
+}
@@ -0,0 +1,283 @@
+package icalendar
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Conflict is a part of a component that both sides of a Merge changed, in
+// different ways. Path holds the keys of the components leading to it, from
+// the outermost, such as "VEVENT m1" or "VALARM a1". Property names the
+// property both sides changed, with Address telling which attendee for
+// ATTENDEE. It is empty when one side deleted a component the other changed.
+//
+// Base, Ours and Theirs hold the three versions of what conflicts: the
+// conflicting properties, in a component with nothing else, or the whole
+// component. The version a side deleted is the zero Component.
+type Conflict struct {
+	Path     []string
+	Property string
+	Address  string
+	Base     Component
+	Ours     Component
+	Theirs   Component
+}
+
+// Merges two versions of a component, ours and theirs, changed independently
+// since base. Properties are merged one name at a time, except ATTENDEEs,
+// which are merged one calendar user at a time with their PARTSTAT merged on
+// its own, so that replies from different attendees never conflict. Nested
+// components are matched up by their UID and RECURRENCE-ID, or TZID for
+// VTIMEZONEs, and merged in turn; a nested component without any is matched
+// only by identical content, its key then being a hash of it.
+//
+// A change made on one side only is kept. Changes made on both sides
+// conflict unless they agree; merged then keeps our version, and a Conflict
+// is reported for the caller to resolve. SEQUENCE, DTSTAMP and LAST-MODIFIED
+// never conflict: the highest, or latest, value is kept.
+func Merge(base, ours, theirs Component) (merged Component, conflicts []Conflict) {
+	m := merger{}
+	merged = m.component(nil, base, ours, theirs)
+	return merged, m.conflicts
+}
+
+type merger struct {
+	conflicts []Conflict
+}
+
+// Properties whose values only ever move forward, see RFC 5545 s. 3.8.7.
+var monotonicFields = map[string]bool{"SEQUENCE": true, "DTSTAMP": true, "LAST-MODIFIED": true}
+
+func (m *merger) component(path []string, base, ours, theirs Component) Component {
+	merged := Component{Name: ours.Name}
+	if merged.Name == "" {
+		merged.Name = theirs.Name
+	}
+	baseSlots, ourSlots, theirSlots := fieldSlots(base), fieldSlots(ours), fieldSlots(theirs)
+	for _, key := range slotOrder(ourSlots.order, theirSlots.order) {
+		b, o, t := baseSlots.fields[key], ourSlots.fields[key], theirSlots.fields[key]
+		name := strings.ToUpper(key)
+		if i := strings.IndexByte(key, ' '); i >= 0 {
+			name = strings.ToUpper(key[:i])
+		}
+		switch {
+		case monotonicFields[name] && len(o) > 0 && len(t) > 0:
+			if laterValue(t[0], o[0]) {
+				o = t
+			}
+			merged.Fields = append(merged.Fields, o...)
+		case name == "ATTENDEE" && len(o) == 1 && len(t) == 1:
+			merged.Fields = append(merged.Fields, m.attendee(path, merged.Name, b, o[0], t[0]))
+		default:
+			takeOurs, conflict := choose(fieldsText(b), fieldsText(o), fieldsText(t))
+			if conflict {
+				c := Conflict{Path: path, Property: name, Base: holding(merged.Name, b),
+					Ours: holding(merged.Name, o), Theirs: holding(merged.Name, t)}
+				if name == "ATTENDEE" {
+					c.Address = key[len(name)+1:]
+				}
+				m.conflicts = append(m.conflicts, c)
+			}
+			if takeOurs {
+				merged.Fields = append(merged.Fields, o...)
+			} else {
+				merged.Fields = append(merged.Fields, t...)
+			}
+		}
+	}
+
+	baseComps, ourComps, theirComps := componentSlots(base), componentSlots(ours), componentSlots(theirs)
+	for _, key := range slotOrder(ourComps.order, theirComps.order) {
+		b, inBase := baseComps.comps[key]
+		o, inOurs := ourComps.comps[key]
+		t, inTheirs := theirComps.comps[key]
+		if inOurs && inTheirs {
+			merged.Components = append(merged.Components, m.component(append(path[:len(path):len(path)], key), b, o, t))
+			continue
+		}
+		bText, oText, tText := "", "", ""
+		if inBase {
+			bText = componentText(b)
+		}
+		if inOurs {
+			oText = componentText(o)
+		}
+		if inTheirs {
+			tText = componentText(t)
+		}
+		takeOurs, conflict := choose(bText, oText, tText)
+		if conflict {
+			m.conflicts = append(m.conflicts, Conflict{Path: append(path[:len(path):len(path)], key), Base: b, Ours: o, Theirs: t})
+		}
+		if takeOurs && inOurs {
+			merged.Components = append(merged.Components, o)
+		} else if !takeOurs && inTheirs {
+			merged.Components = append(merged.Components, t)
+		}
+	}
+	return merged
+}
+
+// Merges the versions of an attendee both sides still have, taking PARTSTAT
+// and the rest of the property separately.
+func (m *merger) attendee(path []string, name string, base []Field, ours, theirs Field) Field {
+	var b Field
+	if len(base) == 1 {
+		b = base[0]
+	}
+	partstat := func(f Field) string { return scalarParam(f, "PARTSTAT") }
+	rest := func(f Field) string {
+		if f.Name == "" {
+			return ""
+		}
+		f.Params = otherParams(f, []string{"PARTSTAT"})
+		return f.String()
+	}
+	merged := theirs
+	takeOurs, restConflict := choose(rest(b), rest(ours), rest(theirs))
+	if takeOurs {
+		merged = ours
+	}
+	takeOurs, statusConflict := choose(partstat(b), partstat(ours), partstat(theirs))
+	status := partstat(theirs)
+	if takeOurs {
+		status = partstat(ours)
+	}
+	merged.Params = otherParams(merged, []string{"PARTSTAT"})
+	setScalarParam(merged, "PARTSTAT", status)
+	if restConflict || statusConflict {
+		m.conflicts = append(m.conflicts, Conflict{Path: path, Property: "ATTENDEE", Address: NormalizeAddress(ours.Value),
+			Base: holding(name, base), Ours: holding(name, []Field{ours}), Theirs: holding(name, []Field{theirs})})
+	}
+	return merged
+}
+
+// Wraps fields in a component for a Conflict.
+func holding(name string, fields []Field) Component {
+	if len(fields) == 0 {
+		return Component{}
+	}
+	return Component{Name: name, Fields: fields}
+}
+
+// Decides between three versions of something, given as text with the empty
+// string meaning absent: a change on one side wins, and changes on both
+// conflict unless they agree. Conflicts are settled in our favour.
+func choose(base, ours, theirs string) (takeOurs, conflict bool) {
+	switch {
+	case ours == theirs || theirs == base:
+		return true, false
+	case ours == base:
+		return false, false
+	}
+	return true, true
+}
+
+func laterValue(a, b Field) bool {
+	if strings.EqualFold(a.Name, "SEQUENCE") {
+		an, _ := strconv.Atoi(a.Value)
+		bn, _ := strconv.Atoi(b.Value)
+		return an > bn
+	}
+	at, _ := a.DateTime()
+	bt, _ := b.DateTime()
+	return at.After(bt)
+}
+
+// The fields of a component grouped by what Merge merges as a unit, in the
+// order the groups first appear.
+type fieldGroups struct {
+	order  []string
+	fields map[string][]Field
+}
+
+func fieldSlots(c Component) fieldGroups {
+	g := fieldGroups{fields: map[string][]Field{}}
+	for _, f := range c.Fields {
+		key := strings.ToUpper(f.Name)
+		if key == "ATTENDEE" {
+			key += " " + NormalizeAddress(f.Value)
+		}
+		if _, seen := g.fields[key]; !seen {
+			g.order = append(g.order, key)
+		}
+		g.fields[key] = append(g.fields[key], f)
+	}
+	return g
+}
+
+type componentGroups struct {
+	order []string
+	comps map[string]Component
+}
+
+func componentSlots(c Component) componentGroups {
+	g := componentGroups{comps: map[string]Component{}}
+	for _, child := range c.Components {
+		key := componentKey(child)
+		for n := 2; ; n++ {
+			if _, taken := g.comps[key]; !taken {
+				break
+			}
+			key = componentKey(child) + " #" + strconv.Itoa(n)
+		}
+		g.order = append(g.order, key)
+		g.comps[key] = child
+	}
+	return g
+}
+
+// Identifies a nested component across versions, see Merge.
+func componentKey(c Component) string {
+	name := strings.ToUpper(c.Name)
+	if name == "VTIMEZONE" {
+		return name + " " + c.Value("TZID")
+	}
+	uid, hasUID := c.Field("UID")
+	if !hasUID {
+		return name + " " + hashString(componentText(c))[:8]
+	}
+	key := name + " " + uid.Value
+	if rid, has := c.Field("RECURRENCE-ID"); has {
+		if t, err := rid.DateTime(); err == nil {
+			key += " " + t.UTC().Format(time.RFC3339)
+		} else {
+			key += " " + rid.Value
+		}
+	}
+	return key
+}
+
+// Lists the keys of both sides, ours in their order first, then those only
+// theirs has.
+func slotOrder(ours, theirs []string) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, order := range [][]string{ours, theirs} {
+		for _, key := range order {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func fieldsText(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		f.Name = strings.ToUpper(f.Name)
+		b.WriteString(f.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func componentText(c Component) string {
+	var buf bytes.Buffer
+	NewEncoder(&buf).Encode(c)
+	return buf.String()
+}
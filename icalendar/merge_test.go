@@ -0,0 +1,114 @@
+package icalendar
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Merge(t *testing.T) {
+	base := meeting(t, "SUMMARY:Planning", "SEQUENCE:1",
+		"BEGIN:VALARM", "UID:a1", "ACTION:DISPLAY", "TRIGGER:-PT5M", "END:VALARM")
+	edit := func(lines ...string) Component {
+		c := base
+		c.Components = append([]Component(nil), base.Components...)
+		event := decodeString(t, "BEGIN:VEVENT\r\n"+strings.Join(append(lines, ""), "\r\n")+"END:VEVENT\r\n")
+		for _, f := range event.Fields {
+			if f.Name != "ATTENDEE" {
+				c.Components[0].SetField(f)
+				continue
+			}
+			fields := append([]Field(nil), c.Components[0].Fields...)
+			for i := range fields {
+				if fields[i].Name == "ATTENDEE" && SameAddress(fields[i].Value, f.Value) {
+					fields[i] = f
+				}
+			}
+			c.Components[0].Fields = fields
+		}
+		c.Components[0].Components = append(c.Components[0].Components, event.Components...)
+		return c
+	}
+	override := "BEGIN:VEVENT\r\nUID:m1\r\nRECURRENCE-ID:20240102T090000Z\r\nDTSTART:20240102T100000Z\r\nEND:VEVENT\r\n"
+	withOverride := func(c Component) Component {
+		c.Components = append(append([]Component(nil), c.Components...), decodeString(t, override))
+		return c
+	}
+	withoutAlarm := func(c Component) Component {
+		c.Components = append([]Component(nil), c.Components...)
+		c.Components[0].Components = nil
+		return c
+	}
+	bob := func(c Component) string {
+		f, _ := findAttendee(c.Components[0], "mailto:bob@example.com")
+		return scalarParam(f, "PARTSTAT")
+	}
+	carol := func(c Component) string {
+		f, _ := findAttendee(c.Components[0], "mailto:carol@example.com")
+		return scalarParam(f, "PARTSTAT")
+	}
+
+	tests := []struct {
+		name      string
+		ours      Component
+		theirs    Component
+		conflicts []string
+		check     func(Component) bool
+	}{
+		{"disjoint properties", edit("SUMMARY:Ours"), edit("LOCATION:Theirs"), nil, func(c Component) bool {
+			return c.Components[0].Value("SUMMARY") == "Ours" && c.Components[0].Value("LOCATION") == "Theirs"
+		}},
+		{"same change", edit("SUMMARY:Both"), edit("SUMMARY:Both"), nil, func(c Component) bool {
+			return c.Components[0].Value("SUMMARY") == "Both"
+		}},
+		{"conflicting change", edit("SUMMARY:Ours"), edit("SUMMARY:Theirs"), []string{"VEVENT m1 SUMMARY"}, func(c Component) bool {
+			return c.Components[0].Value("SUMMARY") == "Ours"
+		}},
+		{"sequence", edit("SEQUENCE:2"), edit("SEQUENCE:3"), nil, func(c Component) bool {
+			return c.Components[0].Value("SEQUENCE") == "3"
+		}},
+		{"different attendees reply", edit("ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com"),
+			edit("ATTENDEE;PARTSTAT=DECLINED:mailto:Carol@Example.com"), nil, func(c Component) bool {
+				return bob(c) == "ACCEPTED" && carol(c) == "DECLINED"
+			}},
+		{"partstat and role", edit("ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com"),
+			edit("ATTENDEE;PARTSTAT=NEEDS-ACTION;ROLE=CHAIR:mailto:bob@example.com"), nil, func(c Component) bool {
+				f, _ := findAttendee(c.Components[0], "mailto:bob@example.com")
+				return bob(c) == "ACCEPTED" && scalarParam(f, "ROLE") == "CHAIR"
+			}},
+		{"conflicting partstat", edit("ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com"),
+			edit("ATTENDEE;PARTSTAT=DECLINED:mailto:bob@example.com"),
+			[]string{"VEVENT m1 ATTENDEE mailto:bob@example.com"}, func(c Component) bool { return bob(c) == "ACCEPTED" }},
+		{"alarms by UID", edit("BEGIN:VALARM", "UID:a2", "ACTION:DISPLAY", "TRIGGER:-PT1H", "END:VALARM"),
+			edit("BEGIN:VALARM", "UID:a3", "ACTION:AUDIO", "TRIGGER:-PT1M", "END:VALARM"), nil, func(c Component) bool {
+				return len(c.Components[0].Components) == 3
+			}},
+		{"alarm deleted", withoutAlarm(base), edit("SUMMARY:Theirs"), nil, func(c Component) bool {
+			return len(c.Components[0].Components) == 0 && c.Components[0].Value("SUMMARY") == "Theirs"
+		}},
+		{"override added", withOverride(base), edit("SUMMARY:Theirs"), nil, func(c Component) bool {
+			return len(c.Components) == 2 && c.Components[1].Value("RECURRENCE-ID") == "20240102T090000Z"
+		}},
+		{"deleted and changed", Component{Name: "VCALENDAR", Fields: base.Fields}, edit("SUMMARY:Theirs"),
+			[]string{"VEVENT m1"}, func(c Component) bool { return len(c.Components) == 0 }},
+	}
+	for _, test := range tests {
+		merged, conflicts := Merge(base, test.ours, test.theirs)
+		var got []string
+		for _, c := range conflicts {
+			got = append(got, strings.TrimSpace(strings.Join(c.Path, "/")+" "+c.Property+" "+c.Address))
+		}
+		if strings.Join(got, ", ") != strings.Join(test.conflicts, ", ") {
+			t.Errorf("\n%s:\nexpected: %q\ngot:      %q\n", test.name, test.conflicts, got)
+		}
+		if !test.check(merged) {
+			t.Errorf("\n%s: unexpected merge %#v\n", test.name, merged)
+		}
+	}
+
+	// Conflicts carry the three versions
+	_, conflicts := Merge(base, edit("SUMMARY:Ours"), edit("SUMMARY:Theirs"))
+	if len(conflicts) != 1 || conflicts[0].Base.Value("SUMMARY") != "Planning" ||
+		conflicts[0].Ours.Value("SUMMARY") != "Ours" || conflicts[0].Theirs.Value("SUMMARY") != "Theirs" {
+		t.Errorf("\nunexpected conflict %#v\n", conflicts)
+	}
+}
@@ -0,0 +1,464 @@
+package icalendar
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	FreqSecondly Frequency = "SECONDLY"
+	FreqMinutely           = "MINUTELY"
+	FreqHourly             = "HOURLY"
+	FreqDaily              = "DAILY"
+	FreqWeekly             = "WEEKLY"
+	FreqMonthly            = "MONTHLY"
+	FreqYearly             = "YEARLY"
+)
+
+// A WeekdayNum is an entry in a BYDAY list, such as -1SU for the last Sunday.
+// N is zero when no ordinal is given.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// A Recur is a parsed RECUR value, see RFC 5545 s. 3.3.10.
+type Recur struct {
+	Freq       Frequency
+	Interval   int
+	Count      int       // zero when unbounded by count
+	Until      time.Time // zero when unbounded by date
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByYearDay  []int
+	ByWeekNo   []int
+	ByMonth    []int
+	ByHour     []int
+	ByMinute   []int
+	BySecond   []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+	// UNTIL values without a trailing Z are reinterpreted in the zone of
+	// DTSTART during expansion.
+	untilFloating bool
+	untilDate     bool
+}
+
+var invalidRecur = errors.New("Invalid RECUR value")
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday,
+	"WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+func ParseRecur(val string) (r Recur, err error) {
+	r.Interval = 1
+	r.WeekStart = time.Monday
+	for _, part := range strings.Split(val, ";") {
+		eq := strings.IndexByte(part, '=')
+		if eq < 0 {
+			err = invalidRecur
+			return
+		}
+		key, v := strings.ToUpper(part[:eq]), strings.ToUpper(part[eq+1:])
+		switch key {
+		case "FREQ":
+			r.Freq = Frequency(v)
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(v); err != nil || r.Interval < 1 {
+				err = invalidRecur
+				return
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(v); err != nil || r.Count < 1 {
+				err = invalidRecur
+				return
+			}
+		case "UNTIL":
+			if r.Until, err = parseDateTime(v, time.UTC); err != nil {
+				return
+			}
+			r.untilDate = len(v) == len(dateLayout)
+			r.untilFloating = !strings.HasSuffix(v, "Z")
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				if len(day) < 2 {
+					err = invalidRecur
+					return
+				}
+				wd, has := weekdays[day[len(day)-2:]]
+				if !has {
+					err = invalidRecur
+					return
+				}
+				n := 0
+				if ord := day[:len(day)-2]; ord != "" {
+					if n, err = strconv.Atoi(ord); err != nil || n == 0 {
+						err = invalidRecur
+						return
+					}
+				}
+				r.ByDay = append(r.ByDay, WeekdayNum{n, wd})
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseIntList(v, 31, true)
+		case "BYYEARDAY":
+			r.ByYearDay, err = parseIntList(v, 366, true)
+		case "BYWEEKNO":
+			r.ByWeekNo, err = parseIntList(v, 53, true)
+		case "BYMONTH":
+			r.ByMonth, err = parseIntList(v, 12, false)
+		case "BYHOUR":
+			r.ByHour, err = parseIntList(v, 23, false)
+		case "BYMINUTE":
+			r.ByMinute, err = parseIntList(v, 59, false)
+		case "BYSECOND":
+			r.BySecond, err = parseIntList(v, 60, false)
+		case "BYSETPOS":
+			r.BySetPos, err = parseIntList(v, 366, true)
+		case "WKST":
+			wd, has := weekdays[v]
+			if !has {
+				err = invalidRecur
+				return
+			}
+			r.WeekStart = wd
+		default:
+			if !strings.HasPrefix(key, "X-") {
+				err = invalidRecur
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	switch r.Freq {
+	case FreqSecondly, FreqMinutely, FreqHourly, FreqDaily, FreqWeekly,
+		FreqMonthly, FreqYearly:
+	default:
+		err = invalidRecur
+	}
+	if r.Count != 0 && !r.Until.IsZero() {
+		err = invalidRecur
+	}
+	return
+}
+
+func parseIntList(val string, max int, signed bool) (list []int, err error) {
+	for _, s := range strings.Split(val, ",") {
+		var n int
+		if n, err = strconv.Atoi(s); err != nil {
+			err = invalidRecur
+			return
+		}
+		if n > max || n < -max || (n < 0 && !signed) || (n == 0 && signed) {
+			err = invalidRecur
+			return
+		}
+		list = append(list, n)
+	}
+	return
+}
+
+// Expansion gives up after this many days without an instance, which guards
+// against rules that can never match, like BYMONTHDAY=30 with BYMONTH=2. The
+// rarest rules that can match, for February 29th, skip eight years across
+// some centuries. Rules with long intervals are given at least
+// minBarrenPeriods periods as well.
+const (
+	maxBarrenDays    = 366 * 9
+	minBarrenPeriods = 8
+)
+
+// Returns the start times of every instance of the rule that begins before
+// to, in order. dtstart is always the first instance, as RFC 5545 requires,
+// and counts towards COUNT. Times of day are taken from dtstart's wall clock in
+// its own location, so instances keep their local time across DST changes.
+func (r Recur) Expand(dtstart, to time.Time) []time.Time {
+	until := r.Until
+	if !until.IsZero() && r.untilFloating {
+		until = time.Date(until.Year(), until.Month(), until.Day(),
+			until.Hour(), until.Minute(), until.Second(), 0, dtstart.Location())
+	}
+	if !until.IsZero() && r.untilDate {
+		until = until.Add(24*time.Hour - time.Nanosecond)
+	}
+	if r.Interval < 1 {
+		r.Interval = 1
+	}
+	if !dtstart.Before(to) || (!until.IsZero() && dtstart.After(until)) {
+		return nil
+	}
+	times := []time.Time{dtstart}
+	last, barren := dtstart, 0
+	for period := 0; ; period++ {
+		candidates, periodStart := r.candidates(dtstart, period)
+		if !periodStart.Before(to) ||
+			barren > minBarrenPeriods && periodStart.Sub(last) > maxBarrenDays*24*time.Hour {
+			break
+		}
+		barren++
+		for _, t := range candidates {
+			if !t.After(dtstart) {
+				continue
+			}
+			if !t.Before(to) || (!until.IsZero() && t.After(until)) {
+				return times
+			}
+			times = append(times, t)
+			last, barren = t, 0
+			if r.Count != 0 && len(times) >= r.Count {
+				return times
+			}
+		}
+	}
+	return times
+}
+
+// Returns the sorted instances generated by the nth period of the rule,
+// counting from the one containing dtstart, along with the start of that
+// period. Rules more frequent than daily are taken a day at a time instead,
+// so that days they can't match are skipped cheaply.
+func (r Recur) candidates(dtstart time.Time, period int) (times []time.Time, periodStart time.Time) {
+	loc := dtstart.Location()
+	y, m, d := dtstart.Date()
+	n := period * r.Interval
+	var days []time.Time
+	switch r.Freq {
+	case FreqYearly:
+		first := time.Date(y+n, 1, 1, 0, 0, 0, 0, loc)
+		for day := first; day.Year() == y+n; day = day.AddDate(0, 0, 1) {
+			days = append(days, day)
+		}
+		periodStart = first
+	case FreqMonthly:
+		first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, loc)
+		for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+			days = append(days, day)
+		}
+		periodStart = first
+	case FreqWeekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		first := time.Date(y, m, d-offset+7*n, 0, 0, 0, 0, loc)
+		for i := 0; i < 7; i++ {
+			days = append(days, first.AddDate(0, 0, i))
+		}
+		periodStart = first
+	case FreqDaily:
+		periodStart = time.Date(y, m, d+n, 0, 0, 0, 0, loc)
+		days = []time.Time{periodStart}
+	default:
+		periodStart = time.Date(y, m, d+period, 0, 0, 0, 0, loc)
+		if r.matchDay(periodStart, dtstart) {
+			times = r.subDaily(dtstart, periodStart)
+		}
+		return
+	}
+	hours := r.ByHour
+	if len(hours) == 0 {
+		hours = []int{dtstart.Hour()}
+	}
+	minutes := r.ByMinute
+	if len(minutes) == 0 {
+		minutes = []int{dtstart.Minute()}
+	}
+	seconds := r.BySecond
+	if len(seconds) == 0 {
+		seconds = []int{dtstart.Second()}
+	}
+	for _, day := range days {
+		if !r.matchDay(day, dtstart) {
+			continue
+		}
+		for _, h := range hours {
+			for _, mi := range minutes {
+				for _, s := range seconds {
+					times = append(times, time.Date(day.Year(), day.Month(),
+						day.Day(), h, mi, s, 0, loc))
+				}
+			}
+		}
+	}
+	return r.setPos(times), periodStart
+}
+
+// Returns the instances of a rule more frequent than daily that fall on day.
+// Each period, an hour, minute or second, is expanded by the parts finer than
+// it (BYMINUTE and BYSECOND for HOURLY, BYSECOND for MINUTELY) and limited by
+// the others, as RFC 5545 s. 3.3.10 specifies.
+func (r Recur) subDaily(dtstart, day time.Time) (times []time.Time) {
+	var unit time.Duration
+	switch r.Freq {
+	case FreqHourly:
+		unit = time.Hour
+	case FreqMinutely:
+		unit = time.Minute
+	default:
+		unit = time.Second
+	}
+	step := time.Duration(r.Interval) * unit
+	minutes := r.ByMinute
+	if len(minutes) == 0 || r.Freq != FreqHourly {
+		minutes = []int{dtstart.Minute()}
+	}
+	seconds := r.BySecond
+	if len(seconds) == 0 || r.Freq == FreqSecondly {
+		seconds = []int{dtstart.Second()}
+	}
+	start := dtstart
+	if day.After(dtstart) {
+		start = dtstart.Add((day.Sub(dtstart) + step - 1) / step * step)
+	}
+	next := day.AddDate(0, 0, 1)
+	for p := start; p.Before(next); p = p.Add(step) {
+		var set []time.Time
+		switch r.Freq {
+		case FreqHourly:
+			hour := p.Add(-time.Duration(p.Minute())*time.Minute - time.Duration(p.Second())*time.Second)
+			for _, mi := range minutes {
+				for _, s := range seconds {
+					set = append(set, hour.Add(time.Duration(mi)*time.Minute+time.Duration(s)*time.Second))
+				}
+			}
+		case FreqMinutely:
+			minute := p.Add(-time.Duration(p.Second()) * time.Second)
+			for _, s := range seconds {
+				set = append(set, minute.Add(time.Duration(s)*time.Second))
+			}
+		default:
+			set = []time.Time{p}
+		}
+		var matching []time.Time
+		for _, t := range set {
+			if r.matchTime(t) {
+				matching = append(matching, t)
+			}
+		}
+		times = append(times, r.setPos(matching)...)
+	}
+	return
+}
+
+// Sorts the instances of one period and picks those BYSETPOS asks for.
+func (r Recur) setPos(times []time.Time) []time.Time {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	if len(r.BySetPos) == 0 {
+		return times
+	}
+	var selected []time.Time
+	for i, t := range times {
+		for _, pos := range r.BySetPos {
+			if pos == i+1 || pos == i-len(times) {
+				selected = append(selected, t)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func (r Recur) matchDay(day, dtstart time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsInt(r.ByMonth, int(day.Month()), 0) {
+		return false
+	}
+	if len(r.ByYearDay) > 0 {
+		daysInYear := time.Date(day.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		if !containsInt(r.ByYearDay, day.YearDay(), daysInYear) {
+			return false
+		}
+	}
+	if len(r.ByWeekNo) > 0 {
+		if week, weeks := weekNo(day, r.WeekStart); !containsInt(r.ByWeekNo, week, weeks) {
+			return false
+		}
+	}
+	if len(r.ByMonthDay) > 0 && !containsInt(r.ByMonthDay, day.Day(), daysIn(day)) {
+		return false
+	}
+	if len(r.ByDay) > 0 && !r.matchWeekday(day) {
+		return false
+	}
+	if len(r.ByYearDay) > 0 || len(r.ByWeekNo) > 0 || len(r.ByMonthDay) > 0 || len(r.ByDay) > 0 {
+		return true
+	}
+	switch r.Freq {
+	case FreqYearly:
+		return day.Day() == dtstart.Day() &&
+			(len(r.ByMonth) > 0 || day.Month() == dtstart.Month())
+	case FreqMonthly:
+		return day.Day() == dtstart.Day()
+	case FreqWeekly:
+		return day.Weekday() == dtstart.Weekday()
+	}
+	return true
+}
+
+func (r Recur) matchWeekday(day time.Time) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day != day.Weekday() {
+			continue
+		}
+		if wd.N == 0 {
+			return true
+		}
+		// The ordinal counts within the month for MONTHLY rules and YEARLY
+		// rules restricted by BYMONTH, and within the year otherwise.
+		var nth, fromEnd int
+		if r.Freq == FreqMonthly || (r.Freq == FreqYearly && len(r.ByMonth) > 0) {
+			nth = (day.Day()-1)/7 + 1
+			fromEnd = -((daysIn(day)-day.Day())/7 + 1)
+		} else if r.Freq == FreqYearly {
+			daysInYear := time.Date(day.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+			nth = (day.YearDay()-1)/7 + 1
+			fromEnd = -((daysInYear-day.YearDay())/7 + 1)
+		} else {
+			return true
+		}
+		if wd.N == nth || wd.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Recur) matchTime(t time.Time) bool {
+	return (len(r.ByHour) == 0 || containsInt(r.ByHour, t.Hour(), 0)) &&
+		(len(r.ByMinute) == 0 || containsInt(r.ByMinute, t.Minute(), 0)) &&
+		(len(r.BySecond) == 0 || containsInt(r.BySecond, t.Second(), 0))
+}
+
+// Reports whether n is in list, where negative entries count back from
+// length, so that -1 matches length.
+func containsInt(list []int, n, length int) bool {
+	for _, x := range list {
+		if x == n || (x < 0 && length+x+1 == n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the week day falls in, with weeks starting on wkst and numbered so
+// that week 1 is the first with at least four days in its year, along with
+// the number of weeks in that year. Days around New Year may fall in a week of
+// the year before or after.
+func weekNo(day time.Time, wkst time.Weekday) (week, weeks int) {
+	offset := (int(day.Weekday()) - int(wkst) + 7) % 7
+	fourth := time.Date(day.Year(), day.Month(), day.Day()-offset+3, 0, 0, 0, 0, time.UTC)
+	week = (fourth.YearDay()-1)/7 + 1
+	// December 28th is always in the last week of its year
+	dec28 := time.Date(fourth.Year(), 12, 28, 0, 0, 0, 0, time.UTC)
+	offset = (int(dec28.Weekday()) - int(wkst) + 7) % 7
+	weeks = (dec28.AddDate(0, 0, 3-offset).YearDay()-1)/7 + 1
+	return
+}
+
+func daysIn(day time.Time) int {
+	return time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
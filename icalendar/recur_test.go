@@ -0,0 +1,131 @@
+package icalendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Expand(t *testing.T) {
+	type example struct {
+		dtstart string
+		rule    string
+		to      string
+		result  string
+	}
+	// Mostly from RFC 5545 s. 3.8.5.3, in America/New_York.
+	testCases := []example{
+		{"19970902T090000", "FREQ=DAILY;COUNT=10", "20000101T000000",
+			"0902 0903 0904 0905 0906 0907 0908 0909 0910 0911"},
+		{"19970902T090000", "FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH", "20000101T000000",
+			"0902 0904 0909 0911 0916 0918 0923 0925 0930 1002"},
+		{"19970905T090000", "FREQ=MONTHLY;COUNT=10;BYDAY=1FR", "20000101T000000",
+			"0905 1003 1107 1205 0102 0206 0306 0403 0501 0605"},
+		{"19970930T090000", "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "19980301T000000",
+			"0930 1031 1128 1231 0130 0227"},
+		{"19970610T090000", "FREQ=YEARLY;COUNT=4;BYMONTH=6,7", "20000101T000000",
+			"0610 0710 0610 0710"},
+		{"19970131T090000", "FREQ=MONTHLY;COUNT=4", "20000101T000000",
+			"0131 0331 0531 0731"},
+		{"19970130T090000", "FREQ=MONTHLY;COUNT=3;BYMONTHDAY=-1", "20000101T000000",
+			"0130 0131 0228"},
+		{"19970902T090000", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", "19971001T000000",
+			"0902 0916 0930"},
+		// Crosses the end of daylight saving time
+		{"19971025T090000", "FREQ=DAILY;COUNT=3", "20000101T000000",
+			"1025 1026 1027"},
+		{"19970902T090000", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", "20000101T000000",
+			"0902"},
+		{"19970512T090000", "FREQ=YEARLY;BYWEEKNO=20;BYDAY=MO", "20000101T000000",
+			"0512 0511 0517"},
+		// Week 1 of 1998 starts on Monday, December 29th 1997
+		{"19970101T090000", "FREQ=YEARLY;COUNT=3;BYWEEKNO=1;BYDAY=MO", "20010101T000000",
+			"0101 1229 0104"},
+		// No February 29th between 2096 and 2104
+		{"20960229T090000", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "21050101T000000",
+			"0229 0229"},
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+	for _, testCase := range testCases {
+		r, err := ParseRecur(testCase.rule)
+		if err != nil {
+			t.Errorf("\nunexpected error in case %#v:\n%s\n", testCase.rule, err)
+			continue
+		}
+		dtstart, _ := parseDateTime(testCase.dtstart, ny)
+		to, _ := parseDateTime(testCase.to, ny)
+		var got []string
+		for _, inst := range r.Expand(dtstart, to) {
+			if inst.Hour() != 9 {
+				t.Errorf("\nin case %#v: %s is not at 9am local time\n",
+					testCase.rule, inst)
+			}
+			got = append(got, inst.Format("0102"))
+		}
+		if strings.Join(got, " ") != testCase.result {
+			t.Errorf("\nin case %#v:\nexpected: %s\ngot:      %s\n",
+				testCase.rule, testCase.result, strings.Join(got, " "))
+		}
+	}
+}
+
+func Test_Expand_subDaily(t *testing.T) {
+	testCases := []struct {
+		dtstart string
+		rule    string
+		result  string
+	}{
+		{"19970902T100000", "FREQ=MINUTELY;BYHOUR=9;COUNT=3",
+			"0902T1000 0903T0900 0903T0901"},
+		{"19970902T091500", "FREQ=HOURLY;BYMINUTE=0,30;COUNT=4",
+			"0902T0915 0902T0930 0902T1000 0902T1030"},
+		{"19970902T090000", "FREQ=MINUTELY;INTERVAL=20;BYHOUR=9,16;COUNT=5",
+			"0902T0900 0902T0920 0902T0940 0902T1600 0902T1620"},
+		{"19970902T090000", "FREQ=HOURLY;INTERVAL=3;UNTIL=19970902T170000Z",
+			"0902T0900 0902T1200"},
+		{"19970902T090000", "FREQ=HOURLY;BYDAY=SA;BYHOUR=7;BYMINUTE=15,45;BYSETPOS=-1;COUNT=3",
+			"0902T0900 0906T0745 0913T0745"},
+		{"19970902T090000", "FREQ=MINUTELY;BYMONTH=2;BYMONTHDAY=30",
+			"0902T0900"},
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+	to := time.Date(2100, 1, 1, 0, 0, 0, 0, ny)
+	for _, testCase := range testCases {
+		r, err := ParseRecur(testCase.rule)
+		if err != nil {
+			t.Errorf("\nunexpected error in case %#v:\n%s\n", testCase.rule, err)
+			continue
+		}
+		dtstart, _ := parseDateTime(testCase.dtstart, ny)
+		var got []string
+		for _, inst := range r.Expand(dtstart, to) {
+			got = append(got, inst.Format("0102T1504"))
+		}
+		if strings.Join(got, " ") != testCase.result {
+			t.Errorf("\nin case %#v:\nexpected: %s\ngot:      %s\n",
+				testCase.rule, testCase.result, strings.Join(got, " "))
+		}
+	}
+}
+
+func Test_ParseRecur(t *testing.T) {
+	testCases := map[string]error{
+		"FREQ=DAILY":                          nil,
+		"FREQ=WEEKLY;BYDAY=-1SU,MO;X-FOO=bar": nil,
+		"FREQ=FORTNIGHTLY":                    invalidRecur,
+		"BYDAY=MO":                            invalidRecur,
+		"FREQ=DAILY;COUNT=0":                  invalidRecur,
+		"FREQ=DAILY;COUNT=2;UNTIL=19970101":   invalidRecur,
+		"FREQ=MONTHLY;BYMONTHDAY=0":           invalidRecur,
+		"FREQ=MONTHLY;BYDAY=0MO":              invalidRecur,
+		"FREQ=YEARLY;BYWEEKNO=20":             nil,
+		"FREQ=YEARLY;BYWEEKNO=54":             invalidRecur,
+		"FREQ=DAILY;UNTIL=never":              invalidDateTime,
+	}
+	for rule, expectedErr := range testCases {
+		if _, err := ParseRecur(rule); err != expectedErr {
+			t.Errorf("\nerror mismatch in case %#v:\nexpected: %v\ngot:      %v\n",
+				rule, expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package icalendar
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	noSuchAlarm     = errors.New("Component has no VALARM with that UID")
+	missingAlarmUID = errors.New("VALARM without a UID can't be addressed")
+)
+
+// Marks the VALARM with the given UID in an event or todo as acknowledged at
+// the given time, per RFC 9074 s. 6. Snooze alarms pointing at it are removed,
+// since dismissing an alarm dismisses its snoozes too. Acknowledging a snooze
+// alarm acknowledges the alarm it snoozes as well.
+func AcknowledgeAlarm(c *Component, uid string, at time.Time) error {
+	alarm, err := findAlarm(*c, uid)
+	if err != nil {
+		return err
+	}
+	if alarm.SnoozeOf != "" {
+		uid = alarm.SnoozeOf
+	}
+	removeSnoozes(c, uid)
+	return setAcknowledged(c, uid, at)
+}
+
+// Snoozes the VALARM with the given UID until the given time, per RFC 9074
+// s. 7. The original alarm is acknowledged as of now, and a new alarm with an
+// absolute trigger and a RELATED-TO;RELTYPE=SNOOZE pointing back at it is
+// added, replacing any earlier snooze of the same alarm. Snoozing a snooze
+// alarm snoozes the alarm it belongs to. Returns the UID of the new alarm.
+func SnoozeAlarm(c *Component, uid string, now, until time.Time) (string, error) {
+	alarm, err := findAlarm(*c, uid)
+	if err != nil {
+		return "", err
+	}
+	if alarm.SnoozeOf != "" {
+		uid = alarm.SnoozeOf
+	}
+	var original Component
+	for _, child := range c.ComponentsNamed("VALARM") {
+		if child.Value("UID") == uid {
+			original = child
+		}
+	}
+	if original.Name == "" {
+		return "", noSuchAlarm
+	}
+	removeSnoozes(c, uid)
+	if err := setAcknowledged(c, uid, now); err != nil {
+		return "", err
+	}
+	snooze := Component{Name: "VALARM"}
+	snoozeUID := newUID()
+	snooze.SetField(Field{Name: "UID", Value: snoozeUID})
+	snooze.SetField(Field{
+		Name:   "RELATED-TO",
+		Params: map[string][]string{"RELTYPE": {RTSnooze}},
+		Value:  uid,
+	})
+	snooze.SetField(Field{
+		Name:   "TRIGGER",
+		Params: map[string][]string{"VALUE": {DTDateTime}},
+		Value:  formatDateTime(until),
+	})
+	for _, name := range []string{"ACTION", "DESCRIPTION", "SUMMARY", "ATTACH", "ATTENDEE"} {
+		snooze.Fields = append(snooze.Fields, original.FieldsNamed(name)...)
+	}
+	c.Components = append(c.Components, snooze)
+	return snoozeUID, nil
+}
+
+// Alarms are addressed by UID, so those without one can't be acknowledged or
+// snoozed, nor could a snooze point back at them.
+func findAlarm(c Component, uid string) (Alarm, error) {
+	if uid == "" {
+		return Alarm{}, missingAlarmUID
+	}
+	for _, child := range c.ComponentsNamed("VALARM") {
+		if child.Value("UID") == uid {
+			return ParseAlarm(child)
+		}
+	}
+	return Alarm{}, noSuchAlarm
+}
+
+func setAcknowledged(c *Component, uid string, at time.Time) error {
+	children := make([]Component, len(c.Components))
+	copy(children, c.Components)
+	for i, child := range children {
+		if strings.EqualFold(child.Name, "VALARM") && child.Value("UID") == uid {
+			child.SetField(Field{Name: "ACKNOWLEDGED", Value: formatDateTime(at)})
+			children[i] = child
+			c.Components = children
+			return nil
+		}
+	}
+	return noSuchAlarm
+}
+
+func removeSnoozes(c *Component, uid string) {
+	var children []Component
+	for _, child := range c.Components {
+		if strings.EqualFold(child.Name, "VALARM") {
+			if alarm, err := ParseAlarm(child); err == nil && alarm.SnoozeOf == uid {
+				continue
+			}
+		}
+		children = append(children, child)
+	}
+	c.Components = children
+}
+
+// Generates a random (version 4) UUID for use as a UID.
+func newUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,88 @@
+package icalendar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SnoozeAlarm(t *testing.T) {
+	event := decodeString(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART:20240101T090000Z\r\n"+
+		"BEGIN:VALARM\r\n"+
+		"UID:a1\r\n"+
+		"ACTION:DISPLAY\r\n"+
+		"DESCRIPTION:Standup\r\n"+
+		"TRIGGER:-PT15M\r\n"+
+		"END:VALARM\r\n"+
+		"END:VEVENT\r\n")
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC)
+	}
+	day := []time.Time{at(0, 0), at(23, 0)}
+
+	snoozeUID, err := SnoozeAlarm(&event, "a1", at(8, 46), at(8, 55))
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	firings, _ := AlarmTimes(event, nil, day[0], day[1])
+	if len(firings) != 1 || !firings[0].At.Equal(at(8, 55)) ||
+		firings[0].Alarm.UID != snoozeUID || firings[0].Alarm.SnoozeOf != "a1" ||
+		firings[0].Alarm.Description != "Standup" {
+		t.Fatalf("\nexpected only the snooze to fire, got %#v\n", firings)
+	}
+
+	// Snoozing the snooze replaces it
+	if _, err := SnoozeAlarm(&event, snoozeUID, at(8, 56), at(9, 0)); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if alarms := event.ComponentsNamed("VALARM"); len(alarms) != 2 {
+		t.Errorf("\nexpected the original and one snooze, got %#v\n", alarms)
+	}
+	firings, _ = AlarmTimes(event, nil, day[0], day[1])
+	if len(firings) != 1 || !firings[0].At.Equal(at(9, 0)) {
+		t.Errorf("\nexpected the snooze to fire at 9:00, got %#v\n", firings)
+	}
+
+	if err := AcknowledgeAlarm(&event, "a1", at(9, 1)); err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if alarms := event.ComponentsNamed("VALARM"); len(alarms) != 1 {
+		t.Errorf("\nexpected the snooze to be removed, got %#v\n", alarms)
+	}
+	if firings, _ = AlarmTimes(event, nil, day[0], day[1]); len(firings) != 0 {
+		t.Errorf("\nexpected nothing to fire, got %#v\n", firings)
+	}
+	if err := AcknowledgeAlarm(&event, "nope", at(9, 1)); err != noSuchAlarm {
+		t.Errorf("\nexpected noSuchAlarm, got %v\n", err)
+	}
+
+	anonymous := decodeString(t, "BEGIN:VEVENT\r\nDTSTART:20240101T090000Z\r\n"+
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\nEND:VEVENT\r\n")
+	if err := AcknowledgeAlarm(&anonymous, "", at(9, 1)); err != missingAlarmUID {
+		t.Errorf("\nexpected missingAlarmUID, got %v\n", err)
+	}
+	if _, err := SnoozeAlarm(&anonymous, "", at(9, 1), at(9, 5)); err != missingAlarmUID {
+		t.Errorf("\nexpected missingAlarmUID, got %v\n", err)
+	}
+	if _, has := anonymous.Components[0].Field("ACKNOWLEDGED"); has || len(anonymous.Components) != 1 {
+		t.Errorf("\nalarm without a UID was modified: %#v\n", anonymous.Components)
+	}
+}
+
+func Test_ParseAlarm_extensions(t *testing.T) {
+	alarm, err := ParseAlarm(decodeString(t, "BEGIN:VALARM\r\n"+
+		"UID:x\r\n"+
+		"ACTION:DISPLAY\r\n"+
+		"TRIGGER:-PT5M\r\n"+
+		"ACKNOWLEDGED:20240101T085600Z\r\n"+
+		"DEFAULT-ALARM:TRUE\r\n"+
+		"PROXIMITY:ARRIVE\r\n"+
+		"END:VALARM\r\n"))
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if alarm.UID != "x" || !alarm.DefaultAlarm || alarm.Proximity != PXArrive ||
+		!alarm.Acknowledged.Equal(time.Date(2024, 1, 1, 8, 56, 0, 0, time.UTC)) {
+		t.Errorf("\nextensions not parsed: %#v\n", alarm)
+	}
+}
@@ -0,0 +1,245 @@
+package icalendar
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	invalidDateTime = errors.New("Invalid DATE or DATE-TIME value")
+	invalidDuration = errors.New("Invalid DURATION value")
+	invalidPeriod   = errors.New("Invalid PERIOD value")
+)
+
+// A Period is a span of time, see RFC 5545 s. 3.3.9. Periods given as a start
+// and a duration are converted to explicit ends when parsed.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+)
+
+// Reports whether the field holds a DATE rather than a DATE-TIME, either
+// because it says so with VALUE=DATE or because the value is too short to
+// carry a time.
+func (f Field) IsDate() bool {
+	return f.DataType() == DTDate || len(f.Value) == len(dateLayout)
+}
+
+// Parses a DATE or DATE-TIME value. Times with a trailing Z are UTC; others are
+// interpreted in the zone named by TZID. Floating times, which have neither,
+// are interpreted as UTC. Use DateTimeIn to pick a different zone for them.
+func (f Field) DateTime() (time.Time, error) {
+	return f.DateTimeIn(time.UTC)
+}
+
+func (f Field) DateTimeIn(floating *time.Location) (time.Time, error) {
+	return parseDateTime(f.Value, f.location(floating))
+}
+
+// Returns the zone the field's local times are in: the one named by TZID, or
+// floating if there is none.
+func (f Field) location(floating *time.Location) *time.Location {
+	if _, has := f.Params["TZID"]; has {
+		return f.TimeZone()
+	}
+	return floating
+}
+
+func parseDateTime(val string, loc *time.Location) (time.Time, error) {
+	switch {
+	case len(val) == len(dateLayout):
+		t, err := time.ParseInLocation(dateLayout, val, loc)
+		if err != nil {
+			return t, invalidDateTime
+		}
+		return t, nil
+	case len(val) == len(dateTimeLayout)+1 && val[len(val)-1] == 'Z':
+		t, err := time.ParseInLocation(dateTimeLayout, val[:len(val)-1], time.UTC)
+		if err != nil {
+			return t, invalidDateTime
+		}
+		return t, nil
+	case len(val) == len(dateTimeLayout):
+		t, err := time.ParseInLocation(dateTimeLayout, val, loc)
+		if err != nil {
+			return t, invalidDateTime
+		}
+		return t, nil
+	}
+	return time.Time{}, invalidDateTime
+}
+
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout) + "Z"
+}
+
+// Returns the value of a TEXT field with its backslash escapes resolved, see
+// RFC 5545 s. 3.3.11.
+func (f Field) Text() string {
+	if !strings.Contains(f.Value, `\`) {
+		return f.Value
+	}
+	var b strings.Builder
+	for i := 0; i < len(f.Value); i++ {
+		c := f.Value[i]
+		if c == '\\' && i+1 < len(f.Value) {
+			i++
+			c = f.Value[i]
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// A Duration is a DURATION value, see RFC 5545 s. 3.3.6. Days and weeks are
+// nominal, lasting 23 or 25 hours across a daylight saving change, so they
+// are kept apart from the exact hours, minutes and seconds. Weeks count as
+// seven days.
+type Duration struct {
+	Days int
+	Time time.Duration
+}
+
+// Returns the time the duration after t, adding the days in t's zone.
+func (d Duration) From(t time.Time) time.Time {
+	return t.AddDate(0, 0, d.Days).Add(d.Time)
+}
+
+func (f Field) Duration() (Duration, error) {
+	return parseDuration(f.Value)
+}
+
+func parseDuration(val string) (d Duration, err error) {
+	neg := false
+	if len(val) > 0 && (val[0] == '+' || val[0] == '-') {
+		neg = val[0] == '-'
+		val = val[1:]
+	}
+	if len(val) < 2 || val[0] != 'P' {
+		err = invalidDuration
+		return
+	}
+	val = val[1:]
+	// At least one element must follow P, and T when there is one
+	inTime, elems := false, 0
+	for len(val) > 0 {
+		if val[0] == 'T' {
+			if inTime {
+				err = invalidDuration
+				return
+			}
+			inTime, elems = true, 0
+			val = val[1:]
+			continue
+		}
+		i := 0
+		for i < len(val) && val[i] >= '0' && val[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(val) {
+			err = invalidDuration
+			return
+		}
+		n, convErr := strconv.Atoi(val[:i])
+		if convErr != nil {
+			err = invalidDuration
+			return
+		}
+		switch unit := val[i]; {
+		case unit == 'W' && !inTime:
+			d.Days += n * 7
+		case unit == 'D' && !inTime:
+			d.Days += n
+		case unit == 'H' && inTime:
+			d.Time += time.Duration(n) * time.Hour
+		case unit == 'M' && inTime:
+			d.Time += time.Duration(n) * time.Minute
+		case unit == 'S' && inTime:
+			d.Time += time.Duration(n) * time.Second
+		default:
+			err = invalidDuration
+			return
+		}
+		val = val[i+1:]
+		elems++
+	}
+	if elems == 0 {
+		err = invalidDuration
+		return
+	}
+	if neg {
+		d.Days, d.Time = -d.Days, -d.Time
+	}
+	return
+}
+
+func formatDuration(d Duration) string {
+	sign := ""
+	if d.Days < 0 || d.Days == 0 && d.Time < 0 {
+		sign = "-"
+		d.Days, d.Time = -d.Days, -d.Time
+	}
+	if d.Days == 0 && d.Time == 0 {
+		return "PT0S"
+	}
+	out := sign + "P"
+	if d.Days > 0 {
+		if d.Days%7 == 0 && d.Time == 0 {
+			return out + strconv.Itoa(d.Days/7) + "W"
+		}
+		out += strconv.Itoa(d.Days) + "D"
+	}
+	t := d.Time
+	if t == 0 {
+		return out
+	}
+	out += "T"
+	if h := t / time.Hour; h > 0 {
+		out += strconv.Itoa(int(h)) + "H"
+		t -= h * time.Hour
+	}
+	if m := t / time.Minute; m > 0 {
+		out += strconv.Itoa(int(m)) + "M"
+		t -= m * time.Minute
+	}
+	if s := t / time.Second; s > 0 {
+		out += strconv.Itoa(int(s)) + "S"
+	}
+	return out
+}
+
+func parsePeriod(val string, loc *time.Location) (p Period, err error) {
+	slash := strings.IndexByte(val, '/')
+	if slash < 0 {
+		err = invalidPeriod
+		return
+	}
+	if p.Start, err = parseDateTime(val[:slash], loc); err != nil {
+		return
+	}
+	end := val[slash+1:]
+	if len(end) > 0 && (end[0] == 'P' || end[0] == '+' || end[0] == '-') {
+		var d Duration
+		if d, err = parseDuration(end); err != nil {
+			return
+		}
+		p.End = d.From(p.Start)
+		return
+	}
+	p.End, err = parseDateTime(end, loc)
+	return
+}
+
+func formatPeriod(p Period) string {
+	return formatDateTime(p.Start) + "/" + formatDateTime(p.End)
+}
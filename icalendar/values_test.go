@@ -0,0 +1,97 @@
+package icalendar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseDuration(t *testing.T) {
+	testCases := map[string]interface{}{
+		"PT15M":        Duration{Time: 15 * time.Minute},
+		"-PT15M":       Duration{Time: -15 * time.Minute},
+		"+P1D":         Duration{Days: 1},
+		"P1W":          Duration{Days: 7},
+		"-P1DT12H":     Duration{Days: -1, Time: -12 * time.Hour},
+		"P15DT5H0M20S": Duration{Days: 15, Time: 5*time.Hour + 20*time.Second},
+		"PT1H30M":      Duration{Time: 90 * time.Minute},
+		"P":            invalidDuration,
+		"PT":           invalidDuration,
+		"P1DT":         invalidDuration,
+		"P1H":          invalidDuration,
+		"PT1D":         invalidDuration,
+		"1D":           invalidDuration,
+		"P1DT2HT3M":    invalidDuration,
+	}
+	for val, expected := range testCases {
+		d, err := parseDuration(val)
+		switch expected := expected.(type) {
+		case Duration:
+			if err != nil || d != expected {
+				t.Errorf("\nin case %#v:\nexpected: %+v\ngot:      %+v (%v)\n",
+					val, expected, d, err)
+			} else if back, _ := parseDuration(formatDuration(d)); back != d {
+				t.Errorf("\nin case %#v: %s does not round trip\n",
+					val, formatDuration(d))
+			}
+		case error:
+			if err != expected {
+				t.Errorf("\nerror mismatch in case %#v:\nexpected: %s\ngot:      %v\n",
+					val, expected, err)
+			}
+		}
+	}
+}
+
+func Test_DurationFrom(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	testCases := map[string]time.Time{
+		"P1D":    time.Date(2024, 3, 10, 9, 0, 0, 0, ny),
+		"PT24H":  time.Date(2024, 3, 10, 10, 0, 0, 0, ny),
+		"-P1W":   time.Date(2024, 3, 2, 9, 0, 0, 0, ny),
+		"P1DT1H": time.Date(2024, 3, 10, 10, 0, 0, 0, ny),
+	}
+	start := time.Date(2024, 3, 9, 9, 0, 0, 0, ny)
+	for val, expected := range testCases {
+		d, _ := parseDuration(val)
+		if got := d.From(start); !got.Equal(expected) {
+			t.Errorf("\nin case %#v:\nexpected: %s\ngot:      %s\n", val, expected, got)
+		}
+	}
+}
+
+func Test_DateTime(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	testCases := map[string]time.Time{
+		"DTSTART:19980118T073000Z":                      time.Date(1998, 1, 18, 7, 30, 0, 0, time.UTC),
+		"DTSTART:19980118T073000":                       time.Date(1998, 1, 18, 7, 30, 0, 0, time.UTC),
+		"DTSTART;VALUE=DATE:19970714":                   time.Date(1997, 7, 14, 0, 0, 0, 0, time.UTC),
+		"DTSTART;TZID=America/New_York:19980119T020000": time.Date(1998, 1, 19, 2, 0, 0, 0, ny),
+	}
+	for src, expected := range testCases {
+		field, _ := readField([]byte(src))
+		got, err := field.DateTime()
+		if err != nil || !got.Equal(expected) {
+			t.Errorf("\nin case %#v:\nexpected: %s\ngot:      %s (%v)\n",
+				src, expected, got, err)
+		}
+	}
+	field, _ := readField([]byte("DTSTART:1998011"))
+	if _, err := field.DateTime(); err != invalidDateTime {
+		t.Errorf("\nexpected invalidDateTime, got %v\n", err)
+	}
+}
+
+func Test_Text(t *testing.T) {
+	testCases := map[string]string{
+		`Standup`:                    "Standup",
+		`Room 1\, 2nd floor\; north`: "Room 1, 2nd floor; north",
+		`line one\nline two\Nthree`:  "line one\nline two\nthree",
+		`C:\\Users`:                  `C:\Users`,
+		`trailing\`:                  `trailing\`,
+	}
+	for val, expected := range testCases {
+		if got := (Field{Name: "SUMMARY", Value: val}).Text(); got != expected {
+			t.Errorf("\nin case %#v:\nexpected: %#v\ngot:      %#v\n", val, expected, got)
+		}
+	}
+}
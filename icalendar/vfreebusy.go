@@ -0,0 +1,161 @@
+package icalendar
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// A VFreeBusy is a typed view of a VFREEBUSY component. Busy holds the
+// FREEBUSY periods keyed by their FBTYPE. Fields not covered by the other
+// members are kept in Fields so that the component survives a round trip.
+type VFreeBusy struct {
+	UID       string
+	Stamp     time.Time
+	Start     time.Time
+	End       time.Time
+	Organizer Organizer
+	Attendees []Attendee
+	Busy      map[FreeBusyType][]Period
+	Fields    []Field
+}
+
+var notAFreeBusy = errors.New("Component is not a VFREEBUSY")
+
+func ParseVFreeBusy(c Component) (fb VFreeBusy, err error) {
+	if !strings.EqualFold(c.Name, "VFREEBUSY") {
+		err = notAFreeBusy
+		return
+	}
+	fb.Busy = make(map[FreeBusyType][]Period)
+	for _, f := range c.Fields {
+		switch strings.ToUpper(f.Name) {
+		case "UID":
+			fb.UID = f.Value
+		case "DTSTAMP":
+			fb.Stamp, err = f.DateTime()
+		case "DTSTART":
+			fb.Start, err = f.DateTime()
+		case "DTEND":
+			fb.End, err = f.DateTime()
+		case "ORGANIZER":
+			fb.Organizer, err = ParseOrganizer(f)
+		case "ATTENDEE":
+			var a Attendee
+			if a, err = ParseAttendee(f); err == nil {
+				fb.Attendees = append(fb.Attendees, a)
+			}
+		case "FREEBUSY":
+			if err = f.validate(); err != nil {
+				return
+			}
+			fbtype := FreeBusyType(strings.ToUpper(string(f.FreeBusyType())))
+			for _, val := range strings.Split(f.Value, ",") {
+				var p Period
+				if p, err = parsePeriod(val, time.UTC); err != nil {
+					return
+				}
+				fb.Busy[fbtype] = append(fb.Busy[fbtype], p)
+			}
+		default:
+			fb.Fields = append(fb.Fields, f)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (fb VFreeBusy) Component() Component {
+	c := Component{Name: "VFREEBUSY"}
+	add := func(name string, t time.Time) {
+		if !t.IsZero() {
+			c.Fields = append(c.Fields, Field{Name: name, Value: formatDateTime(t)})
+		}
+	}
+	if fb.UID != "" {
+		c.Fields = append(c.Fields, Field{Name: "UID", Value: fb.UID})
+	}
+	add("DTSTAMP", fb.Stamp)
+	add("DTSTART", fb.Start)
+	add("DTEND", fb.End)
+	if fb.Organizer.Address != "" {
+		c.Fields = append(c.Fields, fb.Organizer.Field())
+	}
+	for _, a := range fb.Attendees {
+		c.Fields = append(c.Fields, a.Field())
+	}
+	c.Fields = append(c.Fields, fb.Fields...)
+	c.Fields = append(c.Fields, FreeBusyFields(fb.Busy)...)
+	return c
+}
+
+// Merges overlapping and adjacent periods within each FBTYPE.
+func (fb *VFreeBusy) Coalesce() {
+	for fbtype, periods := range fb.Busy {
+		fb.Busy[fbtype] = MergePeriods(periods)
+	}
+}
+
+// Returns every period during which the calendar user is not free, whatever
+// the FBTYPE, merged and sorted. FBTYPE=FREE periods are not busy. Unknown
+// types are treated as BUSY, as RFC 5545 s. 3.2.9 requires.
+func (fb VFreeBusy) BusyPeriods() []Period {
+	var periods []Period
+	for fbtype, ps := range fb.Busy {
+		if fbtype != FBFree {
+			periods = append(periods, ps...)
+		}
+	}
+	return MergePeriods(periods)
+}
+
+// Reports whether no busy period overlaps p.
+func (fb VFreeBusy) IsFree(p Period) bool {
+	for _, busy := range fb.BusyPeriods() {
+		if busy.Start.Before(p.End) && busy.End.After(p.Start) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether p is free in every one of the given free/busy objects, such
+// as the replies from each attendee of a meeting.
+func AllFree(fbs []VFreeBusy, p Period) bool {
+	for _, fb := range fbs {
+		if !fb.IsFree(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the periods within window that are free in every one of the given
+// free/busy objects and last at least minLength.
+func CommonFreePeriods(fbs []VFreeBusy, window Period, minLength time.Duration) []Period {
+	var busy []Period
+	for _, fb := range fbs {
+		busy = append(busy, fb.BusyPeriods()...)
+	}
+	busy = MergePeriods(busy)
+	var free []Period
+	cursor := window.Start
+	for _, b := range busy {
+		if !b.End.After(cursor) {
+			continue
+		}
+		if !b.Start.Before(window.End) {
+			break
+		}
+		if b.Start.After(cursor) && b.Start.Sub(cursor) >= minLength {
+			free = append(free, Period{cursor, b.Start})
+		}
+		cursor = b.End
+	}
+	if window.End.After(cursor) && window.End.Sub(cursor) >= minLength {
+		free = append(free, Period{cursor, window.End})
+	}
+	return free
+}
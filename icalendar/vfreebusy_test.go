@@ -0,0 +1,72 @@
+package icalendar
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_VFreeBusy(t *testing.T) {
+	src := "BEGIN:VFREEBUSY\r\n" +
+		"UID:19970901T095957Z-76A912@example.com\r\n" +
+		"ORGANIZER:mailto:jane_doe@example.com\r\n" +
+		"ATTENDEE:mailto:john_public@example.com\r\n" +
+		"DTSTART:19971015T050000Z\r\n" +
+		"DTEND:19971016T050000Z\r\n" +
+		"DTSTAMP:19970901T083000Z\r\n" +
+		"X-EXTRA:kept\r\n" +
+		"FREEBUSY:19971015T050000Z/PT8H30M,19971015T160000Z/PT5H30M\r\n" +
+		"FREEBUSY:19971015T120000Z/19971015T140000Z\r\n" +
+		"FREEBUSY;FBTYPE=BUSY-TENTATIVE:19971015T133000Z/19971015T170000Z\r\n" +
+		"FREEBUSY;FBTYPE=FREE:19971015T140000Z/19971015T150000Z\r\n" +
+		"END:VFREEBUSY\r\n"
+	fb, err := ParseVFreeBusy(decodeString(t, src))
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	if len(fb.Busy[FBBusy]) != 3 || len(fb.Busy[FBBusyTentative]) != 1 {
+		t.Errorf("\nperiods not keyed by type: %#v\n", fb.Busy)
+	}
+	if fb.Organizer.Address != "mailto:jane_doe@example.com" || len(fb.Attendees) != 1 ||
+		len(fb.Fields) != 1 || fb.Fields[0].Name != "X-EXTRA" {
+		t.Errorf("\nfields not gathered: %#v\n", fb)
+	}
+	fb.Coalesce()
+	if len(fb.Busy[FBBusy]) != 2 {
+		t.Errorf("\nexpected busy periods to coalesce, got %#v\n", fb.Busy[FBBusy])
+	}
+
+	var buf bytes.Buffer
+	NewEncoder(&buf).Encode(fb.Component())
+	again, err := ParseVFreeBusy(decodeString(t, buf.String()))
+	if err != nil {
+		t.Fatalf("\nunexpected error re-parsing:\n%s\n%s\n", buf.String(), err)
+	}
+	if len(again.Busy[FBBusy]) != 2 || !again.Start.Equal(fb.Start) ||
+		len(again.Fields) != 1 {
+		t.Errorf("\nround trip mismatch:\n%s\n", buf.String())
+	}
+
+	at := func(h, m int) time.Time {
+		return time.Date(1997, 10, 15, h, m, 0, 0, time.UTC)
+	}
+	if fb.IsFree(Period{at(13, 0), at(13, 30)}) || !fb.IsFree(Period{at(21, 30), at(22, 0)}) {
+		t.Errorf("\nIsFree mismatch\n")
+	}
+	other := VFreeBusy{Busy: map[FreeBusyType][]Period{
+		FBBusyUnavailable: {{at(0, 0), at(5, 0)}, {at(22, 0), at(23, 59)}},
+	}}
+	free := CommonFreePeriods([]VFreeBusy{fb, other}, Period{at(0, 0), at(23, 59)}, 30*time.Minute)
+	// fb is busy 05:00-14:00 (with tentative time up to 17:00) and 16:00-21:30
+	expected := []Period{{at(21, 30), at(22, 0)}}
+	if len(free) != len(expected) || !free[0].Start.Equal(expected[0].Start) ||
+		!free[0].End.Equal(expected[0].End) {
+		t.Errorf("\nexpected %v\ngot      %v\n", expected, free)
+	}
+	if !AllFree([]VFreeBusy{fb, other}, expected[0]) {
+		t.Errorf("\nexpected %v to be free for all\n", expected[0])
+	}
+	if AllFree([]VFreeBusy{fb, other}, Period{at(21, 0), at(22, 0)}) {
+		t.Errorf("\nexpected 21:00-22:00 to be busy for someone\n")
+	}
+}
@@ -0,0 +1,275 @@
+package caldav
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// A MemoryBackend keeps everything in memory. It is mostly useful for tests.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	cals    map[string]*memoryCalendar
+	objects map[string]memoryObject
+	seq     int // bumped on every change, to give unique change tokens
+}
+
+type memoryCalendar struct {
+	cal     Calendar
+	token   int
+	created int // the token the calendar started out with
+	log     []memoryChange
+	uids    uidIndex
+}
+
+type memoryChange struct {
+	token   int
+	path    string
+	deleted bool
+}
+
+type memoryObject struct {
+	raw     []byte
+	modTime time.Time
+	// Kept so that conditions can be checked without decoding
+	etag        string
+	scheduleTag string
+	uid         string
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		cals:    make(map[string]*memoryCalendar),
+		objects: make(map[string]memoryObject),
+	}
+}
+
+func (b *MemoryBackend) Calendars(home string) ([]Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	home = collectionPath(home)
+	var cals []Calendar
+	for p, mc := range b.cals {
+		if parentPath(p) == home {
+			cals = append(cals, copyCalendar(mc.cal))
+		}
+	}
+	sort.Slice(cals, func(i, j int) bool { return cals[i].Path < cals[j].Path })
+	return cals, nil
+}
+
+func (b *MemoryBackend) Calendar(p string) (Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	mc, has := b.cals[p]
+	if !has {
+		return Calendar{}, ErrNotFound
+	}
+	return copyCalendar(mc.cal), nil
+}
+
+func (b *MemoryBackend) CreateCalendar(cal Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal.Path = collectionPath(cal.Path)
+	if _, has := b.cals[cal.Path]; has {
+		return ErrAlreadyExists
+	}
+	b.seq++
+	b.cals[cal.Path] = &memoryCalendar{cal: copyCalendar(cal), token: b.seq, created: b.seq, uids: uidIndex{}}
+	return nil
+}
+
+func (b *MemoryBackend) UpdateCalendar(cal Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal.Path = collectionPath(cal.Path)
+	mc, has := b.cals[cal.Path]
+	if !has {
+		return ErrNotFound
+	}
+	mc.cal = copyCalendar(cal)
+	return nil
+}
+
+func (b *MemoryBackend) DeleteCalendar(p string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, has := b.cals[p]; !has {
+		return ErrNotFound
+	}
+	delete(b.cals, p)
+	for objPath := range b.objects {
+		if strings.HasPrefix(objPath, p) {
+			delete(b.objects, objPath)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Objects(calPath string) ([]Object, error) {
+	return b.query(calPath, func(icalendar.Component) bool { return true })
+}
+
+func (b *MemoryBackend) QueryObjects(calPath string, start, end time.Time) ([]Object, error) {
+	return b.query(calPath, func(data icalendar.Component) bool {
+		return mayOverlap(data, start, end)
+	})
+}
+
+func (b *MemoryBackend) query(calPath string, match func(icalendar.Component) bool) ([]Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if _, has := b.cals[calPath]; !has {
+		return nil, ErrNotFound
+	}
+	var objs []Object
+	for p, mo := range b.objects {
+		if parentPath(p) != calPath {
+			continue
+		}
+		obj, err := mo.object(p)
+		if err != nil {
+			return nil, err
+		}
+		if match(obj.Data) {
+			objs = append(objs, obj)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Path < objs[j].Path })
+	return objs, nil
+}
+
+func (b *MemoryBackend) Object(p string) (Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	mo, has := b.objects[p]
+	if !has {
+		return Object{}, ErrNotFound
+	}
+	return mo.object(p)
+}
+
+func (b *MemoryBackend) PutObject(p string, data icalendar.Component, cond Condition) (Object, error) {
+	raw, err := encodeObject(data)
+	if err != nil {
+		return Object{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	mc, has := b.cals[parentPath(p)]
+	if !has {
+		return Object{}, ErrNotFound
+	}
+	old, exists := b.objects[p]
+	if !cond.Holds(old.tags(), exists) {
+		return Object{}, ErrPreconditionFailed
+	}
+	uid := uidOf(data)
+	if err := mc.uids.check(cond, uid, p); err != nil {
+		return Object{}, err
+	}
+	obj, err := newObject(p, raw, time.Now())
+	if err != nil {
+		return Object{}, err
+	}
+	if exists {
+		mc.uids.remove(old.uid, p)
+	}
+	mc.uids.add(uid, p)
+	b.objects[p] = memoryObject{raw, obj.ModTime, obj.ETag, obj.ScheduleTag, uid}
+	b.changed(mc, p, false)
+	return obj, nil
+}
+
+func (b *MemoryBackend) DeleteObject(p string, cond Condition) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old, exists := b.objects[p]
+	if !exists {
+		return ErrNotFound
+	}
+	if !cond.Holds(old.tags(), exists) {
+		return ErrPreconditionFailed
+	}
+	delete(b.objects, p)
+	if mc, has := b.cals[parentPath(p)]; has {
+		mc.uids.remove(old.uid, p)
+		b.changed(mc, p, true)
+	}
+	return nil
+}
+
+// Records a change to the object at p in its calendar's log.
+func (b *MemoryBackend) changed(mc *memoryCalendar, p string, deleted bool) {
+	b.seq++
+	mc.token = b.seq
+	mc.log = append(mc.log, memoryChange{b.seq, p, deleted})
+}
+
+func (b *MemoryBackend) ChangeToken(calPath string) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	mc, has := b.cals[calPath]
+	if !has {
+		return "", ErrNotFound
+	}
+	return strconv.Itoa(mc.token), nil
+}
+
+func (b *MemoryBackend) Changes(calPath, since string) (changed, deleted []string, token string, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	mc, has := b.cals[calPath]
+	if !has {
+		err = ErrNotFound
+		return
+	}
+	token = strconv.Itoa(mc.token)
+	if since == "" {
+		for p := range b.objects {
+			if parentPath(p) == calPath {
+				changed = append(changed, p)
+			}
+		}
+		sort.Strings(changed)
+		return
+	}
+	n, perr := strconv.Atoi(since)
+	if perr != nil || n < mc.created || n > mc.token {
+		err = ErrInvalidSyncToken
+		return
+	}
+	state := make(map[string]bool) // whether each changed path ended up deleted
+	for _, ch := range mc.log {
+		if ch.token > n {
+			state[ch.path] = ch.deleted
+		}
+	}
+	changed, deleted = splitChanges(state)
+	return
+}
+
+func (mo memoryObject) object(p string) (Object, error) {
+	return newObject(p, mo.raw, mo.modTime)
+}
+
+// Returns an Object with just the tags conditions are checked against.
+func (mo memoryObject) tags() Object {
+	return Object{ETag: mo.etag, ScheduleTag: mo.scheduleTag}
+}
+
+func copyCalendar(cal Calendar) Calendar {
+	cal.SupportedComponents = append([]string(nil), cal.SupportedComponents...)
+	acl := cal.ACL
+	cal.ACL = nil
+	for _, ace := range acl {
+		ace.Grant = append([]Privilege(nil), ace.Grant...)
+		cal.ACL = append(cal.ACL, ace)
+	}
+	return cal
+}
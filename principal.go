@@ -0,0 +1,368 @@
+package caldav
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Principal is a user or group that calendars belong to, see RFC 3744 s. 2.
+// Path is the URL path of the principal resource and ends in a slash.
+// CalendarHome is the collection the principal's calendars live in, and
+// Addresses are its calendar user addresses, such as
+// mailto:alice@example.com. Members lists the addresses of the groups the
+// principal is in, like the MEMBER parameter of an ATTENDEE does; a group is
+// any principal that others list this way.
+type Principal struct {
+	Path         string
+	DisplayName  string
+	CalendarHome string
+	Addresses    []string
+	Members      []string
+}
+
+// A PrincipalBackend knows the principals a Handler serves, and which of them
+// is making a request.
+type PrincipalBackend interface {
+	// Returns the principal a request is authenticated as, or ErrUnauthorized
+	// if it isn't.
+	CurrentPrincipal(r *http.Request) (Principal, error)
+	Principal(p string) (Principal, error)
+	// Returns every principal, sorted by path.
+	Principals() ([]Principal, error)
+}
+
+// A MemoryPrincipals keeps principals in memory and authenticates requests
+// with HTTP Basic authentication.
+type MemoryPrincipals struct {
+	mu         sync.RWMutex
+	principals map[string]Principal
+	users      map[string]memoryUser
+}
+
+type memoryUser struct {
+	path     string
+	password string
+}
+
+func NewMemoryPrincipals() *MemoryPrincipals {
+	return &MemoryPrincipals{
+		principals: make(map[string]Principal),
+		users:      make(map[string]memoryUser),
+	}
+}
+
+// Adds a principal that requests can authenticate as with the given user name
+// and password. Principals with an empty user name can't log in.
+func (mp *MemoryPrincipals) AddPrincipal(p Principal, user, password string) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	p.Path = collectionPath(p.Path)
+	mp.principals[p.Path] = copyPrincipal(p)
+	if user != "" {
+		mp.users[user] = memoryUser{p.Path, password}
+	}
+}
+
+func (mp *MemoryPrincipals) CurrentPrincipal(r *http.Request) (Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return Principal{}, ErrUnauthorized
+	}
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	mu, has := mp.users[user]
+	if !has || subtle.ConstantTimeCompare([]byte(password), []byte(mu.password)) != 1 {
+		return Principal{}, ErrUnauthorized
+	}
+	return copyPrincipal(mp.principals[mu.path]), nil
+}
+
+func (mp *MemoryPrincipals) Principal(p string) (Principal, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	pr, has := mp.principals[collectionPath(p)]
+	if !has {
+		return Principal{}, ErrNotFound
+	}
+	return copyPrincipal(pr), nil
+}
+
+func (mp *MemoryPrincipals) Principals() ([]Principal, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	var prs []Principal
+	for _, pr := range mp.principals {
+		prs = append(prs, copyPrincipal(pr))
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Path < prs[j].Path })
+	return prs, nil
+}
+
+func copyPrincipal(p Principal) Principal {
+	p.Addresses = append([]string(nil), p.Addresses...)
+	p.Members = append([]string(nil), p.Members...)
+	return p
+}
+
+// The well-known URI clients start discovery from, see RFC 6764 s. 5.
+const wellKnownPath = "/.well-known/caldav"
+
+// Sends clients that start at the well-known URI to the root, where they can
+// ask for their current-user-principal.
+func serveWellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/", http.StatusMovedPermanently)
+}
+
+// A resource is a path and the properties found there.
+type resource struct {
+	path  string
+	props map[xml.Name]string
+}
+
+// Returns the properties every resource has when there are principals:
+// current-user-principal (RFC 5397) and principal-collection-set.
+func (h *Handler) principalProps(r *http.Request) (map[xml.Name]string, error) {
+	props := make(map[xml.Name]string)
+	if h.Principals == nil {
+		return props, nil
+	}
+	cur, err := h.Principals.CurrentPrincipal(r)
+	switch {
+	case err == nil:
+		props[davCurrentUser] = hrefElement(cur.Path)
+	case errors.Is(err, ErrUnauthorized):
+		props[davCurrentUser] = emptyElement(xml.Name{Space: davNS, Local: "unauthenticated"})
+	default:
+		return nil, err
+	}
+	prs, err := h.Principals.Principals()
+	if err != nil {
+		return nil, err
+	}
+	var set strings.Builder
+	seen := make(map[string]bool)
+	for _, pr := range prs {
+		if coll := parentPath(pr.Path); !seen[coll] {
+			seen[coll] = true
+			set.WriteString(hrefElement(coll))
+		}
+	}
+	props[davPrincipalColl] = set.String()
+	return props, nil
+}
+
+// Finds the resources at p that lead clients to their calendars: the root,
+// principal collections, principals and calendar homes. Collections list
+// their members too unless depth is 0.
+func (h *Handler) discoveryResources(p, depth string) (res []resource, err error) {
+	p = collectionPath(p)
+	var prs []Principal
+	if h.Principals != nil {
+		if prs, err = h.Principals.Principals(); err != nil {
+			return
+		}
+	}
+	for _, pr := range prs {
+		if pr.Path == p {
+			return []resource{{p, principalResourceProps(pr, prs)}}, nil
+		}
+	}
+	for _, pr := range prs {
+		switch p {
+		case scheduleInbox(pr):
+			// Not delivered to yet
+			return []resource{{p, map[xml.Name]string{davResourceType: inboxResourceType}}}, nil
+		case scheduleOutbox(pr):
+			return []resource{{p, map[xml.Name]string{davResourceType: outboxResourceType}}}, nil
+		}
+	}
+	for _, pr := range prs {
+		if collectionPath(pr.CalendarHome) != p {
+			continue
+		}
+		res = append(res, resource{p, collectionProps()})
+		if depth != "0" {
+			var cals []Calendar
+			if cals, err = h.Backend.Calendars(p); err != nil {
+				return
+			}
+			hasInbox := false
+			for _, cal := range cals {
+				var cr resource
+				if cr, err = h.calendarResource(cal); err != nil {
+					return
+				}
+				hasInbox = hasInbox || cal.Path == scheduleInbox(pr)
+				res = append(res, cr)
+			}
+			if !hasInbox {
+				res = append(res, resource{scheduleInbox(pr), map[xml.Name]string{davResourceType: inboxResourceType}})
+			}
+			res = append(res, resource{scheduleOutbox(pr), map[xml.Name]string{davResourceType: outboxResourceType}})
+		}
+		return
+	}
+	for _, pr := range prs {
+		if parentPath(pr.Path) != p {
+			continue
+		}
+		props := collectionProps()
+		props[davReportSet] = reportSet(principalReports)
+		res = append(res, resource{p, props})
+		if depth != "0" {
+			for _, member := range prs {
+				if parentPath(member.Path) == p {
+					res = append(res, resource{member.Path, principalResourceProps(member, prs)})
+				}
+			}
+		}
+		return
+	}
+	if p == "/" {
+		return []resource{{p, collectionProps()}}, nil
+	}
+	return nil, ErrNotFound
+}
+
+func collectionProps() map[xml.Name]string {
+	return map[xml.Name]string{davResourceType: emptyElement(xml.Name{Space: davNS, Local: "collection"})}
+}
+
+// Builds the properties of a principal, which include the groups it is in and
+// the members it has among all the principals in prs.
+func principalResourceProps(pr Principal, prs []Principal) map[xml.Name]string {
+	props := map[xml.Name]string{
+		davResourceType: emptyElement(xml.Name{Space: davNS, Local: "collection"}) +
+			emptyElement(xml.Name{Space: davNS, Local: "principal"}),
+		davPrincipalURL: hrefElement(pr.Path),
+	}
+	if pr.DisplayName != "" {
+		props[davDisplayName] = escapeText(pr.DisplayName)
+	}
+	if pr.CalendarHome != "" {
+		props[calHomeSet] = hrefElement(collectionPath(pr.CalendarHome))
+		props[calInboxURL] = hrefElement(scheduleInbox(pr))
+		props[calOutboxURL] = hrefElement(scheduleOutbox(pr))
+	}
+	var addrs strings.Builder
+	for _, addr := range pr.Addresses {
+		addrs.WriteString(`<href xmlns="` + davNS + `">` + escapeText(addr) + `</href>`)
+	}
+	props[calUserAddrSet] = addrs.String()
+	var groups, members strings.Builder
+	for _, other := range prs {
+		for _, addr := range pr.Members {
+			if hasAddress(other, addr) {
+				groups.WriteString(hrefElement(other.Path))
+				break
+			}
+		}
+		for _, addr := range other.Members {
+			if hasAddress(pr, addr) {
+				members.WriteString(hrefElement(other.Path))
+				break
+			}
+		}
+	}
+	props[davGroupMembership] = groups.String()
+	if members.Len() > 0 {
+		props[davGroupMemberSet] = members.String()
+	}
+	return props
+}
+
+// Renders a DAV:href element pointing at a path.
+func hrefElement(p string) string {
+	return `<href xmlns="` + davNS + `">` + escapeText(hrefFor(p)) + `</href>`
+}
+
+// The reports principal collections answer.
+var principalReports = []xml.Name{davPrincipalSearch, davSearchSet}
+
+// The properties principal-property-search can match against.
+var searchableProps = []xml.Name{davDisplayName, calUserAddrSet}
+
+func (h *Handler) servePrincipalSearch(w http.ResponseWriter, r *http.Request, a *access, search principalPropertySearch) error {
+	if err := search.propSelection.validate(); err != nil {
+		return err
+	}
+	var prs []Principal
+	if h.Principals != nil {
+		var err error
+		if prs, err = h.Principals.Principals(); err != nil {
+			return err
+		}
+	}
+	common, err := h.principalProps(r)
+	if err != nil {
+		return err
+	}
+	var ms multistatus
+	for _, pr := range prs {
+		if !search.matches(pr) {
+			continue
+		}
+		if ok, err := a.can(pr.Path, PrivRead); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		props := principalResourceProps(pr, prs)
+		for name, val := range common {
+			props[name] = val
+		}
+		ms.Responses = append(ms.Responses, propResponse(pr.Path, props, search.propSelection))
+	}
+	writeMultistatus(w, ms)
+	return nil
+}
+
+// Tests a principal against the searches, all of which must match unless the
+// test is anyof. Matching is a case-insensitive substring match, see RFC
+// 3744 s. 9.4.
+func (search principalPropertySearch) matches(pr Principal) bool {
+	anyOf := search.Test == "anyof"
+	for _, s := range search.Searches {
+		match := strings.ToLower(s.Match)
+		found := false
+		for _, el := range s.Prop.Names {
+			var values []string
+			switch el.XMLName {
+			case davDisplayName:
+				values = []string{pr.DisplayName}
+			case calUserAddrSet:
+				values = pr.Addresses
+			}
+			for _, v := range values {
+				found = found || strings.Contains(strings.ToLower(v), match)
+			}
+		}
+		if found && anyOf {
+			return true
+		}
+		if !found && !anyOf {
+			return false
+		}
+	}
+	return !anyOf && len(search.Searches) > 0
+}
+
+// Lists the properties principal-property-search can match against, see RFC
+// 3744 s. 9.5.
+func servePrincipalSearchSet(w http.ResponseWriter) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<principal-search-property-set xmlns="` + davNS + `">`)
+	for _, name := range searchableProps {
+		b.WriteString(`<principal-search-property><prop>` + emptyElement(name) + `</prop></principal-search-property>`)
+	}
+	b.WriteString(`</principal-search-property-set>`)
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
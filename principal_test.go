@@ -0,0 +1,120 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func principalHandler() *Handler {
+	principals := NewMemoryPrincipals()
+	principals.AddPrincipal(Principal{
+		Path:         "/principals/alice/",
+		DisplayName:  "Alice Liddell",
+		CalendarHome: "/cal/alice/",
+		Addresses:    []string{"mailto:alice@example.com"},
+	}, "alice", "secret")
+	principals.AddPrincipal(Principal{
+		Path:         "/principals/bob",
+		DisplayName:  "Bob Builder",
+		CalendarHome: "/cal/bob/",
+		Addresses:    []string{"mailto:bob@example.org"},
+	}, "bob", "hunter2")
+	h := &Handler{Backend: NewMemoryBackend(), Principals: principals}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/alice/work/", DisplayName: "Work"})
+	return h
+}
+
+// Returns an Authorization header value for HTTP Basic authentication.
+func auth(user, password string) string {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.SetBasicAuth(user, password)
+	return r.Header.Get("Authorization")
+}
+
+func Test_discovery(t *testing.T) {
+	h := principalHandler()
+
+	rec := do(t, h, "PROPFIND", "/.well-known/caldav", "")
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/" {
+		t.Errorf("\nwell-known URI: expected a redirect to /, got %d %#v\n", rec.Code, rec.Header())
+	}
+
+	tests := []struct {
+		path, depth, authorization string
+		contains                   []string
+	}{
+		{"/", "0", auth("alice", "secret"), []string{
+			`<current-user-principal xmlns="DAV:"><href xmlns="DAV:">/principals/alice/</href>`,
+			`<principal-collection-set xmlns="DAV:"><href xmlns="DAV:">/principals/</href>`,
+		}},
+		{"/", "0", auth("alice", "wrong"), []string{`<unauthenticated xmlns="DAV:"/>`}},
+		{"/", "0", "", []string{`<unauthenticated xmlns="DAV:"/>`}},
+		{"/principals/alice/", "0", auth("bob", "hunter2"), []string{
+			`<principal xmlns="DAV:"/>`,
+			`<calendar-home-set xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">/cal/alice/</href>`,
+			`<calendar-user-address-set xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">mailto:alice@example.com</href>`,
+			"Alice Liddell",
+		}},
+		{"/principals/", "1", auth("bob", "hunter2"), []string{
+			"<href>/principals/</href>", "<href>/principals/alice/</href>", "<href>/principals/bob/</href>",
+			`<principal-property-search xmlns="DAV:"/>`,
+		}},
+		{"/cal/alice/", "1", auth("alice", "secret"), []string{"<href>/cal/alice/</href>", "<href>/cal/alice/work/</href>", "Work"}},
+	}
+	for _, test := range tests {
+		rec := do(t, h, "PROPFIND", test.path, "", "Depth", test.depth, "Authorization", test.authorization)
+		body := rec.Body.String()
+		if rec.Code != http.StatusMultiStatus {
+			t.Errorf("\nPROPFIND %s: expected 207, got %d: %s\n", test.path, rec.Code, body)
+			continue
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(body, want) {
+				t.Errorf("\nPROPFIND %s response lacks %s:\n%s\n", test.path, want, body)
+			}
+		}
+	}
+	if rec := do(t, h, "PROPFIND", "/principals/carol/", "", "Authorization", auth("bob", "hunter2")); rec.Code != http.StatusNotFound {
+		t.Errorf("\nPROPFIND of unknown principal: expected 404, got %d\n", rec.Code)
+	}
+}
+
+func Test_principalPropertySearch(t *testing.T) {
+	h := principalHandler()
+	search := func(test, searches string) string {
+		return `<?xml version="1.0"?>
+<D:principal-property-search xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"` + test + `>` + searches + `
+  <D:prop><D:displayname/><C:calendar-home-set/></D:prop>
+</D:principal-property-search>`
+	}
+	byName := `<D:property-search><D:prop><D:displayname/></D:prop><D:match>alice</D:match></D:property-search>`
+	byAddr := `<D:property-search><D:prop><C:calendar-user-address-set/></D:prop><D:match>EXAMPLE.ORG</D:match></D:property-search>`
+	tests := []struct {
+		body  string
+		found []string
+	}{
+		{search("", byName), []string{"alice"}},
+		{search("", byAddr), []string{"bob"}},
+		{search("", byName+byAddr), nil},
+		{search(` test="anyof"`, byName+byAddr), []string{"alice", "bob"}},
+	}
+	for _, test := range tests {
+		rec := do(t, h, "REPORT", "/principals/", test.body, "Authorization", auth("alice", "secret"))
+		body := rec.Body.String()
+		if rec.Code != http.StatusMultiStatus || strings.Count(body, "<response>") != len(test.found) {
+			t.Errorf("\nexpected %v, got %d:\n%s\n", test.found, rec.Code, body)
+		}
+		for _, name := range test.found {
+			if !strings.Contains(body, "<href>/principals/"+name+"/</href>") {
+				t.Errorf("\nexpected %s in:\n%s\n", name, body)
+			}
+		}
+	}
+
+	rec := do(t, h, "REPORT", "/principals/", `<?xml version="1.0"?><D:principal-search-property-set xmlns:D="DAV:"/>`,
+		"Authorization", auth("alice", "secret"))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<prop><displayname xmlns="DAV:"/></prop>`) {
+		t.Errorf("\nunexpected principal-search-property-set: %d\n%s\n", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,238 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// Limits restrict the calendar objects a Handler accepts, and are advertised
+// on its calendars as the properties of RFC 4791 s. 5.2.5 to 5.2.8. Zero
+// fields don't limit anything, except MaxRequestSize, which bounds every
+// request body and defaults to defaultMaxRequestSize. While any of the date
+// and instance limits is set, objects with more than maxCheckedInstances
+// instances are refused whatever MaxInstances says, since checking them would
+// cost too much.
+type Limits struct {
+	MaxResourceSize int64
+	MinDateTime     time.Time
+	MaxDateTime     time.Time
+	MaxInstances    int
+	MaxRequestSize  int64
+}
+
+const (
+	defaultMaxRequestSize = 10 << 20
+	maxCheckedInstances   = 100000
+)
+
+var errBodyTooLarge = httpError{http.StatusRequestEntityTooLarge, "Request body is too large"}
+
+func calPrecondition(code int, msg, cond string) preconditionError {
+	return preconditionError{
+		httpError: httpError{code, msg},
+		cond:      xml.Name{Space: caldavNS, Local: cond},
+	}
+}
+
+// The preconditions of PUT, see RFC 4791 s. 5.3.2.1.
+var (
+	errInvalidCalendarData = calPrecondition(http.StatusBadRequest,
+		"Request body is not a valid VCALENDAR", "valid-calendar-data")
+	errInvalidCalendarObject = calPrecondition(http.StatusForbidden,
+		"Calendar object must hold components of one type sharing a UID", "valid-calendar-object-resource")
+	errUnsupportedComponent = calPrecondition(http.StatusForbidden,
+		"Calendar does not accept this component type", "supported-calendar-component")
+	errTooLarge = calPrecondition(http.StatusForbidden,
+		"Calendar object is too large", "max-resource-size")
+	errTooEarly = calPrecondition(http.StatusForbidden,
+		"Calendar object starts before the minimum date", "min-date-time")
+	errTooLate = calPrecondition(http.StatusForbidden,
+		"Calendar object ends after the maximum date", "max-date-time")
+	errTooManyInstances = calPrecondition(http.StatusForbidden,
+		"Calendar object has too many instances", "max-instances")
+)
+
+// Reports a UID already used by the object at p in the same calendar.
+func errUIDConflict(p string) preconditionError {
+	err := calPrecondition(http.StatusForbidden, "UID is already in use", "no-uid-conflict")
+	err.inner = hrefElement(p)
+	return err
+}
+
+// Reads a request body, refusing it once it grows past MaxRequestSize.
+func (l Limits) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return readLimited(w, r, l.maxRequestSize(), errBodyTooLarge)
+}
+
+func (l Limits) maxRequestSize() int64 {
+	if l.MaxRequestSize > 0 {
+		return l.MaxRequestSize
+	}
+	return defaultMaxRequestSize
+}
+
+func readLimited(w http.ResponseWriter, r *http.Request, max int64, tooLarge error) ([]byte, error) {
+	if r.ContentLength > max {
+		return nil, tooLarge
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return nil, tooLarge
+	}
+	return body, err
+}
+
+// Reads and validates the calendar object in a request body.
+func (l Limits) readObject(w http.ResponseWriter, r *http.Request) (data icalendar.Component, err error) {
+	var raw []byte
+	if l.MaxResourceSize > 0 {
+		raw, err = readLimited(w, r, l.MaxResourceSize, errTooLarge)
+	} else {
+		raw, err = l.readBody(w, r)
+	}
+	if err != nil {
+		return
+	}
+	data, err = icalendar.NewDecoder(bytes.NewReader(raw)).Decode()
+	if err != nil || data.Name != "VCALENDAR" || data.Validate() != nil {
+		err = errInvalidCalendarData
+	}
+	return
+}
+
+// Enforces the preconditions that depend on what a calendar object holds and
+// on the calendar it's being stored in. The backend checks no-uid-conflict
+// itself, along with the other conditions of the write.
+func (h *Handler) checkObject(cal Calendar, data icalendar.Component) error {
+	comp, _, err := objectUID(data)
+	if err != nil {
+		return err
+	}
+	if len(cal.SupportedComponents) > 0 {
+		supported := false
+		for _, name := range cal.SupportedComponents {
+			supported = supported || name == comp
+		}
+		if !supported {
+			return errUnsupportedComponent
+		}
+	}
+	return h.Limits.check(data, comp, floatingZone(cal.TimeZone))
+}
+
+// Returns the component type and UID of a calendar object resource, checking
+// that it has just the one of each and no METHOD, as RFC 4791 s. 4.1 requires.
+func objectUID(data icalendar.Component) (comp, uid string, err error) {
+	if _, has := data.Field("METHOD"); has {
+		err = errInvalidCalendarObject
+		return
+	}
+	for _, c := range data.Components {
+		if c.Name == "VTIMEZONE" {
+			continue
+		}
+		if comp == "" {
+			comp, uid = c.Name, c.Value("UID")
+		}
+		if c.Name != comp || c.Value("UID") != uid {
+			err = errInvalidCalendarObject
+			return
+		}
+	}
+	if uid == "" {
+		err = errInvalidCalendarObject
+	}
+	return
+}
+
+// Checks the instances of an object's components against the date and
+// instance limits. Recurrences are only expanded openRangeYears into the
+// future, so rules that never end count as having the instances up to then.
+// Expansion covers a window that doubles each round from an hour past the
+// earliest start, and stops at the first instance that breaks a limit. Each
+// round counts at most maxCheckedInstances, so a rule like FREQ=SECONDLY
+// costs about that many instances even when only the dates are limited.
+func (l Limits) check(data icalendar.Component, comp string, floating *time.Location) error {
+	if l.MinDateTime.IsZero() && l.MaxDateTime.IsZero() && l.MaxInstances == 0 {
+		return nil
+	}
+	max := l.MaxInstances
+	if max == 0 || max > maxCheckedInstances {
+		max = maxCheckedInstances
+	}
+	switch comp {
+	case "VEVENT", "VTODO", "VJOURNAL":
+	default:
+		return nil
+	}
+	horizon := time.Now().AddDate(openRangeYears, 0, 0)
+	start, has := earliestStart(data, comp, floating)
+	if !has {
+		return nil
+	}
+	for window := time.Hour; ; window *= 2 {
+		to := start.Add(window)
+		if to.After(horizon) || window > openRangeYears*366*24*time.Hour {
+			to = horizon
+		}
+		insts, err := icalendar.CalendarInstancesIn(data, comp, time.Time{}, to, floating)
+		if err != nil {
+			return errInvalidCalendarData
+		}
+		if len(insts) > max {
+			return errTooManyInstances
+		}
+		for _, inst := range insts {
+			if !l.MinDateTime.IsZero() && inst.Start.Before(l.MinDateTime) {
+				return errTooEarly
+			}
+			if !l.MaxDateTime.IsZero() && inst.End.After(l.MaxDateTime) {
+				return errTooLate
+			}
+		}
+		if !to.Before(horizon) {
+			return nil
+		}
+	}
+}
+
+// Returns the earliest DTSTART, or DUE for a VTODO without one, among the
+// components of an object.
+func earliestStart(data icalendar.Component, comp string, floating *time.Location) (start time.Time, has bool) {
+	for _, c := range data.ComponentsNamed(comp) {
+		f, ok := c.Field("DTSTART")
+		if !ok {
+			if f, ok = c.Field("DUE"); !ok {
+				continue
+			}
+		}
+		if t, err := f.DateTimeIn(floating); err == nil && (!has || t.Before(start)) {
+			start, has = t, true
+		}
+	}
+	return
+}
+
+// Advertises the limits among a calendar's properties.
+func (l Limits) addProps(props map[xml.Name]string) {
+	if l.MaxResourceSize > 0 {
+		props[calMaxSize] = strconv.FormatInt(l.MaxResourceSize, 10)
+	}
+	if !l.MinDateTime.IsZero() {
+		props[calMinDate] = l.MinDateTime.UTC().Format(utcLayout)
+	}
+	if !l.MaxDateTime.IsZero() {
+		props[calMaxDate] = l.MaxDateTime.UTC().Format(utcLayout)
+	}
+	if l.MaxInstances > 0 {
+		props[calMaxInstances] = strconv.Itoa(l.MaxInstances)
+	}
+}
@@ -0,0 +1,96 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_putPreconditions(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend(), Limits: Limits{
+		MaxResourceSize: 1024,
+		MinDateTime:     time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		MaxDateTime:     time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		MaxInstances:    10,
+	}}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/", SupportedComponents: []string{"VEVENT"}})
+	if rec := do(t, h, "PUT", "/cal/e1.ics", testEvent); rec.Code != http.StatusCreated {
+		t.Fatalf("\nPUT: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+
+	event := func(lines ...string) string {
+		return vcalendar(append(append([]string{"BEGIN:VEVENT", "UID:e2", "DTSTAMP:20240101T000000Z"}, lines...), "END:VEVENT")...)
+	}
+	tests := []struct {
+		name string
+		body string
+		code int
+		cond string
+	}{
+		{"garbage", "BEGIN:VCALENDAR\r\n", http.StatusBadRequest, "valid-calendar-data"},
+		{"bad date", event("DTSTART:2024"), http.StatusBadRequest, "valid-calendar-data"},
+		{"no UID", vcalendar("BEGIN:VEVENT", "DTSTART:20240101T090000Z", "END:VEVENT"), http.StatusForbidden, "valid-calendar-object-resource"},
+		{"METHOD", strings.Replace(event("DTSTART:20240101T090000Z"), "VERSION:2.0", "VERSION:2.0\r\nMETHOD:REQUEST", 1), http.StatusForbidden, "valid-calendar-object-resource"},
+		{"mixed UIDs", vcalendar("BEGIN:VEVENT", "UID:a", "END:VEVENT", "BEGIN:VEVENT", "UID:b", "END:VEVENT"), http.StatusForbidden, "valid-calendar-object-resource"},
+		{"VTODO", vcalendar("BEGIN:VTODO", "UID:t", "END:VTODO"), http.StatusForbidden, "supported-calendar-component"},
+		{"UID conflict", testEvent, http.StatusForbidden, "no-uid-conflict"},
+		{"too large", event("DESCRIPTION:" + strings.Repeat("x", 70) + strings.Repeat("\r\n "+strings.Repeat("x", 70), 15)), http.StatusForbidden, "max-resource-size"},
+		{"too early", event("DTSTART:19990101T090000Z"), http.StatusForbidden, "min-date-time"},
+		{"too late", event("DTSTART:20291231T230000Z", "DTEND:20300101T010000Z"), http.StatusForbidden, "max-date-time"},
+		{"never ends", event("DTSTART:20240101T090000Z", "RRULE:FREQ=YEARLY;INTERVAL=20"), http.StatusForbidden, "max-date-time"},
+		{"too many", event("DTSTART:20240101T090000Z", "RRULE:FREQ=DAILY;COUNT=11"), http.StatusForbidden, "max-instances"},
+		{"endless", event("DTSTART:20240101T090000Z", "RRULE:FREQ=MINUTELY"), http.StatusForbidden, "max-instances"},
+	}
+	for _, test := range tests {
+		start := time.Now()
+		rec := do(t, h, "PUT", "/cal/e2.ics", test.body)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("\nPUT of %s took %s\n", test.name, elapsed)
+		}
+		if body := rec.Body.String(); rec.Code != test.code || !strings.Contains(body, "<"+test.cond+" ") {
+			t.Errorf("\nPUT of %s:\nexpected: %d %s\ngot:      %d %s\n", test.name, test.code, test.cond, rec.Code, body)
+		}
+	}
+	if rec := do(t, h, "PUT", "/cal/e2.ics", testEvent); !strings.Contains(rec.Body.String(), "<href xmlns=\"DAV:\">/cal/e1.ics</href>") {
+		t.Errorf("\nno-uid-conflict does not name the conflicting object:\n%s\n", rec.Body)
+	}
+	// Replacing an object doesn't conflict with itself
+	if rec := do(t, h, "PUT", "/cal/e1.ics", testEvent); rec.Code != http.StatusNoContent {
+		t.Errorf("\nPUT over existing: expected 204, got %d: %s\n", rec.Code, rec.Body)
+	}
+	if rec := do(t, h, "PUT", "/cal/e2.ics", event("DTSTART:20240101T090000Z", "RRULE:FREQ=DAILY;COUNT=10")); rec.Code != http.StatusCreated {
+		t.Errorf("\nPUT within limits: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+
+	// An endless rule is cut short by MaxInstances alone
+	endless := &Handler{Backend: NewMemoryBackend(), Limits: Limits{MaxInstances: 1000}}
+	endless.Backend.CreateCalendar(Calendar{Path: "/cal/"})
+	start := time.Now()
+	rec := do(t, endless, "PUT", "/cal/e2.ics", event("DTSTART:20240101T090000Z", "RRULE:FREQ=MINUTELY"))
+	if elapsed := time.Since(start); rec.Code != http.StatusForbidden || elapsed > time.Second {
+		t.Errorf("\nPUT of an endless MINUTELY rule: expected a quick 403, got %d after %s\n", rec.Code, elapsed)
+	}
+
+	// With only the dates limited, instances are still capped
+	dated := &Handler{Backend: NewMemoryBackend(), Limits: Limits{MaxDateTime: time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	dated.Backend.CreateCalendar(Calendar{Path: "/cal/"})
+	start = time.Now()
+	rec = do(t, dated, "PUT", "/cal/e2.ics", event("DTSTART:20240101T090000Z", "RRULE:FREQ=SECONDLY"))
+	if elapsed := time.Since(start); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "<max-instances ") || elapsed > 5*time.Second {
+		t.Errorf("\nPUT of an endless SECONDLY rule: expected a quick max-instances, got %d after %s: %s\n", rec.Code, elapsed, rec.Body)
+	}
+	if rec = do(t, dated, "PUT", "/cal/e2.ics", event("DTSTART:20240101T090000Z", "RRULE:FREQ=DAILY")); rec.Code != http.StatusCreated {
+		t.Errorf("\nPUT of an endless DAILY rule: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+
+	rec = do(t, h, "PROPFIND", "/cal/", "", "Depth", "0")
+	for _, want := range []string{
+		">1024</max-resource-size>", ">20000101T000000Z</min-date-time>",
+		">20300101T000000Z</max-date-time>", ">10</max-instances>",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("\nPROPFIND response lacks %s:\n%s\n", want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var errUnsupportedReport = httpError{http.StatusForbidden, "Unsupported report"}
+
+// The reports we answer, as listed in DAV:supported-report-set.
+var supportedReports = []xml.Name{calQuery, calMultiget, calFreeBusy, davSyncColl}
+
+func (h *Handler) serveReport(w http.ResponseWriter, r *http.Request) error {
+	p := cleanPath(r.URL.Path)
+	body, err := h.Limits.readBody(w, r)
+	if err != nil {
+		return err
+	}
+	name, err := rootName(body)
+	if err != nil {
+		return err
+	}
+	a, err := h.access(r)
+	if err != nil {
+		return err
+	}
+	priv := Privilege(PrivRead)
+	if name == calFreeBusy {
+		priv = PrivReadFreeBusy
+	}
+	if err := a.check(p, priv); err != nil {
+		return err
+	}
+	switch name {
+	case calQuery:
+		var query calendarQuery
+		if xml.Unmarshal(body, &query) != nil {
+			return errBadXML
+		}
+		return h.serveCalendarQuery(w, p, r.Header.Get("Depth"), query)
+	case calMultiget:
+		var multiget calendarMultiget
+		if xml.Unmarshal(body, &multiget) != nil {
+			return errBadXML
+		}
+		return h.serveMultiget(w, a, multiget)
+	case calFreeBusy:
+		var query freeBusyQuery
+		if xml.Unmarshal(body, &query) != nil {
+			return errBadXML
+		}
+		return h.serveFreeBusyQuery(w, p, query)
+	case davSyncColl:
+		var sync syncCollection
+		if xml.Unmarshal(body, &sync) != nil {
+			return errBadXML
+		}
+		return h.serveSyncCollection(w, p, sync)
+	case davPrincipalSearch:
+		var search principalPropertySearch
+		if xml.Unmarshal(body, &search) != nil {
+			return errBadXML
+		}
+		return h.servePrincipalSearch(w, r, a, search)
+	case davSearchSet:
+		servePrincipalSearchSet(w)
+		return nil
+	}
+	return errUnsupportedReport
+}
+
+// Returns the name of the root element of an XML document.
+func rootName(body []byte) (xml.Name, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, errBadXML
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+func (h *Handler) serveCalendarQuery(w http.ResponseWriter, p, depth string, query calendarQuery) error {
+	filter := query.Filter.Comp
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	if err := query.propSelection.validate(); err != nil {
+		return err
+	}
+	cal, obj, err := h.resolve(p)
+	if err != nil {
+		return err
+	}
+	// Floating times are in the zone the query gives, or else the calendar's
+	var tzid string
+	switch {
+	case query.TimeZone != "":
+		if tzid, err = timeZoneID(query.TimeZone); err != nil {
+			return err
+		}
+	case cal != nil:
+		tzid = cal.TimeZone
+	default:
+		if parent, err := h.Backend.Calendar(parentPath(p)); err == nil {
+			tzid = parent.TimeZone
+		}
+	}
+	floating := floatingZone(tzid)
+	var objs []Object
+	switch {
+	case obj != nil:
+		objs = []Object{*obj}
+	case depth != "0":
+		if r, has := filter.componentRange(); has {
+			objs, err = h.Backend.QueryObjects(cal.Path, r.start, r.end)
+		} else {
+			objs, err = h.Backend.Objects(cal.Path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var ms multistatus
+	for _, o := range objs {
+		if !filter.MatchesIn(o.Data, floating) {
+			continue
+		}
+		resp, err := reportResponse(o, query.propSelection, floating)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+	}
+	writeMultistatus(w, ms)
+	return nil
+}
+
+func (h *Handler) serveMultiget(w http.ResponseWriter, a *access, multiget calendarMultiget) error {
+	if err := multiget.propSelection.validate(); err != nil {
+		return err
+	}
+	zones := make(map[string]*time.Location) // floating zones by calendar
+	var ms multistatus
+	for _, href := range multiget.Hrefs {
+		p := hrefPath(href)
+		if p == "" {
+			ms.Responses = append(ms.Responses, response{Href: href, Status: status(http.StatusBadRequest)})
+			continue
+		}
+		if ok, err := a.can(p, PrivRead); err != nil {
+			return err
+		} else if !ok {
+			ms.Responses = append(ms.Responses, response{Href: hrefFor(p), Status: status(http.StatusForbidden)})
+			continue
+		}
+		obj, err := h.Backend.Object(p)
+		if errors.Is(err, ErrNotFound) {
+			ms.Responses = append(ms.Responses, response{Href: hrefFor(p), Status: status(http.StatusNotFound)})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		calPath := parentPath(p)
+		floating, has := zones[calPath]
+		if !has {
+			cal, err := h.Backend.Calendar(calPath)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			floating = floatingZone(cal.TimeZone)
+			zones[calPath] = floating
+		}
+		resp, err := reportResponse(obj, multiget.propSelection, floating)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+	}
+	writeMultistatus(w, ms)
+	return nil
+}
+
+// Builds the response for one object in a report, which unlike PROPFIND can
+// ask for the object's data.
+func reportResponse(obj Object, sel propSelection, floating *time.Location) (response, error) {
+	props, err := objectProps(obj)
+	if err != nil {
+		return response{}, err
+	}
+	if sel.Prop != nil && sel.Prop.CalendarData != nil {
+		data, err := sel.Prop.CalendarData.apply(obj.Data, floating)
+		if err != nil {
+			return response{}, err
+		}
+		raw, err := encodeObject(data)
+		if err != nil {
+			return response{}, err
+		}
+		props[calCalendarData] = escapeText(string(raw))
+	}
+	return propResponse(obj.Path, props, sel), nil
+}
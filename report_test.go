@@ -0,0 +1,87 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_calendarQuery(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	do(t, h, "MKCALENDAR", "/cal/work/", "")
+	do(t, h, "PUT", "/cal/work/e1.ics", testEvent)
+	do(t, h, "PUT", "/cal/work/e2.ics", filterEvent)
+
+	query := `<?xml version="1.0"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+    <C:prop-filter name="SUMMARY"><C:text-match>review</C:text-match></C:prop-filter>
+  </C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+	rec := do(t, h, "REPORT", "/cal/work/", query, "Depth", "1")
+	body := rec.Body.String()
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("\nREPORT: expected 207, got %d: %s\n", rec.Code, body)
+	}
+	if !strings.Contains(body, "/cal/work/e2.ics") || strings.Contains(body, "/cal/work/e1.ics") {
+		t.Errorf("\nREPORT matched the wrong objects:\n%s\n", body)
+	}
+	if !strings.Contains(body, "UID:event-2@example.com") {
+		t.Errorf("\nREPORT lacks calendar-data:\n%s\n", body)
+	}
+
+	rec = do(t, h, "REPORT", "/cal/work/e1.ics", query)
+	if strings.Contains(rec.Body.String(), "<response>") {
+		t.Errorf("\nREPORT on a non-matching object matched:\n%s\n", rec.Body)
+	}
+	rec = do(t, h, "REPORT", "/cal/work/", strings.Replace(query, "<C:text-match>", `<C:text-match collation="i;unicode-casemap">`, 1))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("\nREPORT with unknown collation: expected 403, got %d\n", rec.Code)
+	}
+	rec = do(t, h, "REPORT", "/cal/work/", `<D:expand-property xmlns:D="DAV:"/>`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("\nunsupported REPORT: expected 403, got %d\n", rec.Code)
+	}
+	rec = do(t, h, "PROPFIND", "/cal/work/", "", "Depth", "0")
+	if !strings.Contains(rec.Body.String(), "calendar-query") {
+		t.Errorf("\nsupported-report-set lacks calendar-query:\n%s\n", rec.Body)
+	}
+}
+
+func Test_calendarMultiget(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	do(t, h, "MKCALENDAR", "/cal/work/", "")
+	do(t, h, "PUT", "/cal/work/e1.ics", testEvent)
+	do(t, h, "PUT", "/cal/work/w.ics", recurringEvent)
+
+	rec := do(t, h, "REPORT", "/cal/work/", `<?xml version="1.0"?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data>
+      <C:comp name="VCALENDAR"><C:prop name="VERSION"/>
+        <C:comp name="VEVENT"><C:prop name="SUMMARY"/></C:comp>
+      </C:comp>
+    </C:calendar-data>
+  </D:prop>
+  <D:href>/cal/work/e1.ics</D:href>
+  <D:href>http://example.com/cal/work/w.ics</D:href>
+  <D:href>/cal/work/missing.ics</D:href>
+</C:calendar-multiget>`, "Depth", "1")
+	body := rec.Body.String()
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("\nREPORT: expected 207, got %d: %s\n", rec.Code, body)
+	}
+	for _, want := range []string{
+		"<href>/cal/work/e1.ics</href>", "<href>/cal/work/w.ics</href>",
+		"SUMMARY:Standup", "SUMMARY:Moved", "<href>/cal/work/missing.ics</href><status>HTTP/1.1 404 Not Found</status>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("\nmultiget response lacks %s:\n%s\n", want, body)
+		}
+	}
+	if strings.Contains(body, "UID:") || strings.Contains(body, "DTSTART") {
+		t.Errorf("\nmultiget returned properties that weren't asked for:\n%s\n", body)
+	}
+}
@@ -0,0 +1,495 @@
+package caldav
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// Every principal with a calendar home gets a scheduling inbox and outbox in
+// it, see RFC 6638 s. 2. The inbox is a collection in the Backend, created
+// the first time something is delivered to it; the outbox only exists to be
+// POSTed to.
+const (
+	inboxName  = "inbox/"
+	outboxName = "outbox/"
+)
+
+func scheduleInbox(pr Principal) string {
+	if pr.CalendarHome == "" {
+		return ""
+	}
+	return collectionPath(pr.CalendarHome) + inboxName
+}
+
+func scheduleOutbox(pr Principal) string {
+	if pr.CalendarHome == "" {
+		return ""
+	}
+	return collectionPath(pr.CalendarHome) + outboxName
+}
+
+var (
+	inboxResourceType = emptyElement(xml.Name{Space: davNS, Local: "collection"}) +
+		emptyElement(xml.Name{Space: caldavNS, Local: "schedule-inbox"})
+	outboxResourceType = emptyElement(xml.Name{Space: davNS, Local: "collection"}) +
+		emptyElement(xml.Name{Space: caldavNS, Local: "schedule-outbox"})
+)
+
+var (
+	errNotOutbox        = httpError{http.StatusMethodNotAllowed, "POST is only allowed on a scheduling outbox"}
+	errBadFreeBusy      = httpError{http.StatusBadRequest, "Request body is not a VFREEBUSY REQUEST"}
+	errNotOrganizer     = httpError{http.StatusForbidden, "ORGANIZER is not the owner of the outbox"}
+	errNoPrincipalMatch = errors.New("No principal matches")
+	errNoFreeBusy       = errors.New("Not allowed to read the calendar user's free-busy time")
+)
+
+// Finds the first principal that match accepts, or fails with
+// errNoPrincipalMatch.
+func (h *Handler) findPrincipal(match func(Principal) bool) (Principal, error) {
+	if h.Principals == nil {
+		return Principal{}, errNoPrincipalMatch
+	}
+	prs, err := h.Principals.Principals()
+	if err != nil {
+		return Principal{}, err
+	}
+	for _, pr := range prs {
+		if match(pr) {
+			return pr, nil
+		}
+	}
+	return Principal{}, errNoPrincipalMatch
+}
+
+// Returns the principal whose calendar home p is in.
+func (h *Handler) homeOwner(p string) (Principal, error) {
+	return h.findPrincipal(func(pr Principal) bool {
+		return pr.CalendarHome != "" && strings.HasPrefix(p, collectionPath(pr.CalendarHome))
+	})
+}
+
+// Returns the local principal with a calendar user address.
+func (h *Handler) principalAt(addr string) (Principal, error) {
+	return h.findPrincipal(func(pr Principal) bool { return hasAddress(pr, addr) })
+}
+
+// Reports whether the calendar at p is somebody's scheduling inbox.
+func (h *Handler) isInbox(p string) (bool, error) {
+	_, err := h.findPrincipal(func(pr Principal) bool { return scheduleInbox(pr) == p })
+	if errors.Is(err, errNoPrincipalMatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Puts an iTIP message in the inbox of the local principal at addr. Calendar
+// users we don't host are skipped, since we have no way to reach them.
+func (h *Handler) deliver(addr string, msg icalendar.Component) error {
+	pr, err := h.principalAt(addr)
+	if errors.Is(err, errNoPrincipalMatch) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	inbox := scheduleInbox(pr)
+	if inbox == "" {
+		return nil
+	}
+	err = h.Backend.CreateCalendar(Calendar{Path: inbox, DisplayName: "Inbox"})
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return err
+	}
+	uid := itipUID(msg)
+	sum := sha256.Sum256([]byte(uid + msg.Value("METHOD") + time.Now().Format(time.RFC3339Nano)))
+	name := hex.EncodeToString(sum[:16]) + ".ics"
+	_, err = h.Backend.PutObject(inbox+name, msg, Condition{})
+	return err
+}
+
+func itipUID(msg icalendar.Component) string {
+	for _, c := range msg.Components {
+		if uid := c.Value("UID"); uid != "" {
+			return uid
+		}
+	}
+	return ""
+}
+
+// Does the implicit scheduling of RFC 6638 s. 3.2 after the object at p
+// changed from old to new, where old is nil for objects that were just
+// created and new for those just deleted. What happens depends on whether the
+// owner of the calendar is the organizer or an attendee: organizers send
+// REQUESTs and CANCELs to attendees, attendees REPLY to the organizer when
+// their PARTSTAT changes. Only local calendar users take part.
+//
+// The change is already stored, so failing to send a message doesn't undo
+// it. The error is logged, and the calendar users that were not reached are
+// returned so that the object can say so in their SCHEDULE-STATUS.
+func (h *Handler) schedule(p string, old, new *icalendar.Component) (failed []string) {
+	if h.Principals == nil {
+		return nil
+	}
+	owner, err := h.homeOwner(p)
+	if errors.Is(err, errNoPrincipalMatch) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("caldav: scheduling %s: %v", p, err)
+		return nil
+	}
+	if parentPath(p) == scheduleInbox(owner) {
+		return nil
+	}
+	data := new
+	if data == nil {
+		data = old
+	}
+	organizer := organizerOf(*data)
+	switch {
+	case organizer == "":
+		return nil
+	case hasAddress(owner, organizer):
+		return h.scheduleAsOrganizer(owner, old, new)
+	}
+	if err := h.scheduleAsAttendee(owner, organizer, old, new); err != nil {
+		log.Printf("caldav: replying to %s: %v", organizer, err)
+		return []string{organizer}
+	}
+	return nil
+}
+
+// Records in a scheduling object that messages to some calendar users could
+// not be delivered, by setting SCHEDULE-STATUS 5.1 on their ATTENDEE, or
+// ORGANIZER, fields, see RFC 6638 s. 3.2.9. Returns the object as stored
+// after that, and whether it was changed.
+func (h *Handler) markUndelivered(obj Object, addrs []string) (Object, bool) {
+	data := obj.Data
+	organizer := organizerOf(data)
+	data.Components = append([]icalendar.Component(nil), data.Components...)
+	for i, c := range data.Components {
+		fields := append([]icalendar.Field(nil), c.Fields...)
+		for j, f := range fields {
+			switch strings.ToUpper(f.Name) {
+			case "ATTENDEE":
+				if icalendar.SameAddress(f.Value, organizer) {
+					continue
+				}
+			case "ORGANIZER":
+			default:
+				continue
+			}
+			if !containsAddress(addrs, f.Value) {
+				continue
+			}
+			params := make(map[string][]string, len(f.Params)+1)
+			for name, vals := range f.Params {
+				params[name] = vals
+			}
+			params["SCHEDULE-STATUS"] = []string{"5.1"}
+			fields[j].Params = params
+		}
+		data.Components[i].Fields = fields
+	}
+	marked, err := h.Backend.PutObject(obj.Path, data, Condition{IfMatch: []string{obj.ETag}})
+	if err != nil {
+		log.Printf("caldav: recording SCHEDULE-STATUS of %s: %v", obj.Path, err)
+		return obj, false
+	}
+	return marked, true
+}
+
+func organizerOf(data icalendar.Component) string {
+	for _, c := range data.Components {
+		if org := c.Value("ORGANIZER"); org != "" {
+			return org
+		}
+	}
+	return ""
+}
+
+// Returns the addresses of every attendee of a scheduling object, or none for
+// a nil one.
+func attendeesOf(data *icalendar.Component) []string {
+	if data == nil {
+		return nil
+	}
+	var addrs []string
+	for _, c := range data.Components {
+		for _, f := range c.FieldsNamed("ATTENDEE") {
+			if !containsAddress(addrs, f.Value) {
+				addrs = append(addrs, f.Value)
+			}
+		}
+	}
+	return addrs
+}
+
+func containsAddress(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if icalendar.SameAddress(a, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the attendees that messages could not be delivered to.
+func (h *Handler) scheduleAsOrganizer(owner Principal, old, new *icalendar.Component) (failed []string) {
+	before, after := attendeesOf(old), attendeesOf(new)
+	// Changes to attendees' PARTSTATs alone don't need another REQUEST
+	changed := old == nil || new == nil || scheduleTag(*old) != scheduleTag(*new)
+	for _, addr := range after {
+		if hasAddress(owner, addr) || (!changed && containsAddress(before, addr)) {
+			continue
+		}
+		if err := h.deliver(addr, icalendar.Request(*new)); err != nil {
+			log.Printf("caldav: delivering to %s: %v", addr, err)
+			failed = append(failed, addr)
+		}
+	}
+	for _, addr := range before {
+		if hasAddress(owner, addr) || containsAddress(after, addr) {
+			continue
+		}
+		if err := h.deliver(addr, icalendar.Cancel(*old, time.Now(), addr)); err != nil {
+			log.Printf("caldav: delivering to %s: %v", addr, err)
+			failed = append(failed, addr)
+		}
+	}
+	return
+}
+
+func (h *Handler) scheduleAsAttendee(owner Principal, organizer string, old, new *icalendar.Component) error {
+	_, oldStatus, hadOld := ownStatus(owner, old)
+	addr, newStatus, hasNew := ownStatus(owner, new)
+	switch {
+	case !hadOld && !hasNew:
+		return nil
+	case new == nil || !hasNew:
+		newStatus = icalendar.PSDeclined
+	case old == nil && newStatus == icalendar.PSNeedsAction:
+		return nil
+	case oldStatus == newStatus:
+		return nil
+	}
+	// Attendees that removed themselves answer from the old copy
+	data := new
+	if !hasNew {
+		data = old
+		addr, _, _ = ownStatus(owner, old)
+	}
+	reply, err := icalendar.Reply(*data, addr, newStatus, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := h.deliver(organizer, reply); err != nil {
+		return err
+	}
+	return h.applyReply(organizer, reply)
+}
+
+// Returns the address and PARTSTAT the owner has in the master component of a
+// scheduling object, or the first one they're invited to.
+func ownStatus(owner Principal, data *icalendar.Component) (addr string, status icalendar.ParticipantStatus, found bool) {
+	if data == nil {
+		return
+	}
+	for _, c := range data.Components {
+		for _, f := range c.FieldsNamed("ATTENDEE") {
+			if hasAddress(owner, f.Value) {
+				return f.Value, f.ParticipantStatus(), true
+			}
+		}
+	}
+	return
+}
+
+// Records the PARTSTATs of a REPLY in the organizer's copy of the object, if
+// the organizer is local and still has it. Replies the copy has moved on from
+// are dropped.
+func (h *Handler) applyReply(organizer string, reply icalendar.Component) error {
+	pr, err := h.principalAt(organizer)
+	if errors.Is(err, errNoPrincipalMatch) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	obj, err := h.findScheduled(pr, itipUID(reply))
+	if obj == nil || err != nil {
+		return err
+	}
+	data, err := icalendar.Apply(obj.Data, reply)
+	if err != nil {
+		return nil
+	}
+	_, err = h.Backend.PutObject(obj.Path, data, Condition{IfMatch: []string{obj.ETag}})
+	return err
+}
+
+// Finds the scheduling object with a UID among a principal's calendars,
+// skipping the inbox. Returns nil if there is none.
+func (h *Handler) findScheduled(pr Principal, uid string) (*Object, error) {
+	if pr.CalendarHome == "" {
+		return nil, nil
+	}
+	cals, err := h.Backend.Calendars(collectionPath(pr.CalendarHome))
+	if err != nil {
+		return nil, err
+	}
+	for _, cal := range cals {
+		if cal.Path == scheduleInbox(pr) {
+			continue
+		}
+		objs, err := h.Backend.Objects(cal.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objs {
+			if itipUID(o.Data) == uid {
+				return &o, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Answers a free/busy request POSTed to an outbox, see RFC 6638 s. 5, with
+// the busy time of each attendee over the requested range.
+func (h *Handler) servePost(w http.ResponseWriter, r *http.Request) error {
+	p := collectionPath(cleanPath(r.URL.Path))
+	// Privileges are checked before looking, so that users without them
+	// can't tell whether there is an outbox
+	a, err := h.access(r)
+	if err != nil {
+		return err
+	}
+	if err := a.check(p, PrivBind); err != nil {
+		return err
+	}
+	owner, err := h.findPrincipal(func(pr Principal) bool { return scheduleOutbox(pr) == p })
+	if errors.Is(err, errNoPrincipalMatch) {
+		return errNotOutbox
+	}
+	if err != nil {
+		return err
+	}
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "text/calendar" {
+		return errBadContentType
+	}
+	data, err := h.Limits.readObject(w, r)
+	if err != nil {
+		return err
+	}
+	comps := data.ComponentsNamed("VFREEBUSY")
+	if !strings.EqualFold(data.Value("METHOD"), "REQUEST") || len(comps) != 1 {
+		return errBadFreeBusy
+	}
+	req, err := icalendar.ParseVFreeBusy(comps[0])
+	if err != nil || req.Start.IsZero() || !req.End.After(req.Start) {
+		return errBadFreeBusy
+	}
+	if !hasAddress(owner, req.Organizer.Address) {
+		return errNotOrganizer
+	}
+	var resp scheduleResponse
+	for _, attendee := range req.Attendees {
+		rr := recipientResponse{Recipient: davHref{attendee.Address}}
+		pr, err := h.principalAt(attendee.Address)
+		switch {
+		case errors.Is(err, errNoPrincipalMatch):
+			rr.RequestStatus = "3.7;Invalid calendar user"
+		case err != nil:
+			return err
+		default:
+			reply, err := h.freeBusyReply(a, pr, req, attendee)
+			if errors.Is(err, errNoFreeBusy) {
+				rr.RequestStatus = "3.8;No authority"
+				break
+			} else if err != nil {
+				return err
+			}
+			raw, err := encodeObject(reply)
+			if err != nil {
+				return err
+			}
+			rr.RequestStatus = "2.0;Success"
+			rr.CalendarData = string(raw)
+		}
+		resp.Responses = append(resp.Responses, rr)
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(resp)
+	return nil
+}
+
+// Computes a principal's busy time for a free/busy request, over the
+// calendars in its home that the current user may read the free-busy time of.
+// Fails with errNoFreeBusy if there are none and the home isn't theirs.
+func (h *Handler) freeBusyReply(a *access, pr Principal, req icalendar.VFreeBusy, attendee icalendar.Attendee) (icalendar.Component, error) {
+	var objs []icalendar.Component
+	home := collectionPath(pr.CalendarHome)
+	allowed, err := a.can(home, PrivReadFreeBusy)
+	if err != nil {
+		return icalendar.Component{}, err
+	}
+	cals, err := h.Backend.Calendars(home)
+	if err != nil {
+		return icalendar.Component{}, err
+	}
+	for _, cal := range cals {
+		if cal.Path == scheduleInbox(pr) {
+			continue
+		}
+		if ok, err := a.can(cal.Path, PrivReadFreeBusy); err != nil {
+			return icalendar.Component{}, err
+		} else if !ok {
+			continue
+		}
+		allowed = true
+		found, err := h.Backend.QueryObjects(cal.Path, req.Start, req.End)
+		if err != nil {
+			return icalendar.Component{}, err
+		}
+		for _, o := range found {
+			objs = append(objs, o.Data)
+		}
+	}
+	if !allowed {
+		return icalendar.Component{}, errNoFreeBusy
+	}
+	busy, err := icalendar.FreeBusy(objs, req.Start, req.End)
+	if err != nil {
+		return icalendar.Component{}, err
+	}
+	fb := icalendar.VFreeBusy{
+		UID:       req.UID,
+		Stamp:     time.Now().UTC().Truncate(time.Second),
+		Start:     req.Start,
+		End:       req.End,
+		Organizer: req.Organizer,
+		Attendees: []icalendar.Attendee{attendee},
+		Busy:      busy,
+	}
+	return icalendar.Component{
+		Name: "VCALENDAR",
+		Fields: []icalendar.Field{
+			{Name: "VERSION", Value: "2.0"},
+			{Name: "PRODID", Value: prodID},
+			{Name: "METHOD", Value: "REPLY"},
+		},
+		Components: []icalendar.Component{fb.Component()},
+	}, nil
+}
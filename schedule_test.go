@@ -0,0 +1,205 @@
+package caldav
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+func scheduleHandler() *Handler {
+	principals := NewMemoryPrincipals()
+	principals.AddPrincipal(Principal{
+		Path:         "/principals/alice/",
+		CalendarHome: "/cal/alice/",
+		Addresses:    []string{"mailto:alice@example.com"},
+	}, "alice", "secret")
+	principals.AddPrincipal(Principal{
+		Path:         "/principals/bob/",
+		CalendarHome: "/cal/bob/",
+		Addresses:    []string{"mailto:bob@example.com"},
+	}, "bob", "hunter2")
+	principals.AddPrincipal(Principal{
+		Path:         "/principals/carol/",
+		CalendarHome: "/cal/carol/",
+		Addresses:    []string{"mailto:carol@example.com"},
+	}, "carol", "carol")
+	h := &Handler{Backend: NewMemoryBackend(), Principals: principals}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/alice/work/"})
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/bob/personal/", ACL: []ACE{
+		{"/principals/alice/", []Privilege{PrivReadFreeBusy}},
+	}})
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/carol/work/"})
+	return h
+}
+
+// Returns the METHODs of the messages in an inbox.
+func inboxMethods(t *testing.T, h *Handler, inbox string) []string {
+	objs, err := h.Backend.Objects(inbox)
+	if err != nil {
+		t.Fatalf("\nlisting %s: %s\n", inbox, err)
+	}
+	var methods []string
+	for _, o := range objs {
+		methods = append(methods, o.Data.Value("METHOD"))
+	}
+	return methods
+}
+
+func Test_implicitScheduling(t *testing.T) {
+	h := scheduleHandler()
+	alice := []string{"Authorization", auth("alice", "secret")}
+	bob := []string{"Authorization", auth("bob", "hunter2")}
+	meeting := strings.Replace(meetingEvent, "END:VEVENT",
+		"ATTENDEE:mailto:carol@example.net\r\nBEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT5M\r\nEND:VALARM\r\nEND:VEVENT", 1)
+
+	if rec := do(t, h, "PUT", "/cal/alice/work/m.ics", meeting, alice...); rec.Code != http.StatusCreated {
+		t.Fatalf("\nPUT by organizer: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	objs, _ := h.Backend.Objects("/cal/bob/inbox/")
+	if len(objs) != 1 || objs[0].Data.Value("METHOD") != "REQUEST" || len(objs[0].Data.Components[0].ComponentsNamed("VALARM")) != 0 {
+		t.Fatalf("\nexpected a REQUEST without alarms in the attendee's inbox, got %v\n", objs)
+	}
+	// Resending an unchanged event doesn't invite again
+	do(t, h, "PUT", "/cal/alice/work/m.ics", meeting, alice...)
+	if methods := inboxMethods(t, h, "/cal/bob/inbox/"); len(methods) != 1 {
+		t.Errorf("\nunchanged event was sent again: %v\n", methods)
+	}
+	before, _ := h.Backend.Object("/cal/alice/work/m.ics")
+
+	accepted := strings.Replace(meetingEvent, "PARTSTAT=NEEDS-ACTION;RSVP=TRUE", "PARTSTAT=ACCEPTED", 1)
+	if rec := do(t, h, "PUT", "/cal/bob/personal/m.ics", accepted, bob...); rec.Code != http.StatusCreated {
+		t.Fatalf("\nPUT by attendee: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	if methods := inboxMethods(t, h, "/cal/alice/inbox/"); len(methods) != 1 || methods[0] != "REPLY" {
+		t.Errorf("\nexpected a REPLY in the organizer's inbox, got %v\n", methods)
+	}
+	bobAttendee := Principal{Addresses: []string{"mailto:bob@example.com"}}
+	after, _ := h.Backend.Object("/cal/alice/work/m.ics")
+	if _, status, _ := ownStatus(bobAttendee, &after.Data); status != "ACCEPTED" {
+		t.Errorf("\nreply did not update the organizer's copy:\n%v\n", after.Data)
+	}
+	if after.ScheduleTag != before.ScheduleTag || after.ETag == before.ETag {
+		t.Errorf("\nreply should change the ETag but not the Schedule-Tag\n")
+	}
+
+	// Declining by deleting the event
+	if rec := do(t, h, "DELETE", "/cal/bob/personal/m.ics", "", bob...); rec.Code != http.StatusNoContent {
+		t.Fatalf("\nDELETE by attendee: expected 204, got %d\n", rec.Code)
+	}
+	after, _ = h.Backend.Object("/cal/alice/work/m.ics")
+	if _, status, _ := ownStatus(bobAttendee, &after.Data); status != "DECLINED" {
+		t.Errorf("\ndeleting did not decline:\n%v\n", after.Data)
+	}
+
+	uninvited := strings.Replace(meeting, "ATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com\r\n", "", 1)
+	do(t, h, "PUT", "/cal/alice/work/m.ics", uninvited, alice...)
+	if methods := inboxMethods(t, h, "/cal/bob/inbox/"); len(methods) != 2 || !strings.Contains(strings.Join(methods, " "), "CANCEL") {
+		t.Errorf("\nexpected a CANCEL for the removed attendee, got %v\n", methods)
+	}
+}
+
+// A Backend whose scheduling inboxes can't be written to.
+type undeliverableBackend struct{ Backend }
+
+func (b undeliverableBackend) PutObject(p string, data icalendar.Component, cond Condition) (Object, error) {
+	if strings.Contains(p, "/"+inboxName) {
+		return Object{}, errors.New("no space left on device")
+	}
+	return b.Backend.PutObject(p, data, cond)
+}
+
+func Test_implicitScheduling_undelivered(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	h := scheduleHandler()
+	h.Backend = undeliverableBackend{h.Backend}
+
+	rec := do(t, h, "PUT", "/cal/alice/work/m.ics", meetingEvent, "Authorization", auth("alice", "secret"))
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") != "" {
+		t.Fatalf("\nPUT by organizer: expected 201 without an ETag, got %d %q: %s\n", rec.Code, rec.Header().Get("ETag"), rec.Body)
+	}
+	obj, _ := h.Backend.Object("/cal/alice/work/m.ics")
+	if attendee, _ := obj.Data.Components[0].Field("ATTENDEE"); strings.Join(attendee.Params["SCHEDULE-STATUS"], ",") != "5.1" {
+		t.Errorf("\nexpected SCHEDULE-STATUS 5.1 on the attendee:\n%v\n", obj.Data)
+	}
+
+	accepted := strings.Replace(meetingEvent, "PARTSTAT=NEEDS-ACTION;RSVP=TRUE", "PARTSTAT=ACCEPTED", 1)
+	if rec := do(t, h, "PUT", "/cal/bob/personal/m.ics", accepted, "Authorization", auth("bob", "hunter2")); rec.Code != http.StatusCreated {
+		t.Fatalf("\nPUT by attendee: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	obj, _ = h.Backend.Object("/cal/bob/personal/m.ics")
+	if organizer, _ := obj.Data.Components[0].Field("ORGANIZER"); organizer.Params["SCHEDULE-STATUS"] == nil {
+		t.Errorf("\nexpected SCHEDULE-STATUS on the organizer:\n%v\n", obj.Data)
+	}
+	if rec := do(t, h, "DELETE", "/cal/alice/work/m.ics", "", "Authorization", auth("alice", "secret")); rec.Code != http.StatusNoContent {
+		t.Errorf("\nDELETE by organizer: expected 204, got %d: %s\n", rec.Code, rec.Body)
+	}
+}
+
+func Test_schedulingCollections(t *testing.T) {
+	h := scheduleHandler()
+	alice := []string{"Authorization", auth("alice", "secret")}
+	rec := do(t, h, "PROPFIND", "/principals/alice/", "", append([]string{"Depth", "0"}, alice...)...)
+	for _, want := range []string{
+		`<schedule-inbox-URL xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">/cal/alice/inbox/</href>`,
+		`<schedule-outbox-URL xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">/cal/alice/outbox/</href>`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("\nprincipal lacks %s:\n%s\n", want, rec.Body)
+		}
+	}
+	rec = do(t, h, "PROPFIND", "/cal/alice/", "", append([]string{"Depth", "1"}, alice...)...)
+	for _, want := range []string{"<href>/cal/alice/inbox/</href>", "<href>/cal/alice/outbox/</href>", "<schedule-outbox "} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("\ncalendar home lacks %s:\n%s\n", want, rec.Body)
+		}
+	}
+
+	do(t, h, "PUT", "/cal/bob/personal/e.ics", strings.Replace(testEvent, "event-1", "busy", 1), "Authorization", auth("bob", "hunter2"))
+	request := vcalendar(
+		"METHOD:REQUEST",
+		"BEGIN:VFREEBUSY",
+		"UID:fb-1",
+		"DTSTAMP:20240101T000000Z",
+		"DTSTART:20240101T000000Z",
+		"DTEND:20240102T000000Z",
+		"ORGANIZER:mailto:alice@example.com",
+		"ATTENDEE:mailto:bob@example.com",
+		"ATTENDEE:mailto:carol@example.com",
+		"ATTENDEE:mailto:nobody@example.com",
+		"END:VFREEBUSY",
+	)
+	rec = do(t, h, "POST", "/cal/alice/outbox/", request, append([]string{"Content-Type", "text/calendar"}, alice...)...)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("\nPOST to outbox: expected 200, got %d: %s\n", rec.Code, body)
+	}
+	for _, want := range []string{
+		"<request-status>2.0;Success</request-status>",
+		"FREEBUSY;FBTYPE=BUSY:20240101T090000Z/20240101T100000Z",
+		`<href xmlns="DAV:">mailto:carol@example.com</href></recipient><request-status>3.8;`,
+		`<href xmlns="DAV:">mailto:nobody@example.com</href></recipient><request-status>3.7;`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("\nschedule-response lacks %s:\n%s\n", want, body)
+		}
+	}
+	if rec := do(t, h, "POST", "/cal/alice/outbox/", request, "Content-Type", "text/calendar", "Authorization", auth("bob", "hunter2")); rec.Code != http.StatusForbidden {
+		t.Errorf("\nPOST to another's outbox: expected 403, got %d\n", rec.Code)
+	}
+	if rec := do(t, h, "POST", "/cal/alice/work/", request, append([]string{"Content-Type", "text/calendar"}, alice...)...); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("\nPOST to a calendar: expected 405, got %d\n", rec.Code)
+	}
+	// Without logging in, outboxes and other paths look the same
+	for _, target := range []string{"/cal/alice/outbox/", "/cal/alice/work/", "/nowhere/"} {
+		if rec := do(t, h, "POST", target, request, "Content-Type", "text/calendar"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("\nPOST to %s without logging in: expected 401, got %d\n", target, rec.Code)
+		}
+	}
+}
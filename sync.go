@@ -0,0 +1,89 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	errInvalidSyncToken = preconditionError{
+		httpError: httpError{http.StatusForbidden, "Invalid sync token"},
+		cond:      xml.Name{Space: davNS, Local: "valid-sync-token"},
+	}
+	errTooManyMatches = preconditionError{
+		httpError: httpError{http.StatusForbidden, "Too many changes for the requested limit"},
+		cond:      xml.Name{Space: davNS, Local: "number-of-matches-within-limits"},
+	}
+	errBadSyncLevel = httpError{http.StatusBadRequest, "sync-level must be 1 or infinite"}
+)
+
+// Sync tokens must be URIs (RFC 6578 s. 3.2), so the backend's change tokens
+// are wrapped in one.
+const syncTokenPrefix = "data:,"
+
+func syncTokenURI(token string) string {
+	return syncTokenPrefix + token
+}
+
+func changeToken(uri string) (string, error) {
+	if uri == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(uri, syncTokenPrefix) {
+		return "", errInvalidSyncToken
+	}
+	return strings.TrimPrefix(uri, syncTokenPrefix), nil
+}
+
+// Answers a sync-collection report, see RFC 6578 s. 3. Calendar collections
+// hold no other collections, so both sync levels report the same members.
+func (h *Handler) serveSyncCollection(w http.ResponseWriter, p string, sync syncCollection) error {
+	switch strings.TrimSpace(sync.SyncLevel) {
+	case "1", "infinite", "infinity":
+	default:
+		return errBadSyncLevel
+	}
+	if err := sync.propSelection.validate(); err != nil {
+		return err
+	}
+	cal, err := h.Backend.Calendar(collectionPath(p))
+	if err != nil {
+		return err
+	}
+	since, err := changeToken(strings.TrimSpace(sync.SyncToken))
+	if err != nil {
+		return err
+	}
+	changed, deleted, token, err := h.Backend.Changes(cal.Path, since)
+	if err != nil {
+		return err
+	}
+	if sync.Limit != nil && len(changed)+len(deleted) > sync.Limit.NResults {
+		return errTooManyMatches
+	}
+	floating := floatingZone(cal.TimeZone)
+	ms := multistatus{SyncToken: syncTokenURI(token)}
+	for _, objPath := range changed {
+		obj, err := h.Backend.Object(objPath)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted since the backend listed the changes
+			ms.Responses = append(ms.Responses, response{Href: hrefFor(objPath), Status: status(http.StatusNotFound)})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := reportResponse(obj, sync.propSelection, floating)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+	}
+	for _, objPath := range deleted {
+		ms.Responses = append(ms.Responses, response{Href: hrefFor(objPath), Status: status(http.StatusNotFound)})
+	}
+	writeMultistatus(w, ms)
+	return nil
+}
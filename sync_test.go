@@ -0,0 +1,65 @@
+package caldav
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var syncTokenElement = regexp.MustCompile(`<sync-token>([^<]*)</sync-token>`)
+
+func Test_syncCollection(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	do(t, h, "MKCALENDAR", "/cal/work/", "")
+	do(t, h, "PUT", "/cal/work/e1.ics", testEvent)
+	do(t, h, "PUT", "/cal/work/e2.ics", filterEvent)
+
+	sync := func(token string) (string, string) {
+		rec := do(t, h, "REPORT", "/cal/work/", `<?xml version="1.0"?>
+<D:sync-collection xmlns:D="DAV:">
+  <D:sync-token>`+token+`</D:sync-token>
+  <D:sync-level>1</D:sync-level>
+  <D:prop><D:getetag/></D:prop>
+</D:sync-collection>`)
+		body := rec.Body.String()
+		if rec.Code != http.StatusMultiStatus {
+			t.Fatalf("\nsync-collection: expected 207, got %d: %s\n", rec.Code, body)
+		}
+		m := syncTokenElement.FindStringSubmatch(body)
+		if m == nil {
+			t.Fatalf("\nsync-collection response lacks a sync-token:\n%s\n", body)
+		}
+		return body, m[1]
+	}
+
+	body, token := sync("")
+	if !strings.Contains(body, "/cal/work/e1.ics") || !strings.Contains(body, "/cal/work/e2.ics") {
+		t.Errorf("\ninitial sync missed objects:\n%s\n", body)
+	}
+	rec := do(t, h, "PROPFIND", "/cal/work/", `<D:propfind xmlns:D="DAV:"><D:prop><D:sync-token/></D:prop></D:propfind>`, "Depth", "0")
+	if !strings.Contains(rec.Body.String(), token) {
+		t.Errorf("\nDAV:sync-token property doesn't match the report's token %s:\n%s\n", token, rec.Body)
+	}
+
+	do(t, h, "PUT", "/cal/work/e1.ics", strings.Replace(testEvent, "Standup", "Retro", 1))
+	do(t, h, "DELETE", "/cal/work/e2.ics", "")
+	body, next := sync(token)
+	if next == token {
+		t.Errorf("\nsync token didn't change\n")
+	}
+	if !strings.Contains(body, "<href>/cal/work/e1.ics</href><propstat>") ||
+		!strings.Contains(body, "<href>/cal/work/e2.ics</href><status>HTTP/1.1 404 Not Found</status>") {
+		t.Errorf("\nincremental sync missed changes:\n%s\n", body)
+	}
+	if body, _ := sync(next); strings.Contains(body, "<response>") {
+		t.Errorf("\nsync with a current token reported changes:\n%s\n", body)
+	}
+
+	rec = do(t, h, "REPORT", "/cal/work/", `<D:sync-collection xmlns:D="DAV:">
+  <D:sync-token>data:,bogus</D:sync-token><D:sync-level>1</D:sync-level><D:prop/>
+</D:sync-collection>`)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "<valid-sync-token") {
+		t.Errorf("\nbad sync token: expected 403 with valid-sync-token, got %d:\n%s\n", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,371 @@
+package caldav
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// A ConflictStrategy decides what a Syncer does with an object changed both
+// locally and on the server since they were last in step.
+type ConflictStrategy int
+
+const (
+	// Keep the server's version, dropping the local changes.
+	ServerWins ConflictStrategy = iota
+	// Keep the local version, overwriting the server's changes.
+	ClientWins
+	// Merge the two versions against the one they were last in step at, as
+	// icalendar.Merge does. Where both changed the same thing, the side whose
+	// object has the higher SEQUENCE wins, then the one with the later
+	// LAST-MODIFIED, then the server.
+	MergeChanges
+)
+
+// A Syncer keeps a calendar in a local Backend in step with the same calendar
+// on a server, so that it can be read and edited offline. The local calendar
+// has the same path as the remote one and is created on the first Sync.
+//
+// What the two sides last agreed on is kept in State, which the caller should
+// persist between runs; the zero SyncState starts from scratch, pulling every
+// remote object and pushing every local one.
+type Syncer struct {
+	Client   *Client
+	Local    Backend
+	Calendar string
+	Strategy ConflictStrategy
+	State    SyncState
+}
+
+// A SyncState is what a Syncer remembers of a calendar between runs. It
+// encodes as JSON.
+type SyncState struct {
+	// The sync token of the server's calendar at the last Sync, if it
+	// supports sync-collection reports.
+	SyncToken string
+	// The getctag of the server's calendar at the last Sync, if it has one.
+	CTag    string
+	Objects map[string]SyncedObject
+}
+
+// A SyncedObject is an object both sides last agreed on: its ETags on each
+// side and its content, the base for merging changes made since.
+type SyncedObject struct {
+	RemoteETag string
+	LocalETag  string
+	Base       icalendar.Component
+}
+
+// A SyncResult lists the paths of the objects a Sync touched.
+type SyncResult struct {
+	// Copied from the server to the local store.
+	Pulled []string
+	// Copied from the local store to the server.
+	Pushed []string
+	// Deleted on one side because they were deleted on the other.
+	Deleted []string
+	// Changed on both sides, and resolved by the Strategy.
+	Conflicts []string
+}
+
+// Returned when one side changed an object while a Sync was copying it to
+// there. The copy is skipped, and the next Sync resolves the change.
+var errChangedMeanwhile = errors.New("Object changed during the sync")
+
+// A side of a sync, the state of one object there: unchanged, changed or
+// deleted since the last Sync, and its content if it still exists.
+type syncSide struct {
+	changed bool
+	deleted bool
+	etag    string
+	data    icalendar.Component
+}
+
+// Brings the local calendar and the server's in step, pulling remote changes
+// and pushing local ones. An object changed on the server while it was being
+// pushed is left alone, to be resolved by the next Sync.
+func (s *Syncer) Sync() (res SyncResult, err error) {
+	calPath := collectionPath(s.Calendar)
+	if _, err = s.Local.Calendar(calPath); errors.Is(err, ErrNotFound) {
+		err = s.Local.CreateCalendar(Calendar{Path: calPath})
+	}
+	if err != nil {
+		return
+	}
+	if s.State.Objects == nil {
+		s.State.Objects = map[string]SyncedObject{}
+	}
+	remote, token, ctag, err := s.remoteChanges(calPath)
+	if err != nil {
+		return
+	}
+	local, err := s.localChanges(calPath)
+	if err != nil {
+		return
+	}
+
+	var fetch []string
+	for p, side := range remote {
+		if side.changed {
+			fetch = append(fetch, p)
+		}
+	}
+	if len(fetch) > 0 {
+		var objs []Object
+		if objs, err = s.Client.MultiGetCalendar(calPath, fetch); err != nil {
+			return
+		}
+		for _, obj := range objs {
+			side := remote[obj.Path]
+			side.etag, side.data = obj.ETag, obj.Data
+			remote[obj.Path] = side
+		}
+		for p, side := range remote {
+			// Deleted since the server listed the changes
+			if side.changed && side.data.Name == "" {
+				delete(remote, p)
+			}
+		}
+	}
+
+	paths := map[string]bool{}
+	for p := range remote {
+		paths[p] = true
+	}
+	for p := range local {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	for _, p := range sorted {
+		if err = s.reconcile(p, remote[p], local[p], &res); err != nil {
+			return
+		}
+	}
+	s.State.SyncToken, s.State.CTag = token, ctag
+	return
+}
+
+// Finds the objects that changed on the server since the last Sync, using a
+// sync-collection report if the server supports one and comparing ETags
+// otherwise.
+func (s *Syncer) remoteChanges(calPath string) (changes map[string]syncSide, token, ctag string, err error) {
+	changes = map[string]syncSide{}
+	changed, deleted, token, err := s.Client.SyncCalendar(calPath, s.State.SyncToken)
+	if err != nil && s.State.SyncToken != "" {
+		// The token may have expired
+		changed, deleted, token, err = s.Client.SyncCalendar(calPath, "")
+		s.State.SyncToken = ""
+	}
+	full := s.State.SyncToken == ""
+	if err != nil {
+		token = ""
+		var etags map[string]string
+		if etags, ctag, err = s.Client.ObjectETags(calPath); err != nil {
+			return
+		}
+		if ctag != "" && ctag == s.State.CTag {
+			return
+		}
+		changed, deleted, full = etags, nil, true
+	}
+	for p, etag := range changed {
+		if synced, ok := s.State.Objects[p]; !ok || synced.RemoteETag != etag {
+			changes[p] = syncSide{changed: true, etag: etag}
+		}
+	}
+	for _, p := range deleted {
+		if _, ok := s.State.Objects[p]; ok {
+			changes[p] = syncSide{deleted: true}
+		}
+	}
+	if full {
+		// Objects missing from a full listing are gone
+		for p := range s.State.Objects {
+			if _, ok := changed[p]; !ok {
+				changes[p] = syncSide{deleted: true}
+			}
+		}
+	}
+	return
+}
+
+// Finds the objects that changed in the local store since the last Sync.
+func (s *Syncer) localChanges(calPath string) (map[string]syncSide, error) {
+	objs, err := s.Local.Objects(calPath)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]syncSide{}
+	present := map[string]bool{}
+	for _, obj := range objs {
+		present[obj.Path] = true
+		if synced, ok := s.State.Objects[obj.Path]; !ok || synced.LocalETag != obj.ETag {
+			changes[obj.Path] = syncSide{changed: true, etag: obj.ETag, data: obj.Data}
+		}
+	}
+	for p := range s.State.Objects {
+		if !present[p] {
+			changes[p] = syncSide{deleted: true}
+		}
+	}
+	return changes, nil
+}
+
+// Brings one object in step given what happened to it on each side, listing
+// it in the result once that's done.
+func (s *Syncer) reconcile(p string, remote, local syncSide, res *SyncResult) error {
+	record := func(list *[]string, err error) error {
+		if errors.Is(err, errChangedMeanwhile) {
+			return nil
+		}
+		if err == nil {
+			*list = append(*list, p)
+		}
+		return err
+	}
+	synced := s.State.Objects[p]
+	switch {
+	case !local.changed && !local.deleted:
+		if remote.deleted {
+			return record(&res.Deleted, s.forget(p, s.Local.DeleteObject(p, Condition{IfMatch: []string{synced.LocalETag}})))
+		}
+		return record(&res.Pulled, s.pull(p, remote, synced.LocalETag))
+	case !remote.changed && !remote.deleted:
+		if local.deleted {
+			return record(&res.Deleted, s.forget(p, s.Client.DeleteObject(p, Condition{IfMatch: []string{synced.RemoteETag}})))
+		}
+		return record(&res.Pushed, s.push(p, local.data, local.etag, synced.RemoteETag))
+	case remote.deleted && local.deleted:
+		delete(s.State.Objects, p)
+		return nil
+	}
+
+	switch {
+	case s.Strategy == ClientWins && local.deleted:
+		return record(&res.Conflicts, s.forget(p, s.Client.DeleteObject(p, Condition{IfMatch: []string{remote.etag}})))
+	case s.Strategy == ClientWins || (remote.deleted && s.Strategy == MergeChanges):
+		return record(&res.Conflicts, s.push(p, local.data, local.etag, remote.etag))
+	case remote.deleted:
+		return record(&res.Conflicts, s.forget(p, s.Local.DeleteObject(p, Condition{IfMatch: []string{local.etag}})))
+	case s.Strategy == ServerWins || local.deleted:
+		return record(&res.Conflicts, s.pull(p, remote, local.etag))
+	}
+	merged := mergeObjects(synced.Base, local.data, remote.data)
+	stored, err := s.Local.PutObject(p, merged, Condition{IfMatch: []string{local.etag}})
+	if errors.Is(err, ErrPreconditionFailed) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return record(&res.Conflicts, s.push(p, stored.Data, stored.ETag, remote.etag))
+}
+
+// Copies the server's version of an object to the local store, replacing the
+// local one if it still has localETag, or provided there is none if that is
+// empty. Fails with errChangedMeanwhile otherwise.
+func (s *Syncer) pull(p string, remote syncSide, localETag string) error {
+	cond := Condition{IfNoneMatch: []string{"*"}}
+	if localETag != "" {
+		cond = Condition{IfMatch: []string{localETag}}
+	}
+	obj, err := s.Local.PutObject(p, remote.data, cond)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return errChangedMeanwhile
+	}
+	if err != nil {
+		return err
+	}
+	s.State.Objects[p] = SyncedObject{RemoteETag: remote.etag, LocalETag: obj.ETag, Base: obj.Data}
+	return nil
+}
+
+// Copies the local version of an object to the server, provided the server's
+// still has remoteETag, or doesn't exist if that is empty. Fails with
+// errChangedMeanwhile otherwise.
+func (s *Syncer) push(p string, data icalendar.Component, localETag, remoteETag string) error {
+	cond := Condition{IfNoneMatch: []string{"*"}}
+	if remoteETag != "" {
+		cond = Condition{IfMatch: []string{remoteETag}}
+	}
+	obj, err := s.Client.PutObject(p, data, cond)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return errChangedMeanwhile
+	}
+	if err != nil {
+		return err
+	}
+	if obj.ETag == "" {
+		// The server changed the object as it stored it, so the local copy is
+		// out of date
+		if obj, err = s.Client.GetObject(p); err != nil {
+			return err
+		}
+		return s.pull(p, syncSide{etag: obj.ETag, data: obj.Data}, localETag)
+	}
+	s.State.Objects[p] = SyncedObject{RemoteETag: obj.ETag, LocalETag: localETag, Base: data}
+	return nil
+}
+
+// Drops an object deleted on both sides from the state, treating one
+// already gone as deleted. A delete that failed its precondition fails with
+// errChangedMeanwhile.
+func (s *Syncer) forget(p string, err error) error {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		if errors.Is(err, ErrPreconditionFailed) {
+			return errChangedMeanwhile
+		}
+		return err
+	}
+	delete(s.State.Objects, p)
+	return nil
+}
+
+// Merges two versions of a VCALENDAR changed independently since base,
+// settling conflicts in favour of the newer version; see MergeChanges.
+func mergeObjects(base, ours, theirs icalendar.Component) icalendar.Component {
+	if newerVersion(masterComponent(ours), masterComponent(theirs)) {
+		merged, _ := icalendar.Merge(base, ours, theirs)
+		return merged
+	}
+	merged, _ := icalendar.Merge(base, theirs, ours)
+	return merged
+}
+
+// Returns the component of an object its SEQUENCE and LAST-MODIFIED are
+// read from: the master of its recurrence set, or its first component.
+func masterComponent(cal icalendar.Component) icalendar.Component {
+	for _, c := range cal.Components {
+		if _, has := c.Field("UID"); has && c.Value("RECURRENCE-ID") == "" {
+			return c
+		}
+	}
+	if len(cal.Components) > 0 {
+		return cal.Components[0]
+	}
+	return icalendar.Component{}
+}
+
+// Reports whether ours is a later revision than theirs by SEQUENCE, then
+// LAST-MODIFIED.
+func newerVersion(ours, theirs icalendar.Component) bool {
+	seq := func(c icalendar.Component) int {
+		n, _ := strconv.Atoi(c.Value("SEQUENCE"))
+		return n
+	}
+	if seq(ours) != seq(theirs) {
+		return seq(ours) > seq(theirs)
+	}
+	modified := func(c icalendar.Component) time.Time {
+		f, _ := c.Field("LAST-MODIFIED")
+		t, _ := f.DateTime()
+		return t
+	}
+	return modified(ours).After(modified(theirs))
+}
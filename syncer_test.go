@@ -0,0 +1,169 @@
+package caldav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// Starts a server with an empty calendar at /cal/work/ and returns a Syncer
+// for it along with the server's backend. Unless syncReports is set, the
+// server refuses sync-collection reports, so changes are found by ETag.
+func syncerFixture(t *testing.T, strategy ConflictStrategy, syncReports bool) (*Syncer, Backend, func()) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/work/"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !syncReports && r.Method == "REPORT" && r.Header.Get("Depth") == "" {
+			http.Error(w, "Not implemented", http.StatusNotImplemented)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	c, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	return &Syncer{Client: c, Local: NewMemoryBackend(), Calendar: "/cal/work/", Strategy: strategy}, h.Backend, server.Close
+}
+
+func syncEvent(t *testing.T, uid string, lines ...string) icalendar.Component {
+	return mustDecode(t, vcalendar(append(append([]string{"BEGIN:VEVENT", "UID:" + uid,
+		"DTSTAMP:20240101T000000Z", "DTSTART:20240101T090000Z"}, lines...), "END:VEVENT")...))
+}
+
+func Test_Syncer(t *testing.T) {
+	for _, syncReports := range []bool{true, false} {
+		s, remote, done := syncerFixture(t, MergeChanges, syncReports)
+		defer done()
+		sync := func(step string) SyncResult {
+			res, err := s.Sync()
+			if err != nil {
+				t.Fatalf("\n%s (sync reports %v): unexpected error: %s\n", step, syncReports, err)
+			}
+			return res
+		}
+		summary := func(b Backend, p string) string {
+			obj, err := b.Object(p)
+			if err != nil {
+				return err.Error()
+			}
+			return obj.Data.Components[0].Value("SUMMARY") + "/" + obj.Data.Components[0].Value("LOCATION")
+		}
+
+		remote.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Planning"), Condition{})
+		if res := sync("first pull"); len(res.Pulled) != 1 || summary(s.Local, "/cal/work/e1.ics") != "Planning/" {
+			t.Errorf("\nfirst pull: unexpected result %#v\n", res)
+		}
+		if res := sync("no changes"); len(res.Pulled)+len(res.Pushed)+len(res.Deleted)+len(res.Conflicts) != 0 {
+			t.Errorf("\nno changes: unexpected result %#v\n", res)
+		}
+
+		s.Local.PutObject("/cal/work/e2.ics", syncEvent(t, "e2", "SUMMARY:Lunch"), Condition{})
+		if res := sync("push"); len(res.Pushed) != 1 || summary(remote, "/cal/work/e2.ics") != "Lunch/" {
+			t.Errorf("\npush: unexpected result %#v\n", res)
+		}
+
+		remote.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Planning II"), Condition{})
+		s.Local.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Planning", "LOCATION:Room 1"), Condition{})
+		res := sync("merge")
+		if len(res.Conflicts) != 1 || summary(s.Local, "/cal/work/e1.ics") != "Planning II/Room 1" ||
+			summary(remote, "/cal/work/e1.ics") != "Planning II/Room 1" {
+			t.Errorf("\nmerge: unexpected result %#v: %s, %s\n", res,
+				summary(s.Local, "/cal/work/e1.ics"), summary(remote, "/cal/work/e1.ics"))
+		}
+
+		s.Local.DeleteObject("/cal/work/e2.ics", Condition{})
+		remote.DeleteObject("/cal/work/e1.ics", Condition{})
+		res = sync("deletes")
+		if len(res.Deleted) != 2 || summary(remote, "/cal/work/e2.ics") != ErrNotFound.Error() ||
+			summary(s.Local, "/cal/work/e1.ics") != ErrNotFound.Error() || len(s.State.Objects) != 0 {
+			t.Errorf("\ndeletes: unexpected result %#v\n", res)
+		}
+	}
+}
+
+func Test_ConflictStrategy(t *testing.T) {
+	tests := []struct {
+		strategy ConflictStrategy
+		local    []string
+		remote   []string
+		expected string
+	}{
+		{ServerWins, []string{"SUMMARY:Ours"}, []string{"SUMMARY:Theirs"}, "Theirs"},
+		{ClientWins, []string{"SUMMARY:Ours"}, []string{"SUMMARY:Theirs"}, "Ours"},
+		{MergeChanges, []string{"SUMMARY:Ours"}, []string{"SUMMARY:Theirs"}, "Theirs"},
+		{MergeChanges, []string{"SUMMARY:Ours", "SEQUENCE:1"}, []string{"SUMMARY:Theirs"}, "Ours"},
+		{MergeChanges, []string{"SUMMARY:Ours", "LAST-MODIFIED:20240301T000000Z"},
+			[]string{"SUMMARY:Theirs", "LAST-MODIFIED:20240201T000000Z"}, "Ours"},
+	}
+	for i, test := range tests {
+		s, remote, done := syncerFixture(t, test.strategy, true)
+		remote.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Base"), Condition{})
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("\nunexpected error: %s\n", err)
+		}
+		remote.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", test.remote...), Condition{})
+		s.Local.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", test.local...), Condition{})
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("\nunexpected error: %s\n", err)
+		}
+		for _, b := range []Backend{s.Local, remote} {
+			obj, _ := b.Object("/cal/work/e1.ics")
+			if got := obj.Data.Components[0].Value("SUMMARY"); got != test.expected {
+				t.Errorf("\ntest %d:\nexpected: %s\ngot:      %s\n", i, test.expected, got)
+			}
+		}
+		done()
+	}
+}
+
+func Test_Syncer_firstSyncConflict(t *testing.T) {
+	for _, strategy := range []ConflictStrategy{ServerWins, ClientWins, MergeChanges} {
+		s, remote, done := syncerFixture(t, strategy, true)
+		remote.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Theirs"), Condition{})
+		s.Local.CreateCalendar(Calendar{Path: "/cal/work/"})
+		if _, err := s.Local.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Ours"), Condition{}); err != nil {
+			t.Fatalf("\nunexpected error: %s\n", err)
+		}
+		for _, step := range []string{"first", "second"} {
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("\nstrategy %d, %s sync: unexpected error: %s\n", strategy, step, err)
+			}
+		}
+		local, _ := s.Local.Object("/cal/work/e1.ics")
+		server, _ := remote.Object("/cal/work/e1.ics")
+		if got, want := local.Data.Components[0].Value("SUMMARY"), server.Data.Components[0].Value("SUMMARY"); got != want {
+			t.Errorf("\nstrategy %d: sides differ:\nexpected: %s\ngot:      %s\n", strategy, want, got)
+		}
+		done()
+	}
+}
+
+func Test_Syncer_changedMeanwhile(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	h.Backend.CreateCalendar(Calendar{Path: "/cal/work/"})
+	// Somebody else creates the object just before the Syncer pushes it
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			h.Backend.PutObject(r.URL.Path, syncEvent(t, "e1", "SUMMARY:Theirs"), Condition{IfNoneMatch: []string{"*"}})
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	c, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("\nunexpected error: %s\n", err)
+	}
+	s := &Syncer{Client: c, Local: NewMemoryBackend(), Calendar: "/cal/work/", Strategy: ServerWins}
+	s.Local.CreateCalendar(Calendar{Path: "/cal/work/"})
+	s.Local.PutObject("/cal/work/e1.ics", syncEvent(t, "e1", "SUMMARY:Ours"), Condition{})
+	res, err := s.Sync()
+	if err != nil || len(res.Pushed) != 0 {
+		t.Errorf("\npush that failed its precondition: unexpected result %#v, %v\n", res, err)
+	}
+	if res, err = s.Sync(); err != nil || len(res.Conflicts) != 1 {
+		t.Errorf("\nnext sync: expected the conflict to be resolved, got %#v, %v\n", res, err)
+	}
+}
@@ -0,0 +1,216 @@
+package caldav
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/adrusi/caldav/icalendar"
+)
+
+// A TimeRange restricts a filter to a span of time, see RFC 4791 s. 9.9. Start
+// and End are UTC date-times such as 20060104T000000Z; either may be omitted
+// to leave the range open at that end, but not both.
+type TimeRange struct {
+	Start string `xml:"start,attr,omitempty"`
+	End   string `xml:"end,attr,omitempty"`
+}
+
+// A timeRange is a parsed TimeRange. Open ends are represented by the zero
+// time and by farFuture.
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+const utcLayout = "20060102T150405Z"
+
+var (
+	farFuture       = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+	errBadTimeRange = httpError{http.StatusBadRequest, "Invalid time-range"}
+)
+
+// Recurring components are expanded at most this far past the start of a
+// range without an end.
+const openRangeYears = 100
+
+func (tr TimeRange) parse() (r timeRange, err error) {
+	if tr.Start == "" && tr.End == "" {
+		err = errBadTimeRange
+		return
+	}
+	r.end = farFuture
+	if tr.Start != "" {
+		if r.start, err = time.Parse(utcLayout, tr.Start); err != nil {
+			err = errBadTimeRange
+			return
+		}
+	}
+	if tr.End != "" {
+		if r.end, err = time.Parse(utcLayout, tr.End); err != nil {
+			err = errBadTimeRange
+			return
+		}
+	}
+	if !r.end.After(r.start) {
+		err = errBadTimeRange
+	}
+	return
+}
+
+// Closes off a range without an end for recurrence expansion.
+func (r timeRange) bounded() timeRange {
+	if r.end.Equal(farFuture) {
+		r.end = r.start.AddDate(openRangeYears, 0, 0)
+	}
+	return r
+}
+
+// Returns a window to expand recurrences over that is a little wider than the
+// range, so that instances touching its ends are considered.
+func (r timeRange) window() (from, to time.Time) {
+	r = r.bounded()
+	return r.start.Add(-time.Second), r.end.Add(time.Second)
+}
+
+func (r timeRange) union(other timeRange) timeRange {
+	if other.start.Before(r.start) {
+		r.start = other.start
+	}
+	if other.end.After(r.end) {
+		r.end = other.end
+	}
+	return r
+}
+
+// Reports whether a point in time falls in the range.
+func (r timeRange) contains(t time.Time) bool {
+	return !r.start.After(t) && r.end.After(t)
+}
+
+// Tests one instance of a VEVENT, VTODO or VJOURNAL against the tables in RFC
+// 4791 s. 9.9.
+func (r timeRange) matchInstance(name string, inst icalendar.Instance) bool {
+	s, e := inst.Start, inst.End
+	if name != "VTODO" {
+		if e.Equal(s) {
+			return r.contains(s)
+		}
+		return r.start.Before(e) && r.end.After(s)
+	}
+	c := inst.Component
+	_, hasStart := c.Field("DTSTART")
+	_, hasDue := c.Field("DUE")
+	_, hasDur := c.Field("DURATION")
+	switch {
+	case !hasStart:
+		// The instance starts and ends at its DUE
+		return r.start.Before(s) && !r.end.Before(s)
+	case hasDur:
+		return !r.start.After(e) && (r.end.After(s) || !r.end.Before(e))
+	case hasDue:
+		return (r.start.Before(e) || !r.start.After(s)) && (r.end.After(s) || !r.end.Before(e))
+	}
+	return r.contains(s)
+}
+
+// Tests a VTODO with neither DTSTART nor DUE, which is placed in time by its
+// COMPLETED and CREATED properties if at all.
+func (r timeRange) matchUndatedTodo(c icalendar.Component, floating *time.Location) bool {
+	var completed, created time.Time
+	var err error
+	f, hasCompleted := c.Field("COMPLETED")
+	if hasCompleted {
+		if completed, err = f.DateTimeIn(floating); err != nil {
+			return false
+		}
+	}
+	f, hasCreated := c.Field("CREATED")
+	if hasCreated {
+		if created, err = f.DateTimeIn(floating); err != nil {
+			return false
+		}
+	}
+	switch {
+	case hasCompleted && hasCreated:
+		return (!r.start.After(created) || !r.start.After(completed)) &&
+			(!r.end.Before(created) || !r.end.Before(completed))
+	case hasCompleted:
+		return !r.start.After(completed) && !r.end.Before(completed)
+	case hasCreated:
+		return r.end.After(created)
+	}
+	return true
+}
+
+func (r timeRange) matchFreeBusy(c icalendar.Component) bool {
+	fb, err := icalendar.ParseVFreeBusy(c)
+	if err != nil {
+		return false
+	}
+	if !fb.Start.IsZero() && !fb.End.IsZero() {
+		return !r.start.After(fb.End) && r.end.After(fb.Start)
+	}
+	for _, periods := range fb.Busy {
+		for _, p := range periods {
+			if r.start.Before(p.End) && r.end.After(p.Start) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tests whether a VALARM fires within the range for the instance of its parent
+// that inst describes. Without an instance only absolute triggers can match.
+func (r timeRange) matchAlarm(c icalendar.Component, inst *icalendar.Instance) bool {
+	alarm, err := icalendar.ParseAlarm(c)
+	if err != nil {
+		return false
+	}
+	if inst == nil && !alarm.Trigger.Absolute() {
+		return false
+	}
+	var start, end time.Time
+	if inst != nil {
+		start, end = inst.Start, inst.End
+	}
+	for _, at := range alarm.Times(start, end) {
+		if r.contains(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the most time a DURATION can span, with its days as long as they get
+// across a daylight saving change.
+func span(d icalendar.Duration) time.Duration {
+	if d.Days < 0 || d.Time < 0 {
+		d.Days, d.Time = -d.Days, -d.Time
+	}
+	return time.Duration(d.Days)*25*time.Hour + d.Time
+}
+
+// Tests a DATE or DATE-TIME property.
+func (r timeRange) matchField(f icalendar.Field, floating *time.Location) bool {
+	t, err := f.DateTimeIn(floating)
+	return err == nil && r.contains(t)
+}
+
+// Returns how far from its instance any of the alarms in the components can
+// fire, so that expansion can find instances whose alarms fire in a range.
+func alarmReach(comps []icalendar.Component) (reach time.Duration) {
+	for _, c := range comps {
+		for _, child := range c.ComponentsNamed("VALARM") {
+			alarm, err := icalendar.ParseAlarm(child)
+			if err != nil || alarm.Trigger.Absolute() {
+				continue
+			}
+			d := span(alarm.Trigger.Offset) + time.Duration(alarm.Repeat)*span(alarm.Interval)
+			if d > reach {
+				reach = d
+			}
+		}
+	}
+	return
+}
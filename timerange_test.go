@@ -0,0 +1,115 @@
+package caldav
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func vcalendar(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Test//EN\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+}
+
+// Wraps a filter on a component of a VCALENDAR in the VCALENDAR filter.
+func inCalendar(f CompFilter) CompFilter {
+	return CompFilter{Name: "VCALENDAR", Comps: []CompFilter{f}}
+}
+
+func Test_TimeRange(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	weekly := vcalendar("BEGIN:VEVENT", "UID:w", "DTSTART:20240101T090000Z", "DTEND:20240101T100000Z",
+		"RRULE:FREQ=WEEKLY", "EXDATE:20240205T090000Z",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "TRIGGER:-PT15M", "END:VALARM", "END:VEVENT")
+	allDay := vcalendar("BEGIN:VEVENT", "UID:d", "DTSTART;VALUE=DATE:20240110", "END:VEVENT")
+	floating := vcalendar("BEGIN:VEVENT", "UID:f", "DTSTART:20240110T090000", "END:VEVENT")
+	due := vcalendar("BEGIN:VTODO", "UID:t", "DUE:20240110T100000Z", "END:VTODO")
+	done := vcalendar("BEGIN:VTODO", "UID:c", "COMPLETED:20240110T100000Z", "END:VTODO")
+	freebusy := vcalendar("BEGIN:VFREEBUSY", "UID:fb", "FREEBUSY:20240110T100000Z/PT1H", "END:VFREEBUSY")
+
+	event := func(start, end string) CompFilter {
+		return inCalendar(CompFilter{Name: "VEVENT", TimeRange: &TimeRange{start, end}})
+	}
+	todo := func(start, end string) CompFilter {
+		return inCalendar(CompFilter{Name: "VTODO", TimeRange: &TimeRange{start, end}})
+	}
+	alarm := func(start, end string) CompFilter {
+		return inCalendar(CompFilter{Name: "VEVENT", Comps: []CompFilter{{Name: "VALARM", TimeRange: &TimeRange{start, end}}}})
+	}
+	testCases := []struct {
+		name     string
+		src      string
+		filter   CompFilter
+		floating *time.Location
+		expected bool
+	}{
+		{"weekly instance next month", weekly, event("20240212T000000Z", "20240213T000000Z"), time.UTC, true},
+		{"weekly before its start", weekly, event("20231201T000000Z", "20231231T000000Z"), time.UTC, false},
+		{"weekly between instances", weekly, event("20240213T000000Z", "20240219T000000Z"), time.UTC, false},
+		{"weekly excluded instance", weekly, event("20240205T000000Z", "20240206T000000Z"), time.UTC, false},
+		{"weekly open-ended", weekly, event("20300101T000000Z", ""), time.UTC, true},
+		{"range ending at DTSTART", weekly, event("20240101T080000Z", "20240101T090000Z"), time.UTC, false},
+		{"range starting at DTEND", weekly, event("20240101T100000Z", "20240101T110000Z"), time.UTC, false},
+		{"all-day event late that day", allDay, event("20240110T230000Z", "20240111T010000Z"), time.UTC, true},
+		{"all-day event the day after", allDay, event("20240111T000000Z", "20240112T000000Z"), time.UTC, false},
+		{"floating event as UTC", floating, event("20240110T140000Z", "20240110T143000Z"), time.UTC, false},
+		{"floating event in New York", floating, event("20240110T140000Z", "20240110T143000Z"), ny, true},
+		{"todo due at range end", due, todo("20240110T090000Z", "20240110T100000Z"), time.UTC, true},
+		{"todo due at range start", due, todo("20240110T100000Z", "20240110T110000Z"), time.UTC, false},
+		{"todo completed in range", done, todo("20240110T000000Z", "20240111T000000Z"), time.UTC, true},
+		{"todo completed before range", done, todo("20240111T000000Z", "20240112T000000Z"), time.UTC, false},
+		{"alarm of a later instance", weekly, alarm("20240311T084000Z", "20240311T085000Z"), time.UTC, true},
+		{"alarm at the instance itself", weekly, alarm("20240311T090000Z", "20240311T091000Z"), time.UTC, false},
+		{"freebusy period", freebusy, inCalendar(CompFilter{Name: "VFREEBUSY",
+			TimeRange: &TimeRange{"20240110T103000Z", "20240110T120000Z"}}), time.UTC, true},
+		{"freebusy outside period", freebusy, inCalendar(CompFilter{Name: "VFREEBUSY",
+			TimeRange: &TimeRange{"20240110T110000Z", "20240110T120000Z"}}), time.UTC, false},
+		{"property time range", due, inCalendar(CompFilter{Name: "VTODO", Props: []PropFilter{{Name: "DUE",
+			TimeRange: &TimeRange{"20240110T000000Z", "20240111T000000Z"}}}}), time.UTC, true},
+	}
+	for _, tc := range testCases {
+		cal := mustDecode(t, tc.src)
+		if err := tc.filter.validate(); err != nil {
+			t.Fatalf("\nin case %s:\nunexpected error: %s\n", tc.name, err)
+		}
+		if got := tc.filter.MatchesIn(cal, tc.floating); got != tc.expected {
+			t.Errorf("\nin case %s:\nexpected: %t\ngot:      %t\n", tc.name, tc.expected, got)
+		}
+	}
+	for _, tr := range []TimeRange{{}, {"20240110", ""}, {"20240111T000000Z", "20240110T000000Z"}} {
+		if err := event(tr.Start, tr.End).validate(); err != errBadTimeRange {
+			t.Errorf("\nin case %#v:\nexpected: %s\ngot:      %v\n", tr, errBadTimeRange, err)
+		}
+	}
+}
+
+func Test_calendarTimeZone(t *testing.T) {
+	h := &Handler{Backend: NewMemoryBackend()}
+	rec := do(t, h, "MKCALENDAR", "/cal/ny/", `<?xml version="1.0"?>
+<C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:set><D:prop><C:calendar-timezone>BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VTIMEZONE
+TZID:America/New_York
+END:VTIMEZONE
+END:VCALENDAR
+</C:calendar-timezone></D:prop></D:set>
+</C:mkcalendar>`)
+	if rec.Code != 201 {
+		t.Fatalf("\nMKCALENDAR: expected 201, got %d: %s\n", rec.Code, rec.Body)
+	}
+	do(t, h, "PUT", "/cal/ny/f.ics", vcalendar("BEGIN:VEVENT", "UID:f", "DTSTART:20240110T090000", "END:VEVENT"))
+	query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+    <C:time-range start="20240110T140000Z" end="20240110T143000Z"/>
+  </C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+	rec = do(t, h, "REPORT", "/cal/ny/", query, "Depth", "1")
+	if !strings.Contains(rec.Body.String(), "/cal/ny/f.ics") {
+		t.Errorf("\nfloating event not matched in the calendar's zone:\n%s\n", rec.Body)
+	}
+	rec = do(t, h, "PROPFIND", "/cal/ny/", "", "Depth", "0")
+	if !strings.Contains(rec.Body.String(), "TZID:America/New_York") {
+		t.Errorf("\nPROPFIND lacks calendar-timezone:\n%s\n", rec.Body)
+	}
+}
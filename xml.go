@@ -0,0 +1,297 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	davNS    = "DAV:"
+	caldavNS = "urn:ietf:params:xml:ns:caldav"
+)
+
+var (
+	davResourceType = xml.Name{Space: davNS, Local: "resourcetype"}
+	davDisplayName  = xml.Name{Space: davNS, Local: "displayname"}
+	davGetETag      = xml.Name{Space: davNS, Local: "getetag"}
+	davContentType  = xml.Name{Space: davNS, Local: "getcontenttype"}
+	davContentLen   = xml.Name{Space: davNS, Local: "getcontentlength"}
+	davLastModified = xml.Name{Space: davNS, Local: "getlastmodified"}
+	davReportSet    = xml.Name{Space: davNS, Local: "supported-report-set"}
+	davSyncToken    = xml.Name{Space: davNS, Local: "sync-token"}
+	davSyncColl     = xml.Name{Space: davNS, Local: "sync-collection"}
+
+	davCurrentUser     = xml.Name{Space: davNS, Local: "current-user-principal"}
+	davPrincipalURL    = xml.Name{Space: davNS, Local: "principal-URL"}
+	davPrincipalColl   = xml.Name{Space: davNS, Local: "principal-collection-set"}
+	davPrincipalSearch = xml.Name{Space: davNS, Local: "principal-property-search"}
+	davSearchSet       = xml.Name{Space: davNS, Local: "principal-search-property-set"}
+	davGroupMembership = xml.Name{Space: davNS, Local: "group-membership"}
+	davGroupMemberSet  = xml.Name{Space: davNS, Local: "group-member-set"}
+	davOwner           = xml.Name{Space: davNS, Local: "owner"}
+	davACL             = xml.Name{Space: davNS, Local: "acl"}
+	davACLRestrictions = xml.Name{Space: davNS, Local: "acl-restrictions"}
+	davCurrentPrivs    = xml.Name{Space: davNS, Local: "current-user-privilege-set"}
+	davSupportedPrivs  = xml.Name{Space: davNS, Local: "supported-privilege-set"}
+
+	calDescription  = xml.Name{Space: caldavNS, Local: "calendar-description"}
+	calTimeZone     = xml.Name{Space: caldavNS, Local: "calendar-timezone"}
+	calSupportedSet = xml.Name{Space: caldavNS, Local: "supported-calendar-component-set"}
+	calSupportedDat = xml.Name{Space: caldavNS, Local: "supported-calendar-data"}
+	calCalendarData = xml.Name{Space: caldavNS, Local: "calendar-data"}
+	calQuery        = xml.Name{Space: caldavNS, Local: "calendar-query"}
+	calMultiget     = xml.Name{Space: caldavNS, Local: "calendar-multiget"}
+	calFreeBusy     = xml.Name{Space: caldavNS, Local: "free-busy-query"}
+	calScheduleTag  = xml.Name{Space: caldavNS, Local: "schedule-tag"}
+	calMaxSize      = xml.Name{Space: caldavNS, Local: "max-resource-size"}
+	calMinDate      = xml.Name{Space: caldavNS, Local: "min-date-time"}
+	calMaxDate      = xml.Name{Space: caldavNS, Local: "max-date-time"}
+	calMaxInstances = xml.Name{Space: caldavNS, Local: "max-instances"}
+	calHomeSet      = xml.Name{Space: caldavNS, Local: "calendar-home-set"}
+	calUserAddrSet  = xml.Name{Space: caldavNS, Local: "calendar-user-address-set"}
+	calInboxURL     = xml.Name{Space: caldavNS, Local: "schedule-inbox-URL"}
+	calOutboxURL    = xml.Name{Space: caldavNS, Local: "schedule-outbox-URL"}
+)
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"response"`
+	SyncToken string     `xml:"sync-token,omitempty"`
+}
+
+type response struct {
+	Href      string     `xml:"href"`
+	Propstats []propstat `xml:"propstat,omitempty"`
+	Status    string     `xml:"status,omitempty"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"prop"`
+	Status string `xml:"status"`
+}
+
+type prop struct {
+	Props []property
+}
+
+// A property is a single WebDAV property, holding its value as already
+// escaped XML so that it can contain elements from any namespace.
+type property struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// An anyElement matches any XML element, keeping only its name. It is used to
+// read the property names listed in requests.
+type anyElement struct {
+	XMLName xml.Name
+}
+
+// A propSelection is the part of a PROPFIND or REPORT request that says which
+// properties to return.
+type propSelection struct {
+	AllProp  *struct{} `xml:"allprop"`
+	PropName *struct{} `xml:"propname"`
+	Prop     *struct {
+		Names []anyElement `xml:",any"`
+		// calendar-data has options of its own, so it is kept apart
+		CalendarData *calendarDataRequest `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	} `xml:"prop"`
+}
+
+// Returns the names of the properties asked for by name.
+func (sel propSelection) requested() []xml.Name {
+	if sel.Prop == nil {
+		return nil
+	}
+	var names []xml.Name
+	for _, el := range sel.Prop.Names {
+		names = append(names, el.XMLName)
+	}
+	if sel.Prop.CalendarData != nil {
+		names = append(names, calCalendarData)
+	}
+	return names
+}
+
+func (sel propSelection) validate() error {
+	if sel.Prop != nil && sel.Prop.CalendarData != nil {
+		return sel.Prop.CalendarData.validate()
+	}
+	return nil
+}
+
+// A calendarDataRequest is a calendar-data element in a request, which says
+// what to return of each object, see RFC 4791 s. 9.6.
+type calendarDataRequest struct {
+	ContentType        string         `xml:"content-type,attr"`
+	Version            string         `xml:"version,attr"`
+	Comp               *compSelection `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	Expand             *TimeRange     `xml:"urn:ietf:params:xml:ns:caldav expand"`
+	LimitRecurrenceSet *TimeRange     `xml:"urn:ietf:params:xml:ns:caldav limit-recurrence-set"`
+}
+
+type compSelection struct {
+	Name    string          `xml:"name,attr"`
+	AllProp *struct{}       `xml:"urn:ietf:params:xml:ns:caldav allprop"`
+	Props   []propSelector  `xml:"urn:ietf:params:xml:ns:caldav prop"`
+	AllComp *struct{}       `xml:"urn:ietf:params:xml:ns:caldav allcomp"`
+	Comps   []compSelection `xml:"urn:ietf:params:xml:ns:caldav comp"`
+}
+
+type propSelector struct {
+	Name    string `xml:"name,attr"`
+	NoValue string `xml:"novalue,attr"`
+}
+
+type propfindRequest struct {
+	XMLName xml.Name `xml:"DAV: propfind"`
+	propSelection
+}
+
+type calendarQuery struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-query"`
+	propSelection
+	Filter struct {
+		Comp CompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	TimeZone string `xml:"urn:ietf:params:xml:ns:caldav timezone"`
+}
+
+type syncCollection struct {
+	XMLName   xml.Name `xml:"DAV: sync-collection"`
+	SyncToken string   `xml:"DAV: sync-token"`
+	SyncLevel string   `xml:"DAV: sync-level"`
+	Limit     *struct {
+		NResults int `xml:"DAV: nresults"`
+	} `xml:"DAV: limit"`
+	propSelection
+}
+
+// The result of a POST to an outbox, see RFC 6638 s. 10.1.
+type scheduleResponse struct {
+	XMLName   xml.Name            `xml:"urn:ietf:params:xml:ns:caldav schedule-response"`
+	Responses []recipientResponse `xml:"response"`
+}
+
+type recipientResponse struct {
+	Recipient     davHref `xml:"recipient"`
+	RequestStatus string  `xml:"request-status"`
+	CalendarData  string  `xml:"calendar-data,omitempty"`
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+type freeBusyQuery struct {
+	XMLName   xml.Name   `xml:"urn:ietf:params:xml:ns:caldav free-busy-query"`
+	TimeRange *TimeRange `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+}
+
+type calendarMultiget struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-multiget"`
+	propSelection
+	Hrefs []string `xml:"DAV: href"`
+}
+
+type principalPropertySearch struct {
+	XMLName  xml.Name `xml:"DAV: principal-property-search"`
+	Test     string   `xml:"test,attr"`
+	Searches []struct {
+		Prop struct {
+			Names []anyElement `xml:",any"`
+		} `xml:"DAV: prop"`
+		Match string `xml:"DAV: match"`
+	} `xml:"DAV: property-search"`
+	propSelection
+}
+
+type aclRequest struct {
+	XMLName xml.Name `xml:"DAV: acl"`
+	ACEs    []struct {
+		Principal struct {
+			Href            string    `xml:"DAV: href"`
+			All             *struct{} `xml:"DAV: all"`
+			Authenticated   *struct{} `xml:"DAV: authenticated"`
+			Unauthenticated *struct{} `xml:"DAV: unauthenticated"`
+		} `xml:"DAV: principal"`
+		Invert    *struct{}      `xml:"DAV: invert"`
+		Grant     *privilegeList `xml:"DAV: grant"`
+		Deny      *privilegeList `xml:"DAV: deny"`
+		Protected *struct{}      `xml:"DAV: protected"`
+	} `xml:"DAV: ace"`
+}
+
+type privilegeList struct {
+	Privileges []struct {
+		Names []anyElement `xml:",any"`
+	} `xml:"DAV: privilege"`
+}
+
+type mkcalendarRequest struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav mkcalendar"`
+	Set     struct {
+		Prop struct {
+			DisplayName string `xml:"DAV: displayname"`
+			Description string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+			TimeZone    string `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+			Components  struct {
+				Comps []struct {
+					Name string `xml:"name,attr"`
+				} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+			} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+		} `xml:"DAV: prop"`
+	} `xml:"DAV: set"`
+}
+
+func status(code int) string {
+	return "HTTP/1.1 " + strconv.Itoa(code) + " " + http.StatusText(code)
+}
+
+// Escapes text for inclusion in an XML element.
+func escapeText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Renders an empty element, declaring its namespace.
+func emptyElement(name xml.Name) string {
+	return `<` + name.Local + ` xmlns="` + name.Space + `"/>`
+}
+
+func hrefFor(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// Returns the path an href in a request points at, or the empty string if it
+// can't be parsed.
+func hrefPath(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	return cleanPath(u.Path)
+}
+
+func writeError(w http.ResponseWriter, err preconditionError) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(err.code)
+	w.Write([]byte(xml.Header))
+	cond := emptyElement(err.cond)
+	if err.inner != "" {
+		cond = `<` + err.cond.Local + ` xmlns="` + err.cond.Space + `">` + err.inner + `</` + err.cond.Local + `>`
+	}
+	w.Write([]byte(`<error xmlns="` + davNS + `">` + cond + `</error>`))
+}
+
+func writeMultistatus(w http.ResponseWriter, ms multistatus) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(ms)
+}